@@ -13,6 +13,9 @@ import (
 // @securityDefinitions.apiKey Bearer
 // @in header
 // @name Authorization
+// @securityDefinitions.apiKey ApiKey
+// @in header
+// @name X-API-Key
 func main() {
 	app.Start()
 }
@@ -39,6 +39,12 @@ func setFromEnv(cfg *Config) {
 
 	cfg.Auth.PasswordSalt = os.Getenv("PASSWORD_SALT")
 	cfg.Auth.JWT.SigningKey = os.Getenv("JWT_SIGNING_KEY")
+	cfg.Auth.OIDC.ClientSecret = os.Getenv("OIDC_CLIENT_SECRET")
+	cfg.Auth.LDAP.BindPassword = os.Getenv("LDAP_BIND_PASSWORD")
+	cfg.Auth.SCIM.Token = os.Getenv("SCIM_TOKEN")
+	if cfg.Notifier != nil {
+		cfg.Notifier.SMTP.Password = os.Getenv("SMTP_PASSWORD")
+	}
 	cfg.Repository.Mongo.URI = fmt.Sprintf("mongodb://%s:%s@%s:%s", cfg.Repository.Mongo.User, cfg.Repository.Mongo.Password, cfg.Repository.Mongo.Host, cfg.Repository.Mongo.Port)
 }
 
@@ -46,33 +52,221 @@ type Config struct {
 	App        *AppCfg     `yaml:"app"`
 	Repository *Repository `yaml:"repository"`
 	Auth       *AuthConfig `yaml:"auth"`
+	Notifier   *Notifier   `yaml:"notifier"`
 }
 
 type AuthConfig struct {
-	JWT          JWTConfig
-	PasswordSalt string
+	JWT           JWTConfig
+	PasswordSalt  string
+	Lockout       LockoutConfig       `yaml:"lockout"`
+	Password      PasswordPolicy      `yaml:"password_policy"`
+	PasswordReset PasswordResetConfig `yaml:"password_reset"`
+	Verification  VerificationConfig  `yaml:"email_verification"`
+	TwoFactor     TwoFactorConfig     `yaml:"two_factor"`
+	OIDC          OIDCConfig          `yaml:"oidc"`
+	LDAP          LDAPConfig          `yaml:"ldap"`
+	SCIM          SCIMConfig          `yaml:"scim"`
+	// UserCacheTTL bounds how long a role change or a disabled account
+	// takes to be enforced on requests with an already issued token.
+	UserCacheTTL time.Duration `yaml:"user_cache_ttl"`
+	// ImpersonationTTL is the lifetime of the access tokens admins get to
+	// act as another user.
+	ImpersonationTTL time.Duration `yaml:"impersonation_ttl"`
+}
+
+// OIDCConfig configures single sign-on with an OpenID Connect provider.
+// Users are created on their first login and matched by the subject claim
+// afterwards.
+type OIDCConfig struct {
+	Enabled      bool     `yaml:"enabled"`
+	Issuer       string   `yaml:"issuer"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   // set from OIDC_CLIENT_SECRET
+	RedirectURL  string   `yaml:"redirect_url"`
+	Scopes       []string `yaml:"scopes"`
+	// StateTTL bounds the time between redirecting to the provider and the
+	// callback.
+	StateTTL time.Duration `yaml:"state_ttl"`
+	Claims   OIDCClaims    `yaml:"claims"`
+	// RoleMapping maps values of the groups claim to roles. When it is set,
+	// the role is synced on every login.
+	RoleMapping map[string]int `yaml:"role_mapping"`
+}
+
+// OIDCClaims names the ID token claims mapped to the local user.
+type OIDCClaims struct {
+	Username string `yaml:"username"`
+	Email    string `yaml:"email"`
+	Groups   string `yaml:"groups"`
+}
+
+// LDAPConfig configures password login against an LDAP directory. It is
+// tried after the local password check, and users are created on their
+// first successful bind.
+type LDAPConfig struct {
+	Enabled  bool   `yaml:"enabled"`
+	URL      string `yaml:"url"` // ldap:// or ldaps://
+	StartTLS bool   `yaml:"start_tls"`
+	// BindDN is the service account used to search for users, anonymous
+	// when empty.
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string // set from LDAP_BIND_PASSWORD
+	BaseDN       string `yaml:"base_dn"`
+	// UserFilter receives the escaped username, e.g. (uid=%s).
+	UserFilter string         `yaml:"user_filter"`
+	Timeout    time.Duration  `yaml:"timeout"`
+	Attributes LDAPAttributes `yaml:"attributes"`
+	// RoleMapping maps group DNs to roles. When it is set, the role is
+	// synced on every login.
+	RoleMapping map[string]int `yaml:"role_mapping"`
+}
+
+// LDAPAttributes names the entry attributes mapped to the local user. An
+// empty ID uses the entry DN.
+type LDAPAttributes struct {
+	ID          string `yaml:"id"`
+	Username    string `yaml:"username"`
+	Email       string `yaml:"email"`
+	DisplayName string `yaml:"display_name"`
+	Groups      string `yaml:"groups"`
+}
+
+// SCIMConfig enables the SCIM 2.0 provisioning API. The client
+// authenticates with a bearer token.
+type SCIMConfig struct {
+	Enabled bool   `yaml:"enabled"`
+	Token   string // set from SCIM_TOKEN
+}
+
+type TwoFactorConfig struct {
+	Issuer       string        `yaml:"issuer"` // shown by authenticator apps
+	ChallengeTTL time.Duration `yaml:"challenge_ttl"`
+}
+
+// PasswordResetConfig controls the forgot/reset password flow. URL is a
+// format string receiving the reset token.
+// PasswordPolicy are the rules for passwords chosen by users. BreachedDir
+// holds k-anonymity range files of breached password hashes, the check is
+// skipped when it is empty.
+type PasswordPolicy struct {
+	MinLength      int    `yaml:"min_length"`
+	MaxLength      int    `yaml:"max_length"`
+	RequireUpper   bool   `yaml:"require_upper"`
+	RequireLower   bool   `yaml:"require_lower"`
+	RequireDigit   bool   `yaml:"require_digit"`
+	RequireSymbol  bool   `yaml:"require_symbol"`
+	RejectUsername bool   `yaml:"reject_username"`
+	BreachedDir    string `yaml:"breached_dir"`
+}
+
+// VerificationConfig configures the email verification links sent on
+// signup. ResendCooldown is the minimum time between two links.
+type VerificationConfig struct {
+	TokenTTL       time.Duration `yaml:"token_ttl"`
+	URL            string        `yaml:"url"`
+	ResendCooldown time.Duration `yaml:"resend_cooldown"`
+}
+
+// PasswordResetConfig also limits the reset requests per username and per
+// client IP within RequestWindow, zero leaves them unlimited.
+type PasswordResetConfig struct {
+	TokenTTL      time.Duration `yaml:"token_ttl"`
+	URL           string        `yaml:"url"`
+	MaxRequests   int           `yaml:"max_requests"`
+	MaxIPRequests int           `yaml:"max_ip_requests"`
+	RequestWindow time.Duration `yaml:"request_window"`
+}
+
+// LockoutConfig controls brute-force protection on login. Once a username
+// or client IP reaches its limit within Window, it is locked for BaseLockout,
+// doubling with every further failure up to MaxLockout.
+type LockoutConfig struct {
+	MaxAttempts   int           `yaml:"max_attempts"`
+	MaxIPAttempts int           `yaml:"max_ip_attempts"`
+	Window        time.Duration `yaml:"window"`
+	BaseLockout   time.Duration `yaml:"base_lockout"`
+	MaxLockout    time.Duration `yaml:"max_lockout"`
 }
 
 type JWTConfig struct {
 	AccessTokenTTL  time.Duration `yaml:"access_token_ttl"`
 	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl"`
 	SigningKey      string
+	ActiveKeyID     string   `yaml:"active_key_id"`
+	Keys            []JWTKey `yaml:"keys"`
+}
+
+// JWTKey describes an asymmetric key pair. When no keys are configured
+// tokens are signed with the HS256 SigningKey.
+type JWTKey struct {
+	ID             string `yaml:"kid"`
+	Algorithm      string `yaml:"algorithm"` // RS256 or EdDSA
+	PrivateKeyFile string `yaml:"private_key_file"`
+	PublicKeyFile  string `yaml:"public_key_file"`
 }
 
 type Mongo struct {
-	URI             string
-	DBName          string
-	UsersCollection string `yaml:"users_collection"`
-	BooksCollection string `yaml:"books_collection"`
-	User            string
-	Password        string
-	Host            string
-	Port            string
+	URI                string
+	DBName             string
+	UsersCollection    string `yaml:"users_collection"`
+	BooksCollection    string `yaml:"books_collection"`
+	APIKeysCollection  string `yaml:"api_keys_collection"`
+	AuditCollection    string `yaml:"audit_collection"`
+	ResetsCollection   string `yaml:"password_resets_collection"`
+	SettingsCollection string `yaml:"settings_collection"`
+	User               string
+	Password           string
+	Host               string
+	Port               string
 }
 
+// Redis configures the Redis cache. Ttl is the lifetime of cached entries
+// with either cache driver, NegativeTtl the one of books found missing from
+// the database (zero turns that off).
 type Redis struct {
-	Addr string
-	Ttl  time.Duration `yaml:"ttl"`
+	Addr        string
+	Ttl         time.Duration `yaml:"ttl"`
+	NegativeTtl time.Duration `yaml:"negative_ttl"`
+}
+
+// CacheConfig selects where cached books, login attempts and SSO states
+// are kept: "redis" (the default), "memory" for a single replica without
+// Redis, or "none" to not cache books, keeping the rest in memory.
+type CacheConfig struct {
+	Driver     string        `yaml:"driver"`
+	MaxEntries int           `yaml:"max_entries"` // bound of the memory driver
+	L1         L1CacheConfig `yaml:"l1"`
+	// Consistency schedules the check of cached books against the database
+	Consistency ConsistencyConfig `yaml:"consistency"`
+}
+
+// ConsistencyConfig runs the cache consistency check every Interval (zero
+// turns the schedule off), evicting drifting entries when Repair is set.
+type ConsistencyConfig struct {
+	Interval time.Duration `yaml:"interval"`
+	Repair   bool          `yaml:"repair"`
+}
+
+// L1CacheConfig keeps hot books in process in front of Redis. Replicas
+// evict each other's copies through Redis pub/sub, TTL only bounds how
+// long a copy lives while it is read.
+type L1CacheConfig struct {
+	Enabled    bool          `yaml:"enabled"`
+	TTL        time.Duration `yaml:"ttl"`
+	MaxEntries int           `yaml:"max_entries"`
+}
+
+type Notifier struct {
+	Driver string `yaml:"driver"` // log or smtp
+	SMTP   SMTP   `yaml:"smtp"`
+}
+
+type SMTP struct {
+	Host     string `yaml:"host"`
+	Port     int    `yaml:"port"`
+	From     string `yaml:"from"`
+	Username string `yaml:"username"`
+	Password string
 }
 
 type CorsCfg struct {
@@ -88,11 +282,44 @@ type AppCfg struct {
 	Cors *CorsCfg      `yaml:"cors"`
 	RTO  time.Duration `yaml:"rto"`
 	WTO  time.Duration `yaml:"wto"`
+	// HTTPCache holds the Cache-Control directives of the catalog reads,
+	// keyed by route ("book", "book_list"). The anonymous ones only apply
+	// with PublicCatalog.
+	HTTPCache map[string]HTTPCachePolicy `yaml:"http_cache"`
+	// TrustedProxies lists the reverse proxies (CIDRs or addresses) whose
+	// X-Forwarded-For and X-Real-IP headers give the client IP. Without
+	// them every client is seen with the proxy's address.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// PublicCatalog lets callers without credentials read books.
+	PublicCatalog bool `yaml:"public_catalog"`
+}
+
+// HTTPCachePolicy is sent to callers with credentials and to anonymous
+// ones. Empty directives fall back to "no-cache".
+type HTTPCachePolicy struct {
+	Authenticated string `yaml:"authenticated"`
+	Anonymous     string `yaml:"anonymous"`
 }
 
 type Repository struct {
-	Mongo Mongo `yaml:"mongo"`
-	Redis Redis `yaml:"redis"`
+	Mongo    Mongo          `yaml:"mongo"`
+	Redis    Redis          `yaml:"redis"`
+	Cache    CacheConfig    `yaml:"cache"`
+	Breakers BreakersConfig `yaml:"breakers"`
+}
+
+// BreakersConfig guards the book cache and the book database.
+type BreakersConfig struct {
+	Cache    BreakerConfig `yaml:"cache"`
+	Database BreakerConfig `yaml:"database"`
+}
+
+// BreakerConfig opens a breaker after Threshold consecutive failures and
+// lets a trial call through after Cooldown. Timeout bounds every call.
+type BreakerConfig struct {
+	Threshold int           `yaml:"threshold"`
+	Cooldown  time.Duration `yaml:"cooldown"`
+	Timeout   time.Duration `yaml:"timeout"`
 }
 
 type HTTPClientConf struct {
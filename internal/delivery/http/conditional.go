@@ -0,0 +1,118 @@
+package http
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	json "github.com/json-iterator/go"
+	"go.uber.org/zap"
+)
+
+// defaultCacheControl makes caches revalidate routes without a policy, the
+// ETag still saves the body.
+const defaultCacheControl = "no-cache"
+
+// CachePolicy holds the Cache-Control directives of a route for callers
+// sending credentials and for anonymous ones.
+type CachePolicy struct {
+	Authenticated string
+	Anonymous     string
+}
+
+// LastModified is the modification time of a representation. Exact is
+// false when it can change without the time moving, like a page of books
+// shifted by a deletion: the time is still sent, but If-Modified-Since is
+// not answered with 304 based on it.
+type LastModified struct {
+	Time  time.Time
+	Exact bool
+}
+
+// directive picks the directives for the caller. Credentials are told
+// apart by their headers only, the route has authenticated the request
+// already.
+func (p CachePolicy) directive(r *http.Request) string {
+	if r.Header.Get("Authorization") != "" || r.Header.Get("X-API-Key") != "" {
+		return p.Authenticated
+	}
+	return p.Anonymous
+}
+
+// WithConditionalOK writes v with a strong ETag of its encoding, the
+// Last-Modified time when known and the Cache-Control directives of the
+// route, or answers 304 Not Modified when the request's validators still
+// match.
+func (r *responder) WithConditionalOK(w http.ResponseWriter, req *http.Request, route string, v interface{}, lastModified LastModified) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		r.logger.Error("encoding response error: ", zap.Error(err))
+		r.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	sum := sha256.Sum256(data)
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+	// HTTP dates have no sub-second part
+	modified := lastModified.Time.UTC().Truncate(time.Second)
+
+	cacheControl := defaultCacheControl
+	if policy, ok := r.cachePolicies[route]; ok {
+		if directive := policy.directive(req); directive != "" {
+			cacheControl = directive
+		}
+	}
+
+	header := w.Header()
+	header.Set("ETag", etag)
+	header.Set("Cache-Control", cacheControl)
+	header.Add("Vary", "Authorization, X-API-Key")
+	if !modified.IsZero() {
+		header.Set("Last-Modified", modified.Format(http.TimeFormat))
+	}
+	if !lastModified.Exact {
+		modified = time.Time{}
+	}
+
+	if notModified(req, etag, modified) {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	header.Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	if _, err = w.Write(data); err != nil {
+		r.logger.Error("writing response error: ", zap.Error(err))
+	}
+}
+
+// notModified evaluates If-None-Match, or If-Modified-Since when there is
+// none, as RFC 9110 section 13.2.2 orders them. A zero lastModified never
+// matches.
+func notModified(r *http.Request, etag string, lastModified time.Time) bool {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		for _, tag := range strings.Split(inm, ",") {
+			tag = strings.TrimSpace(tag)
+			// If-None-Match uses the weak comparison
+			if tag == "*" || strings.TrimPrefix(tag, "W/") == etag {
+				return true
+			}
+		}
+		return false
+	}
+
+	if lastModified.IsZero() {
+		return false
+	}
+	since, err := http.ParseTime(r.Header.Get("If-Modified-Since"))
+	if err != nil {
+		return false
+	}
+	return !lastModified.After(since)
+}
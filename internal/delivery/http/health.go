@@ -0,0 +1,29 @@
+package http
+
+import (
+	"net/http"
+	"template/pkg/breaker"
+)
+
+type health struct {
+	Status   string           `json:"status"`
+	Breakers []breaker.Status `json:"breakers"`
+}
+
+// HealthHandler reports the state of the circuit breakers. The service is
+// "degraded" while any of them is not closed, it still answers 200 since
+// it keeps serving what it can.
+func HealthHandler(responder Responder, breakers ...*breaker.Breaker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		res := health{Status: "ok", Breakers: make([]breaker.Status, 0, len(breakers))}
+		for _, b := range breakers {
+			status := b.Status()
+			if status.State != breaker.Closed.String() {
+				res.Status = "degraded"
+			}
+			res.Breakers = append(res.Breakers, status)
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		responder.WithOK(w, res)
+	}
+}
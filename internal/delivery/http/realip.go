@@ -0,0 +1,91 @@
+package http
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// TrustedProxies are the networks of the reverse proxies in front of the
+// service, the only peers whose forwarding headers are believed.
+type TrustedProxies []*net.IPNet
+
+// ParseTrustedProxies accepts CIDRs and single addresses.
+func ParseTrustedProxies(addrs []string) (TrustedProxies, error) {
+	res := make(TrustedProxies, 0, len(addrs))
+	for _, addr := range addrs {
+		addr = strings.TrimSpace(addr)
+		if !strings.Contains(addr, "/") {
+			ip := net.ParseIP(addr)
+			if ip == nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q", addr)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				bits = 8 * net.IPv4len
+			}
+			res = append(res, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+
+		_, network, err := net.ParseCIDR(addr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", addr, err)
+		}
+		res = append(res, network)
+	}
+	return res, nil
+}
+
+func (p TrustedProxies) contains(ip net.IP) bool {
+	for _, network := range p {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// RealIP replaces the remote address of requests forwarded by a trusted
+// proxy with the client address. X-Forwarded-For is read from the right,
+// skipping trusted proxies, so addresses prepended by the client are never
+// taken. Requests from any other peer keep their remote address, their
+// headers could say anything.
+func RealIP(proxies TrustedProxies) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host, port, err := net.SplitHostPort(r.RemoteAddr)
+			if err != nil {
+				host = r.RemoteAddr
+			}
+			if peer := net.ParseIP(host); peer != nil && proxies.contains(peer) {
+				if client := proxies.forwardedFor(r.Header); client != nil {
+					r.RemoteAddr = net.JoinHostPort(client.String(), port)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (p TrustedProxies) forwardedFor(header http.Header) net.IP {
+	var hops []string
+	for _, value := range header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(value, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		ip := net.ParseIP(strings.TrimSpace(hops[i]))
+		if ip == nil {
+			return nil
+		}
+		if !p.contains(ip) {
+			return ip
+		}
+	}
+
+	if len(hops) == 0 {
+		return net.ParseIP(strings.TrimSpace(header.Get("X-Real-IP")))
+	}
+	return nil
+}
@@ -10,7 +10,8 @@ import (
 )
 
 type responder struct {
-	logger *zap.Logger
+	logger        *zap.Logger
+	cachePolicies map[string]CachePolicy
 }
 
 type Responder interface {
@@ -23,12 +24,17 @@ type Responder interface {
 	WithUnauthorizedError(w http.ResponseWriter) string
 	WithForbiddenError(w http.ResponseWriter) string //uuid
 	WithTooManyRequests(w http.ResponseWriter) string
+	WithServiceUnavailable(w http.ResponseWriter) string
 	WriteResponse(w http.ResponseWriter, v interface{}, statusCode int)
+	WithConditionalOK(w http.ResponseWriter, r *http.Request, route string, v interface{}, lastModified LastModified)
 }
 
-func NewResponder(logger *zap.Logger) *responder {
+// NewResponder takes the Cache-Control policies of the routes answered
+// with WithConditionalOK, keyed by route name.
+func NewResponder(logger *zap.Logger, cachePolicies map[string]CachePolicy) *responder {
 	return &responder{
-		logger: logger,
+		logger:        logger,
+		cachePolicies: cachePolicies,
 	}
 }
 
@@ -88,6 +94,10 @@ func (r *responder) WithTooManyRequests(w http.ResponseWriter) string {
 	return r.withError(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
 }
 
+func (r *responder) WithServiceUnavailable(w http.ResponseWriter) string {
+	return r.withError(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
 func (r *responder) withError(w http.ResponseWriter, message string, code int) string {
 
 	errorUuid := uuid.New().String()
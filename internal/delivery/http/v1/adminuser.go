@@ -0,0 +1,193 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"template/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const UserParam = "userID"
+
+type UserRoleForm struct {
+	Role *int `json:"role"`
+}
+
+// @Summary List users
+// @Description Search users by username or email prefix, filter by role and status
+// @Tags Admin
+// @Produce json
+// @Param q query string false "Username or email prefix"
+// @Param role query int false "Role"
+// @Param disabled query bool false "Disabled accounts only (true) or active only (false)"
+// @Param page query int false "Page"
+// @Param limit query int false "Page size, at most 100"
+// @Success 200 {object} entity.PaginatedUsers
+// @Failure 400 {string} Invalid input "Invalid input"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/users [get]
+func (h *Handler) ListUsers(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	query := r.URL.Query()
+	users, err := h.userService.ListUsers(ctx, query.Get("q"), query.Get("role"), query.Get("disabled"), query.Get("page"), query.Get("limit"), identityFromContext(ctx).UserID)
+	if err != nil {
+		h.adminUserError(w, err)
+		return
+	}
+	h.responder.WithOK(w, users)
+}
+
+// @Summary Get user
+// @Description Get a user by ID
+// @Tags Admin
+// @Produce json
+// @Param userID path string true "User ID"
+// @Success 200 {object} entity.User
+// @Failure 404 {string} user not found "User not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/users/{userID} [get]
+func (h *Handler) GetUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := h.userService.GetUser(ctx, chi.URLParam(r, UserParam), identityFromContext(ctx).UserID)
+	if err != nil {
+		h.adminUserError(w, err)
+		return
+	}
+	h.responder.WithOK(w, user)
+}
+
+// @Summary Change role
+// @Description Change the role of a user
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param userID path string true "User ID"
+// @Param role body UserRoleForm true "New role"
+// @Success 200 {object} entity.User
+// @Failure 400 {string} Invalid input "Invalid input"
+// @Failure 403 {string} Forbidden "Own account"
+// @Failure 404 {string} user not found "User not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/users/{userID}/role [put]
+func (h *Handler) SetUserRole(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var form UserRoleForm
+
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	user, err := h.userService.SetUserRole(ctx, chi.URLParam(r, UserParam), &form, identityFromContext(ctx).UserID)
+	if err != nil {
+		h.adminUserError(w, err)
+		return
+	}
+	h.responder.WithOK(w, user)
+}
+
+// @Summary Disable user
+// @Description Disable an account. The user is logged out and cannot log in.
+// @Tags Admin
+// @Produce json
+// @Param userID path string true "User ID"
+// @Success 200 {string} user disabled "Disabled"
+// @Failure 403 {string} Forbidden "Own account"
+// @Failure 404 {string} user not found "User not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/users/{userID}/disable [post]
+func (h *Handler) DisableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, true)
+}
+
+// @Summary Enable user
+// @Description Enable a disabled account
+// @Tags Admin
+// @Produce json
+// @Param userID path string true "User ID"
+// @Success 200 {string} user enabled "Enabled"
+// @Failure 403 {string} Forbidden "Own account"
+// @Failure 404 {string} user not found "User not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/users/{userID}/enable [post]
+func (h *Handler) EnableUser(w http.ResponseWriter, r *http.Request) {
+	h.setUserDisabled(w, r, false)
+}
+
+func (h *Handler) setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	ctx := r.Context()
+	err := h.userService.SetUserDisabled(ctx, chi.URLParam(r, UserParam), disabled, identityFromContext(ctx).UserID)
+	if err != nil {
+		h.adminUserError(w, err)
+		return
+	}
+	if disabled {
+		h.responder.WithOK(w, "user disabled")
+		return
+	}
+	h.responder.WithOK(w, "user enabled")
+}
+
+// @Summary Force password reset
+// @Description Clear the password of a user, log them out and send a reset link
+// @Tags Admin
+// @Produce json
+// @Param userID path string true "User ID"
+// @Success 200 {string} reset link sent "Reset link sent"
+// @Failure 404 {string} user not found "User not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/users/{userID}/password-reset [post]
+func (h *Handler) ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.userService.ForcePasswordReset(ctx, chi.URLParam(r, UserParam), identityFromContext(ctx).UserID)
+	if err != nil {
+		h.adminUserError(w, err)
+		return
+	}
+	h.responder.WithOK(w, "reset link sent")
+}
+
+// @Summary Impersonate user
+// @Description Issue a short-lived access token to act as a user. The token carries the admin in the act claim, cannot be refreshed and cannot change the user's credentials. Admins cannot be impersonated.
+// @Tags Admin
+// @Produce json
+// @Param userID path string true "User ID"
+// @Success 200 {object} entity.ImpersonationToken
+// @Failure 400 {string} Invalid input "Own account"
+// @Failure 403 {string} Forbidden "Target is an admin or disabled"
+// @Failure 404 {string} user not found "User not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/users/{userID}/impersonate [post]
+func (h *Handler) ImpersonateUser(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	token, err := h.userService.ImpersonateUser(ctx, chi.URLParam(r, UserParam), identityFromContext(ctx).UserID)
+	if err != nil {
+		h.adminUserError(w, err)
+		return
+	}
+	h.responder.WithOK(w, token)
+}
+
+func (h *Handler) adminUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, utils.ErrUserNotFound), errors.Is(err, utils.ErrNotExist):
+		h.responder.WithNotFound(w, "user not found")
+	case errors.Is(err, utils.ErrBadInput):
+		h.responder.WithBadRequest(w, err.Error())
+	case errors.Is(err, utils.ErrForbidden), errors.Is(err, utils.ErrAccountDisabled):
+		h.responder.With(http.StatusForbidden, w, err.Error())
+	default:
+		h.logger.Error(err.Error())
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+	}
+}
@@ -0,0 +1,99 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"template/internal/utils"
+	"template/pkg/validator"
+	"time"
+)
+
+const APIKeyParam = "apiKeyID"
+
+type APIKeyInputForm struct {
+	Name                string     `json:"name"`
+	Scopes              []string   `json:"scopes"`
+	ExpiresAt           *time.Time `json:"expires_at,omitempty"`
+	validator.Validator `json:"-"`
+}
+
+// @Summary Create API key
+// @Description Create an API key for a service client. The key is only returned once.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param key body APIKeyInputForm true "API key form"
+// @Success 201 {object} entity.APIKeyCreated
+// @Failure 400 {object} entity.APIKeyFormError "Invalid input"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/api-keys [post]
+func (h *Handler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var form APIKeyInputForm
+
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	key, err := h.apiKeyService.CreateAPIKey(ctx, &form, identityFromContext(ctx).UserID)
+	if err != nil {
+		if errors.Is(err, utils.InvalidForm) {
+			h.responder.WriteResponse(w, form.APIKeyErrors, http.StatusBadRequest)
+			return
+		}
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithCreated(w, key)
+}
+
+// @Summary List API keys
+// @Description List all API keys, including revoked and expired ones
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} []entity.APIKey
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/api-keys [get]
+func (h *Handler) ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := h.apiKeyService.ListAPIKeys(r.Context())
+	if err != nil {
+		h.responder.WithInternalError(w, err.Error())
+		return
+	}
+	h.responder.WithOK(w, keys)
+}
+
+// @Summary Revoke API key
+// @Description Revoke an API key by its ID
+// @Tags Admin
+// @Produce json
+// @Param apiKeyID path string true "API key ID"
+// @Success 200 {string} api key successfully revoked "API key revoked"
+// @Failure 404 {string} api key not found "API key not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/api-keys/{apiKeyID} [delete]
+func (h *Handler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	idParam := chi.URLParam(r, APIKeyParam)
+	if idParam == "" {
+		h.responder.WithBadRequest(w, "empty id param")
+		return
+	}
+
+	err := h.apiKeyService.RevokeAPIKey(r.Context(), idParam)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotExist) {
+			h.responder.WithNotFound(w, "api key not found")
+			return
+		}
+		h.responder.WithInternalError(w, err.Error())
+		return
+	}
+	h.responder.WithOK(w, "api key successfully revoked")
+}
@@ -1,18 +1,29 @@
 package v1
 
 import (
-	"context"
 	"encoding/json"
 	"errors"
 	"github.com/go-chi/chi/v5"
 	"net/http"
+	httpResp "template/internal/delivery/http"
 	"template/internal/entity"
 	"template/internal/utils"
 	"template/pkg/validator"
+	"time"
 )
 
 const BookParam = "bookISBN"
 
+// staleHeader marks books served from the cache while the database is
+// unavailable.
+const staleHeader = "X-Cache-Stale"
+
+// Routes with a Cache-Control policy, as named in app.http_cache.
+const (
+	cacheRouteBook     = "book"
+	cacheRouteBookList = "book_list"
+)
+
 type BookInputForm struct {
 	ISBN                string   `json:"isbn,omitempty" bson:"_id"`
 	Title               string   `json:"title" bson:"title"`
@@ -30,7 +41,9 @@ type BookInputForm struct {
 // @Success 201 {string} book successfully created "Book created"
 // @Failure 400 {object} entity.BookFormError "Invalid input"
 // @Failure 500 {string} Internal server error "Internal server error"
+// @Failure 503 {string} Service unavailable "Database unavailable"
 // @Security Bearer
+// @Security ApiKey
 // @Router /api/v1/book [post]
 func (h *Handler) CreateBook(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -52,6 +65,10 @@ func (h *Handler) CreateBook(w http.ResponseWriter, r *http.Request) {
 			h.responder.WithBadRequest(w, err.Error())
 			return
 		}
+		if errors.Is(err, utils.ErrUnavailable) {
+			h.responder.WithServiceUnavailable(w)
+			return
+		}
 		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
 		return
 	}
@@ -65,10 +82,14 @@ func (h *Handler) CreateBook(w http.ResponseWriter, r *http.Request) {
 // @Produce json
 // @Param page query int false "Page number"
 // @Param limit query int false "Number of items per page"
+// @Param If-None-Match header string false "ETag of a cached page"
 // @Success 200 {object} []entity.Book
+// @Success 304 "Not modified"
 // @Failure 400 {string} Invalid query parameters "Invalid query parameters"
 // @Failure 500 {string} Internal server error "Internal server error"
+// @Failure 503 {string} Service unavailable "Database unavailable"
 // @Security Bearer
+// @Security ApiKey
 // @Router /api/v1/book [get]
 func (h *Handler) ListBook(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -81,11 +102,25 @@ func (h *Handler) ListBook(w http.ResponseWriter, r *http.Request) {
 			h.responder.WithBadRequest(w, err.Error())
 			return
 		}
+		if errors.Is(err, utils.ErrUnavailable) {
+			h.responder.WithServiceUnavailable(w)
+			return
+		}
 		h.responder.WithInternalError(w, err.Error())
 		return
 	}
 
-	h.responder.WithOK(w, books)
+	if books.Stale {
+		w.Header().Set(staleHeader, "true")
+	}
+	// the newest book misses deletions shifting the page
+	var modified time.Time
+	for _, book := range books.Books {
+		if t := bookModified(book); t.After(modified) {
+			modified = t
+		}
+	}
+	h.responder.WithConditionalOK(w, r, cacheRouteBookList, books, httpResp.LastModified{Time: modified})
 }
 
 // @Summary Get Book by ISBN
@@ -94,10 +129,15 @@ func (h *Handler) ListBook(w http.ResponseWriter, r *http.Request) {
 // @Accept json
 // @Produce json
 // @Param bookISBN path string true "Book ISBN"
+// @Param If-None-Match header string false "ETag of the cached book"
+// @Param If-Modified-Since header string false "Last-Modified of the cached book"
 // @Success 200 {object} entity.Book
+// @Success 304 "Not modified"
 // @Failure 404 {string} Book not found "Book not found"
 // @Failure 500 {string} Internal server error "Internal server error"
+// @Failure 503 {string} Service unavailable "Database unavailable"
 // @Security Bearer
+// @Security ApiKey
 // @Router /api/v1/book/{bookISBN} [get]
 func (h *Handler) GetBookByISBN(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -112,18 +152,25 @@ func (h *Handler) GetBookByISBN(w http.ResponseWriter, r *http.Request) {
 			h.responder.WithNotFound(w, "book not found")
 			return
 		}
+		if errors.Is(err, utils.ErrUnavailable) {
+			h.responder.WithServiceUnavailable(w)
+			return
+		}
 		h.responder.WithInternalError(w, err.Error())
 		return
 	}
 
-	v, ok := ctx.Value(BookParam).(*entity.Book)
-	if !ok {
-		h.responder.WithInternalError(w, "cannot convert to book")
-		return
+	if book.Stale {
+		w.Header().Set(staleHeader, "true")
+	}
+	h.responder.WithConditionalOK(w, r, cacheRouteBook, book, httpResp.LastModified{Time: bookModified(book), Exact: true})
+}
+
+func bookModified(book *entity.Book) time.Time {
+	if !book.UpdatedAt.IsZero() {
+		return book.UpdatedAt
 	}
-	*v = *book
-	_ = v
-	h.responder.WithOK(w, book)
+	return book.CreatedAt
 }
 
 // @Summary Update Book by ISBN
@@ -137,7 +184,9 @@ func (h *Handler) GetBookByISBN(w http.ResponseWriter, r *http.Request) {
 // @Failure 400 {object} entity.BookFormError "Invalid input"
 // @Failure 404 {string} book not found "Book not found"
 // @Failure 500 {string} Internal server error "Internal server error"
+// @Failure 503 {string} Service unavailable "Database unavailable"
 // @Security Bearer
+// @Security ApiKey
 // @Router /api/v1/book/{bookISBN} [put]
 func (h *Handler) UpdateBookByISBN(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -154,21 +203,19 @@ func (h *Handler) UpdateBookByISBN(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	form.ISBN = idParam
-	book, err := h.booksService.UpdateBookByISBN(ctx, &form)
+	_, err = h.booksService.UpdateBookByISBN(ctx, &form)
 	if err != nil {
 		if errors.Is(err, utils.ErrNotExist) {
 			h.responder.WithNotFound(w, "book not found")
 			return
 		}
-
-	}
-	v, ok := ctx.Value(BookParam).(*entity.BookFormUpdate)
-	if !ok {
-		h.responder.WithInternalError(w, "cannot convert to book")
+		if errors.Is(err, utils.ErrUnavailable) {
+			h.responder.WithServiceUnavailable(w)
+			return
+		}
+		h.responder.WithInternalError(w, err.Error())
 		return
 	}
-	*v = *book
-	_ = v
 	h.responder.WithOK(w, "book updated successfully")
 }
 
@@ -181,7 +228,9 @@ func (h *Handler) UpdateBookByISBN(w http.ResponseWriter, r *http.Request) {
 // @Success 204 {string} book successfully deleted "Book deleted"
 // @Failure 404 {string} book not found "Book not found"
 // @Failure 500 {string} Internal server error "Internal server error"
+// @Failure 503 {string} Service unavailable "Database unavailable"
 // @Security Bearer
+// @Security ApiKey
 // @Router /api/v1/book/{bookISBN} [delete]
 func (h *Handler) DeleteBookByISBN(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
@@ -196,9 +245,12 @@ func (h *Handler) DeleteBookByISBN(w http.ResponseWriter, r *http.Request) {
 			h.responder.WithNotFound(w, "book not found")
 			return
 		}
+		if errors.Is(err, utils.ErrUnavailable) {
+			h.responder.WithServiceUnavailable(w)
+			return
+		}
 		h.responder.WithInternalError(w, err.Error())
 		return
 	}
-	ctx = context.WithValue(ctx, BookParam, idParam)
 	h.responder.WithOK(w, "book successfully deleted")
 }
@@ -0,0 +1,158 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"template/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// CacheWarmForm picks the books to pre-warm the cache with: the most read
+// ("popular") or the most recently updated ("recent") ones.
+type CacheWarmForm struct {
+	By    string `json:"by"`
+	Limit int    `json:"limit,omitempty"`
+}
+
+type CacheCountResponse struct {
+	Count int `json:"count"`
+}
+
+// @Summary Book cache statistics
+// @Description Hit/miss counts per operation since this replica started, key count and memory estimate
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} entity.CacheStats "Cache statistics"
+// @Failure 404 {string} Cache is disabled "Not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/cache/stats [get]
+func (h *Handler) CacheStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.booksService.CacheStats(r.Context())
+	if err != nil {
+		h.bookCacheError(w, err)
+		return
+	}
+	h.responder.WithOK(w, stats)
+}
+
+// @Summary Evict a cached book
+// @Description Remove one book from the cache, the next read goes to the database
+// @Tags Admin
+// @Produce json
+// @Param bookISBN path string true "Book ISBN"
+// @Success 200 {string} successfully evicted "Evicted"
+// @Failure 404 {string} Cache is disabled "Not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/cache/books/{bookISBN} [delete]
+func (h *Handler) EvictCachedBook(w http.ResponseWriter, r *http.Request) {
+	err := h.booksService.EvictCachedBook(r.Context(), chi.URLParam(r, BookParam))
+	if err != nil {
+		h.bookCacheError(w, err)
+		return
+	}
+	h.responder.WithOK(w, "successfully evicted")
+}
+
+// @Summary Flush the book cache
+// @Description Delete every cached book and page, other cached data is kept
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} CacheCountResponse "Number of books deleted"
+// @Failure 404 {string} Cache is disabled "Not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/cache/flush [post]
+func (h *Handler) FlushCache(w http.ResponseWriter, r *http.Request) {
+	flushed, err := h.booksService.FlushCache(r.Context())
+	if err != nil {
+		h.bookCacheError(w, err)
+		return
+	}
+	h.responder.WithOK(w, CacheCountResponse{Count: flushed})
+}
+
+// @Summary Pre-warm the book cache
+// @Description Cache the most read or the most recently updated books (limit defaults to 100, at most 1000)
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param warm body CacheWarmForm true "Books to cache"
+// @Success 200 {object} CacheCountResponse "Number of books cached"
+// @Failure 400 {string} Invalid input "Invalid input"
+// @Failure 404 {string} Cache is disabled "Not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/cache/warm [post]
+func (h *Handler) WarmCache(w http.ResponseWriter, r *http.Request) {
+	var form CacheWarmForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	warmed, err := h.booksService.WarmCache(r.Context(), &form)
+	if err != nil {
+		h.bookCacheError(w, err)
+		return
+	}
+	h.responder.WithOK(w, CacheCountResponse{Count: warmed})
+}
+
+// @Summary Check the book cache against the database
+// @Description Compare every cached book with the database and count the drift: missing (listed but expired), stale (differs from the database) and orphaned (deleted from the database). With repair=true drifting entries are evicted
+// @Tags Admin
+// @Produce json
+// @Param repair query bool false "Evict drifting entries"
+// @Success 200 {object} entity.ConsistencyReport "Consistency report"
+// @Failure 404 {string} Cache is disabled "Not found"
+// @Failure 409 {string} A check is already running "Conflict"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/cache/consistency [post]
+func (h *Handler) CheckCacheConsistency(w http.ResponseWriter, r *http.Request) {
+	repair := r.URL.Query().Get("repair") == "true"
+	report, err := h.booksService.CheckCacheConsistency(r.Context(), repair)
+	if err != nil {
+		h.bookCacheError(w, err)
+		return
+	}
+	h.responder.WithOK(w, report)
+}
+
+// @Summary Last book cache consistency check
+// @Description Report of the latest check run by this replica, scheduled or not
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} entity.ConsistencyReport "Consistency report"
+// @Failure 404 {string} No check has run "Not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/cache/consistency [get]
+func (h *Handler) LastCacheConsistencyCheck(w http.ResponseWriter, r *http.Request) {
+	report, err := h.booksService.LastCacheConsistencyCheck()
+	if err != nil {
+		h.bookCacheError(w, err)
+		return
+	}
+	h.responder.WithOK(w, report)
+}
+
+func (h *Handler) bookCacheError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, utils.ErrCacheDisabled), errors.Is(err, utils.ErrNotExist):
+		h.responder.WithNotFound(w, err.Error())
+	case errors.Is(err, utils.ErrCheckRunning):
+		h.responder.With(http.StatusConflict, w, err.Error())
+	case errors.Is(err, utils.ErrBadInput):
+		h.responder.WithBadRequest(w, err.Error())
+	case errors.Is(err, utils.ErrUnavailable):
+		h.responder.WithServiceUnavailable(w)
+	default:
+		h.logger.Error(err.Error())
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+	}
+}
@@ -0,0 +1,82 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"template/internal/utils"
+)
+
+type EmailVerifyForm struct {
+	Token string `json:"token"`
+}
+
+// @Summary Verify email
+// @Description Confirm the email address with the token from the verification link
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param verify body EmailVerifyForm true "Verification token"
+// @Success 200 {string} email verified "Verified"
+// @Failure 400 {string} invalid or expired verification token "Invalid token"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Router /api/v1/user/email/verify [post]
+func (h *Handler) VerifyEmail(w http.ResponseWriter, r *http.Request) {
+	var form EmailVerifyForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if err = h.userService.VerifyEmail(r.Context(), &form); err != nil {
+		if errors.Is(err, utils.ErrInvalidVerifyToken) {
+			h.responder.WithBadRequest(w, err.Error())
+			return
+		}
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithOK(w, "email verified")
+}
+
+// @Summary Resend verification email
+// @Description Send a new verification link to the email of the current user
+// @Tags User
+// @Produce json
+// @Success 200 {string} verification email sent "Sent"
+// @Failure 400 {string} Invalid input "No email address"
+// @Failure 403 {string} Forbidden "Not a user session"
+// @Failure 409 {string} email is already verified "Already verified"
+// @Failure 429 {string} too many requests "Sent too recently, see Retry-After"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/email/verify/resend [post]
+func (h *Handler) ResendVerification(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := identityFromContext(ctx)
+	if id.UserID == "" {
+		h.responder.WithForbiddenError(w)
+		return
+	}
+
+	err := h.userService.ResendVerification(ctx, id.UserID)
+	if err != nil {
+		var limited *utils.LockoutError
+		switch {
+		case errors.As(err, &limited):
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			h.responder.WithTooManyRequests(w)
+		case errors.Is(err, utils.ErrEmailVerified):
+			h.responder.With(http.StatusConflict, w, err.Error())
+		case errors.Is(err, utils.ErrBadInput):
+			h.responder.WithBadRequest(w, err.Error())
+		default:
+			h.profileError(w, err)
+		}
+		return
+	}
+	h.responder.WithOK(w, "verification email sent")
+}
@@ -2,40 +2,116 @@ package v1
 
 import (
 	"github.com/go-chi/chi/v5"
+	"template/internal/entity"
 )
 
 func (h *Handler) setRoutes(router chi.Router) {
 	router.Route("/v1", func(r chi.Router) {
 		r.Route("/user", h.setUserRoutes)
 		r.Route("/book", h.setBooksRoutes)
+		r.Route("/admin", h.setAdminRoutes)
+		r.Route("/scim/v2", h.setScimRoutes)
 	})
 }
 
 func (h *Handler) setUserRoutes(router chi.Router) {
 	router.Post("/signup", h.SignUp)
 	router.Post("/login", h.Login)
+	router.Post("/login/2fa", h.LoginTwoFactor)
+	router.Post("/login/2fa/enroll", h.EnrollTwoFactorWithChallenge)
+	router.Post("/login/2fa/confirm", h.ConfirmTwoFactorWithChallenge)
+	router.Post("/password/forgot", h.ForgotPassword)
+	router.Post("/password/reset", h.ResetPassword)
+	router.Post("/email/verify", h.VerifyEmail)
+	router.Get("/oidc/login", h.OIDCLogin)
+	router.Get("/oidc/callback", h.OIDCCallback)
 
 	router.Group(func(r chi.Router) {
-		r.Use(h.userIdentity)
+		r.Use(h.userIdentity, h.sessionOnly)
 		r.Post("/auth/refresh", h.userRefresh)
+		r.Get("/me", h.GetProfile)
+		r.Post("/email/verify/resend", h.ResendVerification)
+		r.Get("/tokens", h.ListPersonalTokens)
+
+		r.Group(func(r chi.Router) {
+			r.Use(h.noImpersonation)
+			r.Post("/tokens", h.CreatePersonalToken)
+			r.Delete("/tokens/{tokenID}", h.RevokePersonalToken)
+			r.Post("/password", h.ChangePassword)
+			r.Post("/2fa/enroll", h.EnrollTwoFactor)
+			r.Post("/2fa/confirm", h.ConfirmTwoFactor)
+			r.Post("/2fa/disable", h.DisableTwoFactor)
+			r.Patch("/me", h.UpdateProfile)
+			r.Delete("/me", h.CloseAccount)
+		})
 	})
 }
 
 func (h *Handler) setBooksRoutes(router chi.Router) {
 	router.Group(func(r chi.Router) {
-		r.Use(h.adminIdentity)
+		r.Use(h.adminOrScope(entity.ScopeCatalogWrite))
 
 		r.Post("/", h.CreateBook)
-		r.With(h.DeleteBookFromCache).Delete("/{bookISBN}", h.DeleteBookByISBN)
-		r.With(h.UpdateBookInCache).Put("/{bookISBN}", h.UpdateBookByISBN)
+		r.Delete("/{bookISBN}", h.DeleteBookByISBN)
+		r.Put("/{bookISBN}", h.UpdateBookByISBN)
 
 	})
 	router.Group(func(r chi.Router) {
-		r.Use(h.userIdentity)
+		if h.publicCatalog {
+			r.Use(h.optionalIdentity)
+		} else {
+			r.Use(h.userIdentity)
+		}
+		r.Use(h.requireScope(entity.ScopeCatalogRead))
 
 		r.Get("/", h.ListBook)
-		r.With(h.FindBookInCache).Get("/{bookISBN}", h.GetBookByISBN)
+		r.Get("/{bookISBN}", h.GetBookByISBN)
+
+	})
+
+}
+
+func (h *Handler) setAdminRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(h.adminIdentity)
 
+		r.Post("/api-keys", h.CreateAPIKey)
+		r.Get("/api-keys", h.ListAPIKeys)
+		r.Delete("/api-keys/{apiKeyID}", h.RevokeAPIKey)
+
+		r.Post("/lockouts/unlock", h.Unlock)
+
+		r.Get("/2fa/policy", h.GetTwoFactorPolicy)
+		r.Put("/2fa/policy", h.SetTwoFactorPolicy)
+
+		r.Get("/users", h.ListUsers)
+		r.Get("/users/{userID}", h.GetUser)
+		r.Put("/users/{userID}/role", h.SetUserRole)
+		r.Post("/users/{userID}/disable", h.DisableUser)
+		r.Post("/users/{userID}/enable", h.EnableUser)
+		r.Post("/users/{userID}/password-reset", h.ForcePasswordReset)
+		r.Post("/users/{userID}/impersonate", h.ImpersonateUser)
+
+		r.Get("/cache/stats", h.CacheStats)
+		r.Delete("/cache/books/{bookISBN}", h.EvictCachedBook)
+		r.Post("/cache/flush", h.FlushCache)
+		r.Post("/cache/warm", h.WarmCache)
+		r.Get("/cache/consistency", h.LastCacheConsistencyCheck)
+		r.Post("/cache/consistency", h.CheckCacheConsistency)
 	})
+}
 
+func (h *Handler) setScimRoutes(router chi.Router) {
+	router.Group(func(r chi.Router) {
+		r.Use(h.scimIdentity)
+
+		r.Get("/Users", h.ScimListUsers)
+		r.Post("/Users", h.ScimCreateUser)
+		r.Get("/Users/{scimUserID}", h.ScimGetUser)
+		r.Patch("/Users/{scimUserID}", h.ScimPatchUser)
+
+		r.Get("/Groups", h.ScimListGroups)
+		r.Get("/Groups/{scimGroupID}", h.ScimGetGroup)
+		r.Patch("/Groups/{scimGroupID}", h.ScimPatchGroup)
+	})
 }
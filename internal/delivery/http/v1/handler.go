@@ -15,8 +15,15 @@ type Handler struct {
 	logger       *zap.Logger
 	userService  userService
 	booksService bookService
-	cache        redisInterface
 	tokenManager auth.TokenManager
+
+	apiKeyService  apiKeyService
+	lockoutService lockoutService
+	oidcService    oidcService
+	scimService    scimService
+
+	// publicCatalog lets anonymous callers read books
+	publicCatalog bool
 }
 
 func NewHandler(
@@ -24,16 +31,24 @@ func NewHandler(
 	logger *zap.Logger,
 	userService userService,
 	booksService bookService,
-	cache redisInterface,
 	manager auth.TokenManager,
+	apiKeyService apiKeyService,
+	lockoutService lockoutService,
+	oidcService oidcService,
+	scimService scimService,
+	publicCatalog bool,
 ) *Handler {
 	return &Handler{
-		responder:    responder,
-		logger:       logger,
-		userService:  userService,
-		booksService: booksService,
-		cache:        cache,
-		tokenManager: manager,
+		responder:      responder,
+		logger:         logger,
+		userService:    userService,
+		booksService:   booksService,
+		tokenManager:   manager,
+		apiKeyService:  apiKeyService,
+		lockoutService: lockoutService,
+		oidcService:    oidcService,
+		scimService:    scimService,
+		publicCatalog:  publicCatalog,
 	}
 }
 
@@ -43,11 +58,16 @@ func SetHandler(
 	logger *zap.Logger,
 	userService userService,
 	booksService bookService,
-	cache redisInterface,
 	manager auth.TokenManager,
+	apiKeyService apiKeyService,
+	lockoutService lockoutService,
+	oidcService oidcService,
+	scimService scimService,
+	publicCatalog bool,
 ) {
-	handler := NewHandler(responder, logger, userService, booksService, cache, manager)
+	handler := NewHandler(responder, logger, userService, booksService, manager, apiKeyService, lockoutService, oidcService, scimService, publicCatalog)
 	mux.Route("/api", handler.setRoutes)
+	mux.Get("/.well-known/jwks.json", handler.JWKS)
 	mux.Get("/swagger/*", httpSwagger.Handler(
 		httpSwagger.URL("/swagger/doc.json"),
 	))
@@ -6,10 +6,32 @@ import (
 )
 
 type userService interface {
-	Login(ctx context.Context, input *UserLoginForm) (entity.Tokens, error)
+	Login(ctx context.Context, input *UserLoginForm) (*entity.LoginResult, error)
 	SignUp(ctx context.Context, form *UserSignupForm) (interface{}, error)
-	GetUserByID(id string) (*entity.User, error)
-	RefreshTokens(ctx context.Context, refreshToken string) (entity.Tokens, error)
+	GetUserByID(ctx context.Context, id string) (*entity.User, error)
+	RefreshTokens(ctx context.Context, userID, refreshToken string) (entity.Tokens, error)
+	ChangePassword(ctx context.Context, userID string, form *PasswordChangeForm) (entity.Tokens, error)
+	ForgotPassword(ctx context.Context, form *PasswordForgotForm) error
+	ResetPassword(ctx context.Context, form *PasswordResetForm) error
+	LoginTwoFactor(ctx context.Context, form *TwoFactorLoginForm) (entity.Tokens, error)
+	EnrollTwoFactor(ctx context.Context, userID string) (*entity.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, userID string, form *TwoFactorCodeForm) (*entity.RecoveryCodes, error)
+	DisableTwoFactor(ctx context.Context, userID string, form *TwoFactorCodeForm) error
+	EnrollTwoFactorWithChallenge(ctx context.Context, form *TwoFactorChallengeForm) (*entity.TwoFactorEnrollment, error)
+	ConfirmTwoFactorWithChallenge(ctx context.Context, form *TwoFactorLoginForm) (*entity.TwoFactorLogin, error)
+	GetTwoFactorPolicy(ctx context.Context) (*entity.TwoFactorPolicy, error)
+	SetTwoFactorPolicy(ctx context.Context, form *TwoFactorPolicyForm, actorID string) (*entity.TwoFactorPolicy, error)
+	GetProfile(ctx context.Context, userID string) (*entity.User, error)
+	UpdateProfile(ctx context.Context, userID string, form *ProfileUpdateForm) (*entity.User, error)
+	CloseAccount(ctx context.Context, userID string) error
+	VerifyEmail(ctx context.Context, form *EmailVerifyForm) error
+	ResendVerification(ctx context.Context, userID string) error
+	ListUsers(ctx context.Context, query, role, disabled, page, limit, actorID string) (*entity.PaginatedUsers, error)
+	GetUser(ctx context.Context, id, actorID string) (*entity.User, error)
+	SetUserRole(ctx context.Context, id string, form *UserRoleForm, actorID string) (*entity.User, error)
+	SetUserDisabled(ctx context.Context, id string, disabled bool, actorID string) error
+	ForcePasswordReset(ctx context.Context, id string, actorID string) error
+	ImpersonateUser(ctx context.Context, id string, actorID string) (*entity.ImpersonationToken, error)
 }
 
 type bookService interface {
@@ -18,11 +40,40 @@ type bookService interface {
 	UpdateBookByISBN(ctx context.Context, book *BookInputForm) (*entity.BookFormUpdate, error)
 	DeleteBookByISBN(ctx context.Context, id string) error
 	CreateBook(ctx context.Context, book *BookInputForm) (interface{}, error)
+	CacheStats(ctx context.Context) (*entity.CacheStats, error)
+	EvictCachedBook(ctx context.Context, id string) error
+	FlushCache(ctx context.Context) (int, error)
+	WarmCache(ctx context.Context, form *CacheWarmForm) (int, error)
+	CheckCacheConsistency(ctx context.Context, repair bool) (*entity.ConsistencyReport, error)
+	LastCacheConsistencyCheck() (*entity.ConsistencyReport, error)
 }
 
-type redisInterface interface {
-	InsertBook(ctx context.Context, book *entity.Book) error
-	FindBookByISBN(ctx context.Context, id string) (*entity.Book, error)
-	DeleteBookByISBN(ctx context.Context, id string) error
-	UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error
+type apiKeyService interface {
+	CreateAPIKey(ctx context.Context, form *APIKeyInputForm, createdBy string) (*entity.APIKeyCreated, error)
+	ListAPIKeys(ctx context.Context) ([]*entity.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	Authenticate(ctx context.Context, key string) (*entity.APIKey, error)
+	CreatePersonalToken(ctx context.Context, form *APIKeyInputForm, userID string) (*entity.APIKeyCreated, error)
+	ListPersonalTokens(ctx context.Context, userID string) ([]*entity.APIKey, error)
+	RevokePersonalToken(ctx context.Context, id, userID string) error
+}
+
+type lockoutService interface {
+	Unlock(ctx context.Context, form *UnlockInputForm, actorID string) error
+}
+
+type oidcService interface {
+	AuthCodeURL(ctx context.Context) (string, string, error)
+	Exchange(ctx context.Context, state, code string) (*entity.LoginResult, error)
+}
+
+type scimService interface {
+	Authenticate(token string) error
+	ListUsers(ctx context.Context, filter, startIndex, count string) (*entity.ScimListResponse, error)
+	GetUser(ctx context.Context, id string) (*entity.ScimUser, error)
+	CreateUser(ctx context.Context, form *ScimUserForm) (*entity.ScimUser, error)
+	PatchUser(ctx context.Context, id string, form *ScimPatchForm) (*entity.ScimUser, error)
+	ListGroups(ctx context.Context, filter, attributes string) (*entity.ScimListResponse, error)
+	GetGroup(ctx context.Context, id, attributes, startIndex, count string) (*entity.ScimGroup, error)
+	PatchGroup(ctx context.Context, id string, form *ScimPatchForm) error
 }
@@ -0,0 +1,16 @@
+package v1
+
+import (
+	"net/http"
+)
+
+// @Summary JSON Web Key Set
+// @Description Public keys used to verify access tokens issued by this service
+// @Tags Auth
+// @Produce json
+// @Success 200 {object} auth.JWKS
+// @Router /.well-known/jwks.json [get]
+func (h *Handler) JWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	h.responder.WithOK(w, h.tokenManager.JWKS())
+}
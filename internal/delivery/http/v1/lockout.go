@@ -0,0 +1,46 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"template/internal/utils"
+)
+
+type UnlockInputForm struct {
+	Username string `json:"username,omitempty"`
+	IP       string `json:"ip,omitempty"`
+}
+
+// @Summary Unlock login
+// @Description Lift a login lockout for a username and/or a client IP
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param unlock body UnlockInputForm true "Username and/or IP to unlock"
+// @Success 200 {string} successfully unlocked "Unlocked"
+// @Failure 400 {string} Invalid input "Invalid input"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/lockouts/unlock [post]
+func (h *Handler) Unlock(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var form UnlockInputForm
+
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	err = h.lockoutService.Unlock(ctx, &form, identityFromContext(ctx).UserID)
+	if err != nil {
+		if errors.Is(err, utils.ErrBadInput) {
+			h.responder.WithBadRequest(w, err.Error())
+			return
+		}
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithOK(w, "successfully unlocked")
+}
@@ -3,141 +3,293 @@ package v1
 import (
 	"context"
 	"errors"
-	"fmt"
-	"github.com/go-chi/chi/v5"
+	"net"
 	"net/http"
 	"strings"
 	"template/internal/entity"
 	"template/internal/utils"
+	"time"
+
+	"go.uber.org/zap"
 )
 
 const (
 	authorizationHeader = "Authorization"
+	apiKeyHeader        = "X-API-Key"
 	userCtx             = "userId"
+	actorCtx            = "actorId"
+	identityCtx         = "identity"
 )
 
-func (h *Handler) FindBookInCache(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
-		bookISBN := chi.URLParam(r, BookParam)
-		bookISBN = strings.TrimSpace(bookISBN)
-		book, err := h.cache.FindBookByISBN(ctx, bookISBN)
+// identity is the authenticated caller: a user session, an API key, or a
+// personal access token, which sets both UserID and APIKeyID. Scopes is
+// nil for user sessions, which are limited by role only.
+// Role comes from the access token and may be stale, see authorizeAdmin.
+// ActorID is set when an admin impersonates UserID. IssuedAt is the issue
+// time of the access token, zero for API keys.
+type identity struct {
+	UserID   string
+	Role     int
+	ActorID  string
+	APIKeyID string
+	Scopes   []string
+	IssuedAt time.Time
+}
+
+func (i *identity) hasScope(scope string) bool {
+	if i.Scopes == nil {
+		return true
+	}
+	for _, s := range i.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func withIdentity(ctx context.Context, id *identity) context.Context {
+	ctx = context.WithValue(ctx, identityCtx, id)
+	ctx = context.WithValue(ctx, actorCtx, id.ActorID)
+	return context.WithValue(ctx, userCtx, id.UserID)
+}
+
+func identityFromContext(ctx context.Context) *identity {
+	id, ok := ctx.Value(identityCtx).(*identity)
+	if !ok {
+		return &identity{}
+	}
+	return id
+}
 
+func (h *Handler) adminIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := h.parseAuthHeader(r)
 		if err != nil {
-			if errors.Is(err, utils.ErrNotExist) {
-				r = r.WithContext(context.WithValue(r.Context(), BookParam, &entity.Book{}))
-				next.ServeHTTP(w, r)
-				v, ok := r.Context().Value(BookParam).(*entity.Book)
-				if !ok {
-					h.responder.WithInternalError(w, "couldn't convert book to struct")
+			h.responder.WithUnauthorizedError(w)
+			return
+		}
+		if id.APIKeyID != "" {
+			h.responder.WithForbiddenError(w)
+			return
+		}
+		if !h.authorizeAdmin(r.Context(), w, id) {
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
+	})
+}
+
+// adminOrScope lets through admin users and API keys carrying scope.
+func (h *Handler) adminOrScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, err := h.parseAuthHeader(r)
+			if err != nil {
+				h.responder.WithUnauthorizedError(w)
+				return
+			}
+			if id.APIKeyID != "" {
+				if !id.hasScope(scope) {
+					h.responder.WithForbiddenError(w)
 					return
 				}
-				err = h.cache.InsertBook(ctx, v)
-				if err != nil {
-					h.responder.WithInternalError(w, "error inserting book in cache")
+				if id.UserID != "" {
+					if _, ok := h.activeUser(r.Context(), w, id); !ok {
+						return
+					}
 				}
+			} else if !h.authorizeAdmin(r.Context(), w, id) {
 				return
 			}
-			h.responder.WithInternalError(w, fmt.Sprintf("error getting book from cache: %v", err))
-			return
+			next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
+		})
+	}
+}
+
+// authorizeAdmin checks the user behind id is an admin, writing the error
+// response when it is not. Tokens without the admin role claim are turned
+// away without a lookup. The stored role is checked as well, so a demotion
+// takes effect within the user cache TTL rather than the token lifetime.
+func (h *Handler) authorizeAdmin(ctx context.Context, w http.ResponseWriter, id *identity) bool {
+	if id.Role != entity.RoleAdmin {
+		h.responder.WithForbiddenError(w)
+		return false
+	}
+
+	user, ok := h.activeUser(ctx, w, id)
+	if !ok {
+		return false
+	}
+	if user.Role != entity.RoleAdmin {
+		h.responder.WithForbiddenError(w)
+		return false
+	}
+	return true
+}
+
+// activeUser loads the user behind id, writing the error response when the
+// user is gone or disabled, or the access token was issued before the
+// password last changed. The token issue time only has seconds, so tokens
+// issued in the second of the change are still accepted.
+func (h *Handler) activeUser(ctx context.Context, w http.ResponseWriter, id *identity) (*entity.User, bool) {
+	user, err := h.userService.GetUserByID(ctx, id.UserID)
+	if err != nil {
+		if errors.Is(err, utils.ErrUserNotFound) || errors.Is(err, utils.ErrNotExist) {
+			h.responder.WithUnauthorizedError(w)
+			return nil, false
 		}
-		h.responder.WithOK(w, book)
-	})
+		h.responder.WithInternalError(w, "error authorizing user")
+		return nil, false
+	}
+	if user.Disabled {
+		h.responder.With(http.StatusForbidden, w, utils.ErrAccountDisabled.Error())
+		return nil, false
+	}
+	if id.APIKeyID == "" && user.PasswordChangedAt != nil && id.IssuedAt.Before(user.PasswordChangedAt.Truncate(time.Second)) {
+		h.responder.WithUnauthorizedError(w)
+		return nil, false
+	}
+	return user, true
 }
 
-func (h *Handler) UpdateBookInCache(next http.Handler) http.Handler {
+func (h *Handler) userIdentity(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r = r.WithContext(context.WithValue(r.Context(), BookParam, &entity.BookFormCreate{}))
-		next.ServeHTTP(w, r)
-		v, ok := r.Context().Value(BookParam).(*entity.BookFormUpdate)
-		if !ok {
-			h.responder.WithInternalError(w, "couldnt convert book to struct")
+		id, err := h.parseAuthHeader(r)
+		if err != nil {
+			h.responder.With(http.StatusUnauthorized, w, err.Error())
 			return
 		}
-
-		ctx := context.Background()
-		err := h.cache.UpdateBookByISBN(ctx, v)
-		if err != nil {
-			if errors.Is(err, utils.ErrNotExist) {
+		if id.UserID != "" {
+			if _, ok := h.activeUser(r.Context(), w, id); !ok {
 				return
 			}
-			h.responder.WithInternalError(w, fmt.Sprintf("error updating book in cache: %v", err))
 		}
+		if id.ActorID != "" {
+			// the impersonating admin must still be one
+			if !h.authorizeAdmin(r.Context(), w, &identity{UserID: id.ActorID, Role: entity.RoleAdmin, IssuedAt: id.IssuedAt}) {
+				return
+			}
+			h.logger.Info("impersonated request",
+				zap.String("actor", id.ActorID),
+				zap.String("user", id.UserID),
+				zap.String("method", r.Method),
+				zap.String("path", r.URL.Path),
+			)
+		}
+		next.ServeHTTP(w, r.WithContext(withIdentity(r.Context(), id)))
 	})
 }
 
-func (h *Handler) DeleteBookFromCache(next http.Handler) http.Handler {
+// optionalIdentity lets anonymous requests through and authenticates the
+// others like userIdentity, so bad credentials are still rejected.
+func (h *Handler) optionalIdentity(next http.Handler) http.Handler {
+	authenticated := h.userIdentity(next)
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		next.ServeHTTP(w, r)
-		ctx := r.Context()
-		isbn := chi.URLParam(r, BookParam)
-		if isbn == "" {
+		if r.Header.Get(authorizationHeader) == "" && r.Header.Get(apiKeyHeader) == "" {
+			next.ServeHTTP(w, r)
 			return
 		}
-		err := h.cache.DeleteBookByISBN(ctx, isbn)
-		if err != nil {
-			if errors.Is(err, utils.ErrNotExist) {
-				return
-			}
-			h.responder.WithInternalError(w, fmt.Sprintf("error getting book from cache: %v", err))
-		}
+		authenticated.ServeHTTP(w, r)
 	})
 }
 
-func (h *Handler) adminIdentity(next http.Handler) http.Handler {
+// sessionOnly rejects scoped credentials, for routes that act on the
+// account itself rather than on a scoped resource.
+func (h *Handler) sessionOnly(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id, err := h.parseAuthHeader(r)
-		if err != nil {
-			h.responder.WithUnauthorizedError(w)
-			return
-		}
-		fmt.Println(id)
-		user, err := h.userService.GetUserByID(id)
-		if err != nil {
-			if errors.Is(err, utils.ErrUserNotFound) {
-				h.responder.WithUnauthorizedError(w)
-				return
-			}
-			h.responder.WithInternalError(w, "error authorizing user")
-			return
-		}
-		// ----------
-		if user.Role != 1 {
+		if identityFromContext(r.Context()).Scopes != nil {
 			h.responder.WithForbiddenError(w)
 			return
 		}
-		ctx := context.WithValue(r.Context(), userCtx, id)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r)
 	})
 }
 
-func (h *Handler) userIdentity(next http.Handler) http.Handler {
+// noImpersonation keeps impersonated sessions away from actions only the
+// user may take, such as changing credentials.
+func (h *Handler) noImpersonation(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id, err := h.parseAuthHeader(r)
-		if err != nil {
-			h.responder.With(http.StatusUnauthorized, w, err.Error())
+		if identityFromContext(r.Context()).ActorID != "" {
+			h.responder.WithForbiddenError(w)
 			return
 		}
-		ctx := context.WithValue(r.Context(), userCtx, id)
-		next.ServeHTTP(w, r.WithContext(ctx))
+		next.ServeHTTP(w, r)
 	})
 }
 
-func (h *Handler) parseAuthHeader(r *http.Request) (string, error) {
+// requireScope rejects scoped credentials that lack scope. User sessions
+// are not scoped and always pass.
+func (h *Handler) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !identityFromContext(r.Context()).hasScope(scope) {
+				h.responder.WithForbiddenError(w)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// loansRead and holdsWrite are the scope checks of the loan and hold
+// routes, which reading apps reach with personal access tokens.
+func (h *Handler) loansRead(next http.Handler) http.Handler {
+	return h.requireScope(entity.ScopeLoansRead)(next)
+}
+
+func (h *Handler) holdsWrite(next http.Handler) http.Handler {
+	return h.requireScope(entity.ScopeHoldsWrite)(next)
+}
+
+func (h *Handler) parseAuthHeader(r *http.Request) (*identity, error) {
+	if key := r.Header.Get(apiKeyHeader); key != "" {
+		return h.parseAPIKey(r, key)
+	}
+
 	header := r.Header.Get(authorizationHeader)
 	if header == "" {
-		return "", errors.New("empty auth header")
+		return nil, errors.New("empty auth header")
 	}
 
 	headerParts := strings.Split(header, " ")
 	if len(headerParts) != 2 || headerParts[0] != "Bearer" {
-		return "", errors.New("invalid auth header")
+		return nil, errors.New("invalid auth header")
 	}
 
 	if len(headerParts[1]) == 0 {
-		return "", errors.New("token is empty")
+		return nil, errors.New("token is empty")
+	}
+	if strings.HasPrefix(headerParts[1], entity.PersonalTokenPrefix) {
+		return h.parseAPIKey(r, headerParts[1])
+	}
+
+	claims, err := h.tokenManager.Parse(headerParts[1])
+	if err != nil {
+		return nil, err
+	}
+
+	id := &identity{UserID: claims.Subject, Role: claims.Role, IssuedAt: time.Unix(claims.IssuedAt, 0)}
+	if claims.Act != nil {
+		id.ActorID = claims.Act.Subject
+	}
+	return id, nil
+}
+
+// parseAPIKey resolves a service key or a personal access token. The
+// latter acts as its owner, limited to its scopes.
+func (h *Handler) parseAPIKey(r *http.Request, key string) (*identity, error) {
+	apiKey, err := h.apiKeyService.Authenticate(r.Context(), key)
+	if err != nil {
+		return nil, err
 	}
+	return &identity{UserID: apiKey.UserID, APIKeyID: apiKey.ID.Hex(), Scopes: apiKey.Scopes}, nil
+}
 
-	return h.tokenManager.Parse(headerParts[1])
-	// return true false, check admin in db
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
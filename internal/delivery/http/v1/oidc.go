@@ -0,0 +1,94 @@
+package v1
+
+import (
+	"errors"
+	"net/http"
+	"template/internal/utils"
+)
+
+const oidcStateCookie = "oidc_state"
+
+// @Summary SSO login
+// @Description Redirect to the OpenID Connect provider
+// @Tags User
+// @Success 302 {string} redirect "Redirect to the provider"
+// @Failure 404 {string} SSO is disabled "Not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Router /api/v1/user/oidc/login [get]
+func (h *Handler) OIDCLogin(w http.ResponseWriter, r *http.Request) {
+	url, state, err := h.oidcService.AuthCodeURL(r.Context())
+	if err != nil {
+		if errors.Is(err, utils.ErrSSODisabled) {
+			h.responder.WithNotFound(w, err.Error())
+			return
+		}
+		h.logger.Error(err.Error())
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+
+	// binds the callback to the browser that started the login
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    state,
+		Path:     "/api/v1/user/oidc",
+		HttpOnly: true,
+		Secure:   r.TLS != nil,
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// @Summary SSO callback
+// @Description Complete the OpenID Connect login and issue tokens. With two-factor authentication a challenge is returned instead, see /api/v1/user/login/2fa.
+// @Tags User
+// @Produce json
+// @Param state query string true "State"
+// @Param code query string true "Authorization code"
+// @Success 200 {object} entity.Tokens "Tokens"
+// @Success 202 {object} entity.TwoFactorChallenge "Two-factor challenge"
+// @Failure 400 {string} Invalid state "Invalid input"
+// @Failure 404 {string} SSO is disabled "Not found"
+// @Failure 403 {string} account is disabled "Account disabled"
+// @Failure 409 {string} user already exists "Username taken by a local user"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Router /api/v1/user/oidc/callback [get]
+func (h *Handler) OIDCCallback(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	if e := query.Get("error"); e != "" {
+		h.responder.WithBadRequest(w, e)
+		return
+	}
+
+	state := query.Get("state")
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || state == "" || cookie.Value != state {
+		h.responder.WithBadRequest(w, utils.ErrInvalidState.Error())
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: oidcStateCookie, Path: "/api/v1/user/oidc", MaxAge: -1})
+
+	res, err := h.oidcService.Exchange(r.Context(), state, query.Get("code"))
+	if err != nil {
+		switch {
+		case errors.Is(err, utils.ErrSSODisabled):
+			h.responder.WithNotFound(w, err.Error())
+		case errors.Is(err, utils.ErrInvalidState), errors.Is(err, utils.ErrBadInput):
+			h.responder.WithBadRequest(w, err.Error())
+		case errors.Is(err, utils.ErrUserAlreadyExists):
+			h.responder.With(http.StatusConflict, w, err.Error())
+		case errors.Is(err, utils.ErrAccountDisabled):
+			h.responder.With(http.StatusForbidden, w, err.Error())
+		default:
+			h.logger.Error(err.Error())
+			h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		}
+		return
+	}
+
+	if res.Challenge != nil {
+		h.responder.With(http.StatusAccepted, w, res.Challenge)
+		return
+	}
+	h.responder.WithOK(w, res.Tokens)
+}
@@ -0,0 +1,135 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"template/internal/utils"
+	"template/pkg/validator"
+)
+
+type PasswordChangeForm struct {
+	OldPassword         string `json:"old_password"`
+	NewPassword         string `json:"new_password"`
+	validator.Validator `json:"-"`
+}
+
+type PasswordForgotForm struct {
+	Username string `json:"username"`
+	IP       string `json:"-"`
+}
+
+type PasswordResetForm struct {
+	Token               string `json:"token"`
+	NewPassword         string `json:"new_password"`
+	validator.Validator `json:"-"`
+}
+
+// @Summary Change password
+// @Description Change the password of the current user. Other sessions are revoked and a new token pair is returned.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param password body PasswordChangeForm true "Old and new password"
+// @Success 200 {object} entity.Tokens
+// @Failure 400 {object} entity.PasswordFormError "Invalid input"
+// @Failure 403 {string} Forbidden "Not a user session"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/password [post]
+func (h *Handler) ChangePassword(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := identityFromContext(ctx)
+	if id.UserID == "" {
+		h.responder.WithForbiddenError(w)
+		return
+	}
+
+	var form PasswordChangeForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	res, err := h.userService.ChangePassword(ctx, id.UserID, &form)
+	if err != nil {
+		if errors.Is(err, utils.InvalidForm) {
+			h.responder.WriteResponse(w, form.PasswordErrors, http.StatusBadRequest)
+			return
+		}
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithOK(w, res)
+}
+
+// @Summary Forgot password
+// @Description Send a password reset link to the user, if the account exists
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param forgot body PasswordForgotForm true "Username"
+// @Success 200 {string} reset link sent "Reset link sent"
+// @Failure 400 {string} Invalid input "Invalid input"
+// @Failure 429 {string} too many requests "Too many requests, see Retry-After"
+// @Router /api/v1/user/password/forgot [post]
+func (h *Handler) ForgotPassword(w http.ResponseWriter, r *http.Request) {
+	var form PasswordForgotForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil || !validator.NotBlank(form.Username) {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	form.IP = clientIP(r)
+
+	// any other error answers like a success, a failure to send the link
+	// would otherwise tell that the account exists
+	if err = h.userService.ForgotPassword(r.Context(), &form); err != nil {
+		var limited *utils.LockoutError
+		if errors.As(err, &limited) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(limited.RetryAfter.Seconds()))))
+			h.responder.WithTooManyRequests(w)
+			return
+		}
+		h.logger.Error("forgot password: " + err.Error())
+	}
+	h.responder.WithOK(w, "if the account exists, a reset link has been sent")
+}
+
+// @Summary Reset password
+// @Description Set a new password using a reset token. All sessions of the user are revoked.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param reset body PasswordResetForm true "Reset token and new password"
+// @Success 200 {string} password successfully reset "Password reset"
+// @Failure 400 {object} entity.PasswordFormError "Invalid input or token"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Router /api/v1/user/password/reset [post]
+func (h *Handler) ResetPassword(w http.ResponseWriter, r *http.Request) {
+	var form PasswordResetForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	err = h.userService.ResetPassword(r.Context(), &form)
+	if err != nil {
+		if errors.Is(err, utils.InvalidForm) {
+			h.responder.WriteResponse(w, form.PasswordErrors, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, utils.ErrInvalidResetToken) {
+			h.responder.WithBadRequest(w, err.Error())
+			return
+		}
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithOK(w, "password successfully reset")
+}
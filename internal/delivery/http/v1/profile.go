@@ -0,0 +1,128 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/validator"
+)
+
+type ProfileUpdateForm struct {
+	DisplayName         *string                         `json:"display_name,omitempty"`
+	Email               *string                         `json:"email,omitempty"`
+	Notifications       *entity.NotificationPreferences `json:"notifications,omitempty"`
+	validator.Validator `json:"-"`
+}
+
+// @Summary Get profile
+// @Description Get the account of the current user
+// @Tags User
+// @Produce json
+// @Success 200 {object} entity.User
+// @Failure 401 {string} Unauthorized "Unauthorized"
+// @Failure 403 {string} Forbidden "Not a user session"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/me [get]
+func (h *Handler) GetProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := identityFromContext(ctx)
+	if id.UserID == "" {
+		h.responder.WithForbiddenError(w)
+		return
+	}
+
+	user, err := h.userService.GetProfile(ctx, id.UserID)
+	if err != nil {
+		h.profileError(w, err)
+		return
+	}
+	h.responder.WithOK(w, user)
+}
+
+// @Summary Update profile
+// @Description Update the display name, email and notification preferences of the current user. Omitted fields are left unchanged. A new email has to be verified again.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param profile body ProfileUpdateForm true "Profile fields"
+// @Success 200 {object} entity.User
+// @Failure 400 {object} entity.ProfileFormError "Invalid input"
+// @Failure 401 {string} Unauthorized "Unauthorized"
+// @Failure 403 {string} Forbidden "Not a user session"
+// @Failure 409 {string} email already in use "Email taken"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/me [patch]
+func (h *Handler) UpdateProfile(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := identityFromContext(ctx)
+	if id.UserID == "" {
+		h.responder.WithForbiddenError(w)
+		return
+	}
+
+	var form ProfileUpdateForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	user, err := h.userService.UpdateProfile(ctx, id.UserID, &form)
+	if err != nil {
+		if errors.Is(err, utils.InvalidForm) {
+			h.responder.WriteResponse(w, form.ProfileErrors, http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, utils.ErrEmailAlreadyExists) {
+			h.responder.With(http.StatusConflict, w, err.Error())
+			return
+		}
+		h.profileError(w, err)
+		return
+	}
+	h.responder.WithOK(w, user)
+}
+
+// @Summary Close account
+// @Description Delete the account of the current user
+// @Tags User
+// @Produce json
+// @Success 200 {string} account closed "Closed"
+// @Failure 401 {string} Unauthorized "Unauthorized"
+// @Failure 403 {string} Forbidden "Not a user session"
+// @Failure 409 {string} account has open loans or fines "Conflict, once loans and fines are tracked"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/me [delete]
+func (h *Handler) CloseAccount(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := identityFromContext(ctx)
+	if id.UserID == "" {
+		h.responder.WithForbiddenError(w)
+		return
+	}
+
+	if err := h.userService.CloseAccount(ctx, id.UserID); err != nil {
+		if errors.Is(err, utils.ErrAccountInUse) {
+			h.responder.With(http.StatusConflict, w, err.Error())
+			return
+		}
+		h.profileError(w, err)
+		return
+	}
+	h.responder.WithOK(w, "account closed")
+}
+
+// profileError answers 401 when the user behind a valid token is gone.
+func (h *Handler) profileError(w http.ResponseWriter, err error) {
+	if errors.Is(err, utils.ErrUserNotFound) || errors.Is(err, utils.ErrNotExist) {
+		h.responder.WithUnauthorizedError(w)
+		return
+	}
+	h.logger.Error(err.Error())
+	h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+}
@@ -0,0 +1,272 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"template/internal/entity"
+	"template/internal/utils"
+
+	"github.com/go-chi/chi/v5"
+	"go.uber.org/zap"
+)
+
+const (
+	ScimUserParam  = "scimUserID"
+	ScimGroupParam = "scimGroupID"
+
+	scimContentType = "application/scim+json"
+)
+
+type ScimUserForm struct {
+	Schemas     []string           `json:"schemas"`
+	ExternalID  string             `json:"externalId"`
+	UserName    string             `json:"userName"`
+	DisplayName string             `json:"displayName"`
+	Name        *ScimName          `json:"name"`
+	Emails      []entity.ScimEmail `json:"emails"`
+	Active      *bool              `json:"active"`
+}
+
+type ScimName struct {
+	Formatted  string `json:"formatted"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+}
+
+// Display is the name shown when the client did not send a displayName.
+func (n *ScimName) Display() string {
+	if n.Formatted != "" {
+		return n.Formatted
+	}
+	return strings.TrimSpace(n.GivenName + " " + n.FamilyName)
+}
+
+type ScimPatchForm struct {
+	Schemas    []string             `json:"schemas"`
+	Operations []ScimPatchOperation `json:"Operations"`
+}
+
+type ScimPatchOperation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// scimIdentity checks the bearer token of the provisioning client.
+func (h *Handler) scimIdentity(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if err := h.scimService.Authenticate(token); err != nil {
+			h.scimError(w, err)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// @Summary List users (SCIM)
+// @Description List provisioned users, filtered with userName eq or externalId eq
+// @Tags SCIM
+// @Produce json
+// @Param filter query string false "e.g. userName eq \"jdoe\""
+// @Param startIndex query int false "1-based index of the first result"
+// @Param count query int false "Page size, at most 200"
+// @Success 200 {object} entity.ScimListResponse
+// @Failure 400 {object} entity.ScimError
+// @Failure 401 {object} entity.ScimError
+// @Security Bearer
+// @Router /api/v1/scim/v2/Users [get]
+func (h *Handler) ScimListUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	res, err := h.scimService.ListUsers(r.Context(), query.Get("filter"), query.Get("startIndex"), query.Get("count"))
+	if err != nil {
+		h.scimError(w, err)
+		return
+	}
+	h.writeScim(w, http.StatusOK, res)
+}
+
+// @Summary Get user (SCIM)
+// @Tags SCIM
+// @Produce json
+// @Param scimUserID path string true "User ID"
+// @Success 200 {object} entity.ScimUser
+// @Failure 404 {object} entity.ScimError
+// @Security Bearer
+// @Router /api/v1/scim/v2/Users/{scimUserID} [get]
+func (h *Handler) ScimGetUser(w http.ResponseWriter, r *http.Request) {
+	user, err := h.scimService.GetUser(r.Context(), chi.URLParam(r, ScimUserParam))
+	if err != nil {
+		h.scimError(w, err)
+		return
+	}
+	h.writeScim(w, http.StatusOK, user)
+}
+
+// @Summary Create user (SCIM)
+// @Description Provision a user without a password
+// @Tags SCIM
+// @Accept json
+// @Produce json
+// @Param user body ScimUserForm true "User"
+// @Success 201 {object} entity.ScimUser
+// @Failure 400 {object} entity.ScimError
+// @Failure 409 {object} entity.ScimError "userName or email taken"
+// @Security Bearer
+// @Router /api/v1/scim/v2/Users [post]
+func (h *Handler) ScimCreateUser(w http.ResponseWriter, r *http.Request) {
+	var form ScimUserForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		h.scimError(w, utils.ErrBadInput)
+		return
+	}
+
+	user, err := h.scimService.CreateUser(r.Context(), &form)
+	if err != nil {
+		h.scimError(w, err)
+		return
+	}
+	h.writeScim(w, http.StatusCreated, user)
+}
+
+// @Summary Patch user (SCIM)
+// @Description Change attributes of a user, "active": false deactivates the account
+// @Tags SCIM
+// @Accept json
+// @Produce json
+// @Param scimUserID path string true "User ID"
+// @Param patch body ScimPatchForm true "PatchOp"
+// @Success 200 {object} entity.ScimUser
+// @Failure 400 {object} entity.ScimError
+// @Failure 404 {object} entity.ScimError
+// @Failure 409 {object} entity.ScimError "userName or email taken"
+// @Security Bearer
+// @Router /api/v1/scim/v2/Users/{scimUserID} [patch]
+func (h *Handler) ScimPatchUser(w http.ResponseWriter, r *http.Request) {
+	var form ScimPatchForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		h.scimError(w, utils.ErrBadInput)
+		return
+	}
+
+	user, err := h.scimService.PatchUser(r.Context(), chi.URLParam(r, ScimUserParam), &form)
+	if err != nil {
+		h.scimError(w, err)
+		return
+	}
+	h.writeScim(w, http.StatusOK, user)
+}
+
+// @Summary List groups (SCIM)
+// @Description The roles, as groups. Members are left out unless attributes=members is given, and then only the first 200 are listed, see GET /Groups/{id}.
+// @Tags SCIM
+// @Produce json
+// @Param filter query string false "e.g. displayName eq \"Admins\""
+// @Param attributes query string false "members"
+// @Success 200 {object} entity.ScimListResponse
+// @Failure 400 {object} entity.ScimError
+// @Security Bearer
+// @Router /api/v1/scim/v2/Groups [get]
+func (h *Handler) ScimListGroups(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	res, err := h.scimService.ListGroups(r.Context(), query.Get("filter"), query.Get("attributes"))
+	if err != nil {
+		h.scimError(w, err)
+		return
+	}
+	h.writeScim(w, http.StatusOK, res)
+}
+
+// @Summary Get group (SCIM)
+// @Tags SCIM
+// @Produce json
+// @Description Members are left out unless attributes=members is given, and are then paged with startIndex and count (at most 200).
+// @Param scimGroupID path string true "Group ID (the role)"
+// @Param attributes query string false "members"
+// @Param startIndex query int false "First member, from 1"
+// @Param count query int false "Members per page"
+// @Success 200 {object} entity.ScimGroup
+// @Failure 404 {object} entity.ScimError
+// @Security Bearer
+// @Router /api/v1/scim/v2/Groups/{scimGroupID} [get]
+func (h *Handler) ScimGetGroup(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	group, err := h.scimService.GetGroup(r.Context(), chi.URLParam(r, ScimGroupParam), query.Get("attributes"), query.Get("startIndex"), query.Get("count"))
+	if err != nil {
+		h.scimError(w, err)
+		return
+	}
+	h.writeScim(w, http.StatusOK, group)
+}
+
+// @Summary Patch group (SCIM)
+// @Description Add or remove members, which changes their role
+// @Tags SCIM
+// @Accept json
+// @Param scimGroupID path string true "Group ID (the role)"
+// @Param patch body ScimPatchForm true "PatchOp"
+// @Success 204
+// @Failure 400 {object} entity.ScimError
+// @Failure 404 {object} entity.ScimError
+// @Security Bearer
+// @Router /api/v1/scim/v2/Groups/{scimGroupID} [patch]
+func (h *Handler) ScimPatchGroup(w http.ResponseWriter, r *http.Request) {
+	var form ScimPatchForm
+	if err := json.NewDecoder(r.Body).Decode(&form); err != nil {
+		h.scimError(w, utils.ErrBadInput)
+		return
+	}
+
+	if err := h.scimService.PatchGroup(r.Context(), chi.URLParam(r, ScimGroupParam), &form); err != nil {
+		h.scimError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) writeScim(w http.ResponseWriter, status int, v interface{}) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		h.logger.Error("encoding response error: ", zap.Error(err))
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", scimContentType)
+	w.WriteHeader(status)
+	if _, err = w.Write(data); err != nil {
+		h.logger.Error("writing response error: ", zap.Error(err))
+	}
+}
+
+// scimError answers with an error in the SCIM format, clients do not
+// understand the usual response envelope.
+func (h *Handler) scimError(w http.ResponseWriter, err error) {
+	status, scimType := http.StatusInternalServerError, ""
+	switch {
+	case errors.Is(err, utils.ErrSCIMDisabled), errors.Is(err, utils.ErrUserNotFound), errors.Is(err, utils.ErrNotExist):
+		status = http.StatusNotFound
+	case errors.Is(err, utils.ErrInvalidCredentials):
+		status = http.StatusUnauthorized
+	case errors.Is(err, utils.ErrInvalidFilter):
+		status, scimType = http.StatusBadRequest, "invalidFilter"
+	case errors.Is(err, utils.ErrBadInput):
+		status, scimType = http.StatusBadRequest, "invalidValue"
+	case errors.Is(err, utils.ErrUserAlreadyExists), errors.Is(err, utils.ErrEmailAlreadyExists):
+		status, scimType = http.StatusConflict, "uniqueness"
+	}
+
+	detail := err.Error()
+	if status == http.StatusInternalServerError {
+		h.logger.Error("scim", zap.Error(err))
+		detail = http.StatusText(status)
+	}
+	h.writeScim(w, status, &entity.ScimError{
+		Schemas:  []string{entity.ScimSchemaError},
+		Status:   strconv.Itoa(status),
+		ScimType: scimType,
+		Detail:   detail,
+	})
+}
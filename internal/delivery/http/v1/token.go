@@ -0,0 +1,89 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"template/internal/utils"
+)
+
+const TokenParam = "tokenID"
+
+// @Summary Create personal access token
+// @Description Create a token for apps acting as the current user within the given scopes. The token is only returned once and is sent as a Bearer token.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param token body APIKeyInputForm true "Name, scopes (catalog:read, loans:read, holds:write) and optional expiry"
+// @Success 201 {object} entity.APIKeyCreated
+// @Failure 400 {object} entity.APIKeyFormError "Invalid input"
+// @Failure 403 {string} Forbidden "Not a user session"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/tokens [post]
+func (h *Handler) CreatePersonalToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var form APIKeyInputForm
+
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	token, err := h.apiKeyService.CreatePersonalToken(ctx, &form, identityFromContext(ctx).UserID)
+	if err != nil {
+		if errors.Is(err, utils.InvalidForm) {
+			h.responder.WriteResponse(w, form.APIKeyErrors, http.StatusBadRequest)
+			return
+		}
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithCreated(w, token)
+}
+
+// @Summary List personal access tokens
+// @Description List the tokens of the current user with their scopes, including revoked and expired ones
+// @Tags User
+// @Produce json
+// @Success 200 {object} []entity.APIKey
+// @Failure 403 {string} Forbidden "Not a user session"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/tokens [get]
+func (h *Handler) ListPersonalTokens(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	tokens, err := h.apiKeyService.ListPersonalTokens(ctx, identityFromContext(ctx).UserID)
+	if err != nil {
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithOK(w, tokens)
+}
+
+// @Summary Revoke personal access token
+// @Description Revoke a token of the current user
+// @Tags User
+// @Produce json
+// @Param tokenID path string true "Token ID"
+// @Success 200 {string} token successfully revoked "Token revoked"
+// @Failure 403 {string} Forbidden "Not a user session"
+// @Failure 404 {string} token not found "Token not found"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/tokens/{tokenID} [delete]
+func (h *Handler) RevokePersonalToken(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	err := h.apiKeyService.RevokePersonalToken(ctx, chi.URLParam(r, TokenParam), identityFromContext(ctx).UserID)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotExist) {
+			h.responder.WithNotFound(w, "token not found")
+			return
+		}
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithOK(w, "token successfully revoked")
+}
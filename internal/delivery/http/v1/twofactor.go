@@ -0,0 +1,268 @@
+package v1
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"template/internal/utils"
+)
+
+type TwoFactorCodeForm struct {
+	Code string `json:"code"`
+}
+
+type TwoFactorChallengeForm struct {
+	ChallengeToken string `json:"challenge_token"`
+}
+
+type TwoFactorLoginForm struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+	IP             string `json:"-"`
+}
+
+type TwoFactorPolicyForm struct {
+	RequiredRoles []int `json:"required_roles"`
+}
+
+// @Summary Complete login with a second factor
+// @Description Exchange the challenge token returned by login and a TOTP or recovery code for tokens
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param login body TwoFactorLoginForm true "Challenge token and code"
+// @Success 200 {object} entity.Tokens
+// @Failure 400 {string} invalid code "Invalid code"
+// @Failure 401 {string} invalid challenge "Invalid or expired challenge token"
+// @Failure 429 {string} too many requests "Too many failed attempts, see Retry-After"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Router /api/v1/user/login/2fa [post]
+func (h *Handler) LoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	var form TwoFactorLoginForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+	form.IP = clientIP(r)
+
+	res, err := h.userService.LoginTwoFactor(r.Context(), &form)
+	if err != nil {
+		h.twoFactorError(w, err)
+		return
+	}
+	h.responder.WithOK(w, res)
+}
+
+// @Summary Enroll in two-factor authentication during login
+// @Description Start the enrollment required by the two-factor policy, using the challenge token returned by login
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param enroll body TwoFactorChallengeForm true "Challenge token"
+// @Success 200 {object} entity.TwoFactorEnrollment
+// @Failure 401 {string} invalid challenge "Invalid or expired challenge token"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Router /api/v1/user/login/2fa/enroll [post]
+func (h *Handler) EnrollTwoFactorWithChallenge(w http.ResponseWriter, r *http.Request) {
+	var form TwoFactorChallengeForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	res, err := h.userService.EnrollTwoFactorWithChallenge(r.Context(), &form)
+	if err != nil {
+		h.twoFactorError(w, err)
+		return
+	}
+	h.responder.WithOK(w, res)
+}
+
+// @Summary Confirm two-factor enrollment during login
+// @Description Enable two-factor authentication with a first code and complete the login. Recovery codes are returned once.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param confirm body TwoFactorLoginForm true "Challenge token and code"
+// @Success 200 {object} entity.TwoFactorLogin
+// @Failure 400 {string} invalid code "Invalid code"
+// @Failure 401 {string} invalid challenge "Invalid or expired challenge token"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Router /api/v1/user/login/2fa/confirm [post]
+func (h *Handler) ConfirmTwoFactorWithChallenge(w http.ResponseWriter, r *http.Request) {
+	var form TwoFactorLoginForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	res, err := h.userService.ConfirmTwoFactorWithChallenge(r.Context(), &form)
+	if err != nil {
+		h.twoFactorError(w, err)
+		return
+	}
+	h.responder.WithOK(w, res)
+}
+
+// @Summary Enroll in two-factor authentication
+// @Description Create a TOTP secret for the current user. It is enforced once confirmed with a code.
+// @Tags User
+// @Produce json
+// @Success 200 {object} entity.TwoFactorEnrollment
+// @Failure 409 {string} already enabled "Two-factor authentication is already enabled"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/2fa/enroll [post]
+func (h *Handler) EnrollTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id := identityFromContext(r.Context())
+	if id.UserID == "" {
+		h.responder.WithForbiddenError(w)
+		return
+	}
+
+	res, err := h.userService.EnrollTwoFactor(r.Context(), id.UserID)
+	if err != nil {
+		h.twoFactorError(w, err)
+		return
+	}
+	h.responder.WithOK(w, res)
+}
+
+// @Summary Confirm two-factor enrollment
+// @Description Enable two-factor authentication with a first code. Recovery codes are returned once.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param confirm body TwoFactorCodeForm true "TOTP code"
+// @Success 200 {object} entity.RecoveryCodes
+// @Failure 400 {string} invalid code "Invalid code"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/2fa/confirm [post]
+func (h *Handler) ConfirmTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id := identityFromContext(r.Context())
+	if id.UserID == "" {
+		h.responder.WithForbiddenError(w)
+		return
+	}
+
+	var form TwoFactorCodeForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	res, err := h.userService.ConfirmTwoFactor(r.Context(), id.UserID, &form)
+	if err != nil {
+		h.twoFactorError(w, err)
+		return
+	}
+	h.responder.WithOK(w, res)
+}
+
+// @Summary Disable two-factor authentication
+// @Description Disable two-factor authentication with a TOTP or recovery code. Refused when the policy requires it for the user's role.
+// @Tags User
+// @Accept json
+// @Produce json
+// @Param disable body TwoFactorCodeForm true "TOTP or recovery code"
+// @Success 200 {string} two-factor authentication disabled "Disabled"
+// @Failure 400 {string} invalid code "Invalid code"
+// @Failure 403 {string} required "Two-factor authentication is required for this role"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/user/2fa/disable [post]
+func (h *Handler) DisableTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id := identityFromContext(r.Context())
+	if id.UserID == "" {
+		h.responder.WithForbiddenError(w)
+		return
+	}
+
+	var form TwoFactorCodeForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	if err = h.userService.DisableTwoFactor(r.Context(), id.UserID, &form); err != nil {
+		h.twoFactorError(w, err)
+		return
+	}
+	h.responder.WithOK(w, "two-factor authentication disabled")
+}
+
+// @Summary Get two-factor policy
+// @Description Roles that must use two-factor authentication
+// @Tags Admin
+// @Produce json
+// @Success 200 {object} entity.TwoFactorPolicy
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/2fa/policy [get]
+func (h *Handler) GetTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	res, err := h.userService.GetTwoFactorPolicy(r.Context())
+	if err != nil {
+		h.responder.WithInternalError(w, err.Error())
+		return
+	}
+	h.responder.WithOK(w, res)
+}
+
+// @Summary Set two-factor policy
+// @Description Require two-factor authentication for the given roles. Users of these roles enroll on their next login.
+// @Tags Admin
+// @Accept json
+// @Produce json
+// @Param policy body TwoFactorPolicyForm true "Roles requiring two-factor authentication"
+// @Success 200 {object} entity.TwoFactorPolicy
+// @Failure 400 {string} Invalid input "Unknown role"
+// @Failure 500 {string} Internal server error "Internal server error"
+// @Security Bearer
+// @Router /api/v1/admin/2fa/policy [put]
+func (h *Handler) SetTwoFactorPolicy(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var form TwoFactorPolicyForm
+	err := json.NewDecoder(r.Body).Decode(&form)
+	if err != nil {
+		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
+		return
+	}
+
+	res, err := h.userService.SetTwoFactorPolicy(ctx, &form, identityFromContext(ctx).UserID)
+	if err != nil {
+		if errors.Is(err, utils.ErrBadInput) {
+			h.responder.WithBadRequest(w, err.Error())
+			return
+		}
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+		return
+	}
+	h.responder.WithOK(w, res)
+}
+
+func (h *Handler) twoFactorError(w http.ResponseWriter, err error) {
+	var lockout *utils.LockoutError
+	switch {
+	case errors.As(err, &lockout):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+		h.responder.WithTooManyRequests(w)
+	case errors.Is(err, utils.ErrInvalidChallenge):
+		h.responder.With(http.StatusUnauthorized, w, err.Error())
+	case errors.Is(err, utils.ErrInvalidCode), errors.Is(err, utils.ErrTwoFactorDisabled):
+		h.responder.WithBadRequest(w, err.Error())
+	case errors.Is(err, utils.ErrTwoFactorEnabled):
+		h.responder.With(http.StatusConflict, w, err.Error())
+	case errors.Is(err, utils.ErrTwoFactorRequired), errors.Is(err, utils.ErrAccountDisabled):
+		h.responder.With(http.StatusForbidden, w, err.Error())
+	default:
+		h.responder.WithInternalError(w, http.StatusText(http.StatusInternalServerError))
+	}
+}
@@ -3,7 +3,9 @@ package v1
 import (
 	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
+	"strconv"
 	"template/internal/entity"
 	"template/internal/utils"
 	"template/pkg/validator"
@@ -12,18 +14,23 @@ import (
 type UserLoginForm struct {
 	Username            string `json:"username" bson:"username"`
 	Password            string `json:"password" bson:"password"`
+	IP                  string `json:"-" bson:"-"`
 	validator.Validator `json:"-" bson:"-"`
 }
 
 // @Summary User Login
-// @Description User login endpoint
+// @Description User login endpoint. With two-factor authentication a challenge is returned instead of tokens, see /api/v1/user/login/2fa.
 // @Tags User
 // @Accept json
 // @Produce json
 // @Param login body UserLoginForm true "Login form"
 // @Success 200 {object} entity.Tokens
+// @Success 202 {object} entity.TwoFactorChallenge
 // @Failure 400 {object} entity.UserFormError "Invalid input"
 // @Failure 404 {string} user not found "User not found"
+// @Failure 403 {string} account is disabled "Account disabled"
+// @Failure 409 {string} user already exists "Username taken by a local user"
+// @Failure 429 {string} too many requests "Too many failed attempts, see Retry-After"
 // @Failure 500 {string} Internal server error "Internal server error"
 // @Router /api/v1/user/login [post]
 func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
@@ -34,23 +41,43 @@ func (h *Handler) Login(w http.ResponseWriter, r *http.Request) {
 		h.responder.WithBadRequest(w, http.StatusText(http.StatusBadRequest))
 		return
 	}
+	form.IP = clientIP(r)
 
 	res, err := h.userService.Login(ctx, &form)
 	if err != nil {
-		if errors.Is(err, utils.ErrUserNotFound) {
+		var lockout *utils.LockoutError
+		if errors.As(err, &lockout) {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(lockout.RetryAfter.Seconds()))))
+			h.responder.WithTooManyRequests(w)
+			return
+		}
+		if errors.Is(err, utils.ErrUserNotFound) || errors.Is(err, utils.ErrInvalidCredentials) {
 			h.responder.WithBadRequest(w, err.Error())
 			return
 		}
+		if errors.Is(err, utils.ErrAccountDisabled) {
+			h.responder.With(http.StatusForbidden, w, err.Error())
+			return
+		}
+		if errors.Is(err, utils.ErrUserAlreadyExists) {
+			h.responder.With(http.StatusConflict, w, err.Error())
+			return
+		}
 
 		h.responder.WithInternalError(w, err.Error())
 		return
 	}
 
-	h.responder.WithOK(w, res)
+	if res.Challenge != nil {
+		h.responder.With(http.StatusAccepted, w, res.Challenge)
+		return
+	}
+	h.responder.WithOK(w, res.Tokens)
 }
 
 type UserSignupForm struct {
 	Username            string `json:"username" bson:"username"`
+	Email               string `json:"email" bson:"email"`
 	Password            string `json:"password" bson:"password"`
 	Secret              string `json:"secret,omitempty" bson:"secret,omitempty"`
 	validator.Validator `json:"-" bson:"-"`
@@ -81,7 +108,7 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 			h.responder.WriteResponse(w, form.UserErrors, http.StatusBadRequest)
 			return
 		}
-		if errors.Is(err, utils.ErrUserAlreadyExists) {
+		if errors.Is(err, utils.ErrUserAlreadyExists) || errors.Is(err, utils.ErrEmailAlreadyExists) {
 			h.responder.WithBadRequest(w, err.Error())
 			return
 		}
@@ -99,6 +126,8 @@ func (h *Handler) SignUp(w http.ResponseWriter, r *http.Request) {
 // @Param refresh body entity.RefreshInput true "Refresh token information"
 // @Success 200 {object} entity.Tokens "New JWT Tokens"
 // @Failure 400 {string} string "Invalid input"
+// @Failure 401 {string} string "Unknown or expired refresh token, or one of another user"
+// @Failure 403 {string} string "Account disabled"
 // @Failure 500 {string} string "Internal server error"
 // @Security Bearer
 // @Router /api/v1/user/auth/refresh [post]
@@ -111,8 +140,16 @@ func (h *Handler) userRefresh(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	res, err := h.userService.RefreshTokens(ctx, form.Token)
-	if err != nil {
+	res, err := h.userService.RefreshTokens(ctx, identityFromContext(ctx).UserID, form.Token)
+	switch {
+	case err == nil:
+	case errors.Is(err, utils.ErrInvalidRefreshToken):
+		h.responder.With(http.StatusUnauthorized, w, err.Error())
+		return
+	case errors.Is(err, utils.ErrAccountDisabled):
+		h.responder.With(http.StatusForbidden, w, err.Error())
+		return
+	default:
 		h.responder.WithInternalError(w, err.Error())
 		return
 	}
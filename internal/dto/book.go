@@ -24,7 +24,8 @@ func BookToFormUpdate(book *v1.BookInputForm) *entity.BookFormUpdate {
 		Title:     book.Title,
 		Publisher: book.Publisher,
 		Author:    book.Author,
-		UpdatedAt: time.Now(),
+		// as Mongo stores it, so the cached copy encodes the same
+		UpdatedAt: time.Now().UTC().Truncate(time.Millisecond),
 	}
 
 	return &form
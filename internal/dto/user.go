@@ -14,6 +14,7 @@ func FormToUser(form v1.UserSignupForm) *entity.User {
 
 	user := entity.User{
 		Username:  form.Username,
+		Email:     form.Email,
 		CreatedAt: time.Now(),
 		Role:      isAdm,
 	}
@@ -0,0 +1,53 @@
+package entity
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	ScopeCatalogRead  = "catalog:read"
+	ScopeCatalogWrite = "catalog:write"
+	ScopeLoansRead    = "loans:read"
+	ScopeHoldsWrite   = "holds:write"
+)
+
+// APIKeyScopes lists the scopes an API key can be issued with.
+var APIKeyScopes = []string{ScopeCatalogRead, ScopeCatalogWrite}
+
+// PersonalTokenPrefix marks personal access tokens, which are accepted as
+// Bearer tokens as well as in the API key header.
+const PersonalTokenPrefix = "lmp_"
+
+// PersonalTokenScopes lists the scopes a user can give a personal access
+// token.
+var PersonalTokenScopes = []string{ScopeCatalogRead, ScopeLoansRead, ScopeHoldsWrite}
+
+// APIKey is either a service key created by an admin or, when UserID is
+// set, a personal access token acting as that user within its scopes.
+type APIKey struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Name       string             `json:"name" bson:"name"`
+	Prefix     string             `json:"prefix" bson:"prefix"`
+	HashedKey  string             `json:"-" bson:"hashedKey"`
+	Scopes     []string           `json:"scopes" bson:"scopes"`
+	UserID     string             `json:"userId,omitempty" bson:"userId,omitempty"`
+	CreatedBy  string             `json:"createdBy" bson:"createdBy"`
+	CreatedAt  time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt  *time.Time         `json:"expiresAt,omitempty" bson:"expiresAt,omitempty"`
+	LastUsedAt *time.Time         `json:"lastUsedAt,omitempty" bson:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time         `json:"revokedAt,omitempty" bson:"revokedAt,omitempty"`
+}
+
+// APIKeyCreated is returned once on creation, it is the only time the
+// plain key is visible.
+type APIKeyCreated struct {
+	Key    string  `json:"key"`
+	APIKey *APIKey `json:"api_key"`
+}
+
+type APIKeyFormError struct {
+	Name      string `json:"name,omitempty" bson:"name,omitempty"`
+	Scopes    string `json:"scopes,omitempty" bson:"scopes,omitempty"`
+	ExpiresAt string `json:"expires_at,omitempty" bson:"expires_at,omitempty"`
+}
@@ -0,0 +1,39 @@
+package entity
+
+import (
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"time"
+)
+
+const (
+	AuditLoginLockout = "login.lockout"
+	AuditLoginUnlock  = "login.unlock"
+
+	AuditPasswordChange     = "password.change"
+	AuditPasswordReset      = "password.reset"
+	AuditPasswordForceReset = "password.force_reset"
+
+	AuditTwoFactorEnable   = "2fa.enable"
+	AuditTwoFactorDisable  = "2fa.disable"
+	AuditTwoFactorRecovery = "2fa.recovery_code"
+	AuditTwoFactorPolicy   = "2fa.policy"
+
+	AuditUserList        = "user.list"
+	AuditUserView        = "user.view"
+	AuditUserProvisioned = "user.provisioned"
+	AuditUserClosed      = "user.closed"
+	AuditUserRole        = "user.role"
+	AuditUserDisable     = "user.disable"
+	AuditUserEnable      = "user.enable"
+	AuditUserImpersonate = "user.impersonate"
+)
+
+type AuditRecord struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Action    string             `json:"action" bson:"action"`
+	ActorID   string             `json:"actorId,omitempty" bson:"actorId,omitempty"`
+	Target    string             `json:"target,omitempty" bson:"target,omitempty"`
+	IP        string             `json:"ip,omitempty" bson:"ip,omitempty"`
+	Details   map[string]string  `json:"details,omitempty" bson:"details,omitempty"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+}
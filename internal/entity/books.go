@@ -11,6 +11,9 @@ type Book struct {
 	Author    []string  `json:"author" bson:"author"`
 	CreatedAt time.Time `json:"createdAt" bson:"createdAt"`
 	UpdatedAt time.Time `json:"updatedAt,omitempty" bson:"updatedAt,omitempty"`
+	// Stale marks a book served from the cache while the database could not
+	// be reached.
+	Stale bool `json:"-" bson:"-"`
 }
 
 type BookFormCreate struct {
@@ -41,4 +44,12 @@ type BookFormError struct {
 type PaginatedBooks struct {
 	Books    []*Book `json:"books"`
 	LastPage int     `json:"last_page"`
+	Stale    bool    `json:"-"`
+}
+
+// BookListQuery is a normalized catalog listing request. Cached pages are
+// keyed by it, so every parameter that changes the result belongs here.
+type BookListQuery struct {
+	Page  int
+	Limit int
 }
@@ -0,0 +1,65 @@
+package entity
+
+import "time"
+
+// Ways to pick the books to pre-warm the cache with.
+const (
+	CacheWarmPopular = "popular"
+	CacheWarmRecent  = "recent"
+)
+
+// CacheOpStats counts the lookups of one cache operation since the replica
+// started.
+type CacheOpStats struct {
+	Hits     int64   `json:"hits"`
+	Misses   int64   `json:"misses"`
+	Errors   int64   `json:"errors"`
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+// BookCacheUsage is what the cache backend reports about itself. Keys are
+// the members of the books set, not-found entries included, MemoryBytes is
+// extrapolated from a sample of them and left zero when the backend cannot
+// tell.
+type BookCacheUsage struct {
+	Keys        int64 `json:"keys"`
+	MemoryBytes int64 `json:"memory_bytes,omitempty"`
+	Sampled     int   `json:"memory_sampled,omitempty"`
+	L1Keys      int   `json:"l1_keys,omitempty"`
+}
+
+// CachedBook is an entry of the books set as the consistency check sees
+// it. Book is nil when the entry is gone or cannot be decoded.
+type CachedBook struct {
+	ISBN string
+	// NotFound marks a "not found" entry rather than a copy of the book
+	NotFound bool
+	// Gone marks a member of the set whose entry has expired
+	Gone bool
+	Book *Book
+}
+
+// ConsistencyReport sums up a comparison of the cache with the database.
+// Missing are members of the books set without an entry, Stale entries
+// that differ from the database (including "not found" entries for books
+// that exist), Orphaned cached books the database no longer holds. The
+// ISBN lists are capped, the counts are not.
+type ConsistencyReport struct {
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+	Repair     bool      `json:"repair"`
+	Checked    int       `json:"checked"`
+	Missing    int       `json:"missing"`
+	Stale      int       `json:"stale"`
+	Orphaned   int       `json:"orphaned"`
+	Repaired   int       `json:"repaired"`
+
+	StaleISBNs    []string `json:"stale_isbns,omitempty"`
+	OrphanedISBNs []string `json:"orphaned_isbns,omitempty"`
+	Error         string   `json:"error,omitempty"`
+}
+
+type CacheStats struct {
+	Operations map[string]CacheOpStats `json:"operations"`
+	BookCacheUsage
+}
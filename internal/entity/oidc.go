@@ -0,0 +1,12 @@
+package entity
+
+// ProviderOIDC keys users linked to the OpenID Connect provider in
+// User.ExternalIDs.
+const ProviderOIDC = "oidc"
+
+// OIDCState is kept between the redirect to the identity provider and the
+// callback.
+type OIDCState struct {
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
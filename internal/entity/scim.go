@@ -0,0 +1,81 @@
+package entity
+
+import (
+	"time"
+)
+
+// ProviderSCIM keys the externalId set by the SCIM client in
+// User.ExternalIDs.
+const ProviderSCIM = "scim"
+
+const (
+	ScimSchemaUser         = "urn:ietf:params:scim:schemas:core:2.0:User"
+	ScimSchemaGroup        = "urn:ietf:params:scim:schemas:core:2.0:Group"
+	ScimSchemaListResponse = "urn:ietf:params:scim:api:messages:2.0:ListResponse"
+	ScimSchemaPatchOp      = "urn:ietf:params:scim:api:messages:2.0:PatchOp"
+	ScimSchemaError        = "urn:ietf:params:scim:api:messages:2.0:Error"
+)
+
+// ScimUser is a user in the SCIM core schema (RFC 7643).
+type ScimUser struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	ExternalID  string       `json:"externalId,omitempty"`
+	UserName    string       `json:"userName"`
+	DisplayName string       `json:"displayName,omitempty"`
+	Emails      []ScimEmail  `json:"emails,omitempty"`
+	Active      bool         `json:"active"`
+	Groups      []ScimMember `json:"groups,omitempty"`
+	Meta        ScimMeta     `json:"meta"`
+}
+
+type ScimEmail struct {
+	Value   string `json:"value"`
+	Type    string `json:"type,omitempty"`
+	Primary bool   `json:"primary,omitempty"`
+}
+
+// ScimGroup is a role exposed as a group. Members is only set when the
+// client asks for it, and paged, the user group can be large.
+type ScimGroup struct {
+	Schemas     []string     `json:"schemas"`
+	ID          string       `json:"id"`
+	DisplayName string       `json:"displayName"`
+	Members     []ScimMember `json:"members,omitempty"`
+	Meta        ScimMeta     `json:"meta"`
+}
+
+type ScimMember struct {
+	Value   string `json:"value"`
+	Display string `json:"display,omitempty"`
+}
+
+type ScimMeta struct {
+	ResourceType string     `json:"resourceType"`
+	Created      *time.Time `json:"created,omitempty"`
+}
+
+type ScimListResponse struct {
+	Schemas      []string    `json:"schemas"`
+	TotalResults int         `json:"totalResults"`
+	StartIndex   int         `json:"startIndex"`
+	ItemsPerPage int         `json:"itemsPerPage"`
+	Resources    interface{} `json:"Resources"`
+}
+
+type ScimError struct {
+	Schemas  []string `json:"schemas"`
+	Status   string   `json:"status"`
+	ScimType string   `json:"scimType,omitempty"`
+	Detail   string   `json:"detail,omitempty"`
+}
+
+// ProvisionedUpdate holds the attributes a provisioning client changes,
+// nil fields are left untouched.
+type ProvisionedUpdate struct {
+	Username    *string
+	DisplayName *string
+	Email       *string
+	Disabled    *bool
+	ExternalID  *string
+}
@@ -2,9 +2,11 @@ package entity
 
 import "time"
 
+// Session is the refresh session of a user, only the hash of the refresh
+// token is stored.
 type Session struct {
-	RefreshToken string    `json:"refresh_token" bson:"refresh_token"`
-	ExpiresAt    time.Time `json:"expires_at" bson:"expires_at"`
+	TokenHash string    `json:"-" bson:"tokenHash"`
+	ExpiresAt time.Time `json:"expires_at" bson:"expires_at"`
 }
 
 type Tokens struct {
@@ -12,6 +14,14 @@ type Tokens struct {
 	RefreshToken string `json:"refresh_token" bson:"expires_at"`
 }
 
+// ImpersonationToken is an access token for acting as another user. It
+// cannot be refreshed.
+type ImpersonationToken struct {
+	AccessToken string    `json:"access_token"`
+	UserID      string    `json:"user_id"`
+	ExpiresAt   time.Time `json:"expires_at"`
+}
+
 type RefreshInput struct {
 	Token string `json:"token" binding:"required"`
 }
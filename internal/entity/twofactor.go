@@ -0,0 +1,60 @@
+package entity
+
+import "time"
+
+// TwoFactor is the TOTP enrollment of a user. It is created pending on
+// enroll and only enforced once a first code is confirmed.
+type TwoFactor struct {
+	Secret        string     `json:"-" bson:"secret"`
+	Enabled       bool       `json:"enabled" bson:"enabled"`
+	LastStep      int64      `json:"-" bson:"lastStep"`
+	RecoveryCodes []string   `json:"-" bson:"recoveryCodes,omitempty"`
+	EnabledAt     *time.Time `json:"enabledAt,omitempty" bson:"enabledAt,omitempty"`
+}
+
+// TwoFactorPolicy lists the roles that must use two-factor authentication.
+type TwoFactorPolicy struct {
+	RequiredRoles []int     `json:"required_roles" bson:"requiredRoles"`
+	UpdatedBy     string    `json:"updated_by,omitempty" bson:"updatedBy,omitempty"`
+	UpdatedAt     time.Time `json:"updated_at,omitempty" bson:"updatedAt,omitempty"`
+}
+
+func (p *TwoFactorPolicy) Requires(role int) bool {
+	for _, r := range p.RequiredRoles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type TwoFactorEnrollment struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+// RecoveryCodes are shown once, when two-factor authentication is enabled.
+type RecoveryCodes struct {
+	Codes []string `json:"recovery_codes"`
+}
+
+// TwoFactorChallenge is returned by login instead of tokens when a second
+// factor is needed. With EnrollmentRequired the user has to enroll first.
+type TwoFactorChallenge struct {
+	ChallengeToken     string    `json:"challenge_token"`
+	ExpiresAt          time.Time `json:"expires_at"`
+	EnrollmentRequired bool      `json:"enrollment_required,omitempty"`
+}
+
+// LoginResult holds either the session tokens or a two-factor challenge.
+type LoginResult struct {
+	Tokens    *Tokens
+	Challenge *TwoFactorChallenge
+}
+
+// TwoFactorLogin is returned when login completes by enrolling, it carries
+// the recovery codes along with the tokens.
+type TwoFactorLogin struct {
+	Tokens
+	RecoveryCodes
+}
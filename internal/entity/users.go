@@ -5,16 +5,119 @@ import (
 	"time"
 )
 
+const (
+	RoleUser  = 0
+	RoleAdmin = 1
+)
+
+// Roles lists every role a user can have.
+var Roles = []int{RoleUser, RoleAdmin}
+
 type User struct {
 	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	Username       string             `json:"username" bson:"username"`
-	HashedPassword string             `json:"password" bson:"password"`
+	DisplayName    string             `json:"displayName,omitempty" bson:"displayName,omitempty"`
+	Email          string             `json:"email,omitempty" bson:"email,omitempty"`
+	EmailVerified  bool               `json:"emailVerified" bson:"emailVerified,omitempty"`
+	HashedPassword string             `json:"-" bson:"password"`
 	Role           int                `json:"role" bson:"role"`
+	Disabled       bool               `json:"disabled" bson:"disabled,omitempty"`
 	CreatedAt      time.Time          `json:"createdAt" bson:"createdAt"`
+
+	Notifications NotificationPreferences `json:"notifications" bson:"notifications"`
+
+	// PasswordChangedAt invalidates the access tokens issued before it.
+	PasswordChangedAt *time.Time `json:"passwordChangedAt,omitempty" bson:"passwordChangedAt,omitempty"`
+	TwoFactor         *TwoFactor `json:"twoFactor,omitempty" bson:"twoFactor,omitempty"`
+	// ExternalIDs links the user to identity providers, keyed by provider.
+	ExternalIDs map[string]string `json:"-" bson:"externalIds,omitempty"`
+
+	EmailVerification *EmailVerification `json:"-" bson:"emailVerification,omitempty"`
+}
+
+// EmailVerification is the pending verification of the user's email,
+// only the hash of the token is stored.
+type EmailVerification struct {
+	TokenHash string    `bson:"tokenHash"`
+	SentAt    time.Time `bson:"sentAt"`
+	ExpiresAt time.Time `bson:"expiresAt"`
+}
+
+func (u *User) TwoFactorEnabled() bool {
+	return u.TwoFactor != nil && u.TwoFactor.Enabled
+}
+
+// NotificationPreferences are the optional messages a user opted into.
+// Security messages such as password resets are always sent.
+type NotificationPreferences struct {
+	Email         bool `json:"email" bson:"email"`
+	Announcements bool `json:"announcements" bson:"announcements"`
+}
+
+// ProfileUpdate holds the profile fields a user may change, nil fields are
+// left untouched.
+type ProfileUpdate struct {
+	DisplayName   *string
+	Email         *string
+	Notifications *NotificationPreferences
+}
+
+// UserFilter narrows the admin user listing. Query matches the start of
+// the username or email, Username matches exactly, and Subject matches the
+// external ID of Provider. Empty and nil fields do not filter.
+type UserFilter struct {
+	Query    string
+	Username string
+	Provider string
+	Subject  string
+	Role     *int
+	Disabled *bool
+}
+
+type PaginatedUsers struct {
+	Users    []*User `json:"users"`
+	LastPage int     `json:"last_page"`
 }
 
 type UserFormError struct {
 	Username string `json:"username,omitempty" bson:"username,omitempty"`
+	Email    string `json:"email,omitempty" bson:"email,omitempty"`
 	Password string `json:"password,omitempty" bson:"password,omitempty"`
 	Secret   string `json:"secret,omitempty" bson:"secret,omitempty"`
 }
+
+type ProfileFormError struct {
+	DisplayName string `json:"display_name,omitempty" bson:"display_name,omitempty"`
+	Email       string `json:"email,omitempty" bson:"email,omitempty"`
+}
+
+type PasswordFormError struct {
+	OldPassword string `json:"old_password,omitempty" bson:"old_password,omitempty"`
+	NewPassword string `json:"new_password,omitempty" bson:"new_password,omitempty"`
+	Token       string `json:"token,omitempty" bson:"token,omitempty"`
+}
+
+// PasswordReset is a single-use reset token, only its hash is stored.
+type PasswordReset struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	TokenHash string             `json:"-" bson:"tokenHash"`
+	UserID    primitive.ObjectID `json:"userId" bson:"userId"`
+	CreatedAt time.Time          `json:"createdAt" bson:"createdAt"`
+	ExpiresAt time.Time          `json:"expiresAt" bson:"expiresAt"`
+	UsedAt    *time.Time         `json:"usedAt,omitempty" bson:"usedAt,omitempty"`
+}
+
+// ProviderLDAP keys users linked to the LDAP directory in
+// User.ExternalIDs.
+const ProviderLDAP = "ldap"
+
+// ExternalIdentity is a user authenticated by an identity provider.
+// Role is nil when the provider does not decide the role.
+type ExternalIdentity struct {
+	Provider    string
+	Subject     string
+	Username    string
+	Email       string
+	DisplayName string
+	Role        *int
+}
@@ -0,0 +1,413 @@
+// Package cachetest holds the behaviour every book cache backend has to
+// share, so the in-process and Redis caches cannot drift apart. Backends
+// run it from their own tests with Run.
+package cachetest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"template/internal/entity"
+	"template/internal/utils"
+	"testing"
+	"time"
+)
+
+// Repo is the book cache of bookService.CachedBookRepo.
+type Repo interface {
+	InsertBook(ctx context.Context, book *entity.Book) error
+	FindBookByISBN(ctx context.Context, id string) (*entity.Book, error)
+	UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error
+	DeleteBookByISBN(ctx context.Context, id string) error
+	BookListGeneration(ctx context.Context) (int64, error)
+	FindBookList(ctx context.Context, generation int64, query *entity.BookListQuery) (*entity.PaginatedBooks, error)
+	InsertBookList(ctx context.Context, generation int64, query *entity.BookListQuery, books *entity.PaginatedBooks) error
+	InvalidateBookLists(ctx context.Context) error
+	IsBookMissing(ctx context.Context, id string) (bool, error)
+	InsertMissingBook(ctx context.Context, id string, generation int64) error
+	DeleteMissingBook(ctx context.Context, id string) error
+}
+
+// Backend returns an empty cache whose books and pages expire after ttl
+// and whose missing books expire after negativeTTL, along with a function
+// moving the clock of the cache forward.
+type Backend func(t *testing.T, ttl, negativeTTL time.Duration) (Repo, func(time.Duration))
+
+const (
+	// longTTL keeps entries from expiring during a test
+	longTTL = time.Hour
+	// shortTTL is used by the expiry tests, backends on the wall clock
+	// sleep through it
+	shortTTL = 50 * time.Millisecond
+)
+
+type testCase struct {
+	name        string
+	ttl         time.Duration
+	negativeTTL time.Duration
+	run         func(t *testing.T, ctx context.Context, repo Repo, advance func(time.Duration))
+}
+
+// Run runs the suite against the caches made by backend.
+func Run(t *testing.T, backend Backend) {
+	tests := []testCase{
+		{name: "find missing book", run: testFindMissing},
+		{name: "insert and find book", run: testInsertFind},
+		{name: "insert keeps cached book", run: testInsertKeeps},
+		{name: "cached book is a copy", run: testCopy},
+		{name: "update book", run: testUpdate},
+		{name: "update missing book", run: testUpdateMissing},
+		{name: "delete book", run: testDelete},
+		{name: "book list generations", run: testListGenerations},
+		{name: "book list pages", run: testListPages},
+		{name: "missing book entries", run: testMissingBooks},
+		{name: "missing book from older generation", run: testMissingGeneration},
+		{name: "book expiry", ttl: shortTTL, run: testBookExpiry},
+		{name: "book list expiry", ttl: shortTTL, run: testListExpiry},
+		{name: "missing book expiry", negativeTTL: shortTTL, run: testMissingExpiry},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			ttl, negativeTTL := tc.ttl, tc.negativeTTL
+			if ttl == 0 {
+				ttl = longTTL
+			}
+			if negativeTTL == 0 {
+				negativeTTL = longTTL
+			}
+			repo, advance := backend(t, ttl, negativeTTL)
+			tc.run(t, context.Background(), repo, advance)
+		})
+	}
+}
+
+func newBook(isbn string) *entity.Book {
+	created := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	return &entity.Book{
+		ISBN:      isbn,
+		Title:     "The Go Programming Language",
+		Publisher: "Addison-Wesley",
+		Author:    []string{"Alan Donovan", "Brian Kernighan"},
+		CreatedAt: created,
+		UpdatedAt: created,
+	}
+}
+
+func mustInsert(t *testing.T, ctx context.Context, repo Repo, book *entity.Book) {
+	t.Helper()
+	if err := repo.InsertBook(ctx, book); err != nil {
+		t.Fatalf("InsertBook: %v", err)
+	}
+}
+
+func mustFind(t *testing.T, ctx context.Context, repo Repo, isbn string) *entity.Book {
+	t.Helper()
+	book, err := repo.FindBookByISBN(ctx, isbn)
+	if err != nil {
+		t.Fatalf("FindBookByISBN(%q): %v", isbn, err)
+	}
+	return book
+}
+
+func assertNotExist(t *testing.T, ctx context.Context, repo Repo, isbn string) {
+	t.Helper()
+	if book, err := repo.FindBookByISBN(ctx, isbn); !errors.Is(err, utils.ErrNotExist) {
+		t.Fatalf("FindBookByISBN(%q) = %+v, %v, want ErrNotExist", isbn, book, err)
+	}
+}
+
+func assertBook(t *testing.T, got, want *entity.Book) {
+	t.Helper()
+	if got.ISBN != want.ISBN || got.Title != want.Title || got.Publisher != want.Publisher ||
+		!equalAuthors(got.Author, want.Author) ||
+		!got.CreatedAt.Equal(want.CreatedAt) || !got.UpdatedAt.Equal(want.UpdatedAt) {
+		t.Fatalf("book = %+v, want %+v", got, want)
+	}
+}
+
+func equalAuthors(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func assertMissing(t *testing.T, ctx context.Context, repo Repo, isbn string, want bool) {
+	t.Helper()
+	missing, err := repo.IsBookMissing(ctx, isbn)
+	if err != nil {
+		t.Fatalf("IsBookMissing(%q): %v", isbn, err)
+	}
+	if missing != want {
+		t.Fatalf("IsBookMissing(%q) = %v, want %v", isbn, missing, want)
+	}
+}
+
+func generation(t *testing.T, ctx context.Context, repo Repo) int64 {
+	t.Helper()
+	gen, err := repo.BookListGeneration(ctx)
+	if err != nil {
+		t.Fatalf("BookListGeneration: %v", err)
+	}
+	return gen
+}
+
+func testFindMissing(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	assertNotExist(t, ctx, repo, "9780134190440")
+}
+
+func testInsertFind(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	book := newBook("9780134190440")
+	mustInsert(t, ctx, repo, book)
+	assertBook(t, mustFind(t, ctx, repo, book.ISBN), book)
+	assertNotExist(t, ctx, repo, "9780262033848")
+}
+
+// testInsertKeeps checks that a book read from the database before an
+// update cannot overwrite the updated entry.
+func testInsertKeeps(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	book := newBook("9780134190440")
+	mustInsert(t, ctx, repo, book)
+
+	stale := newBook(book.ISBN)
+	stale.Title = "Outdated"
+	mustInsert(t, ctx, repo, stale)
+
+	assertBook(t, mustFind(t, ctx, repo, book.ISBN), book)
+}
+
+func testCopy(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	book := newBook("9780134190440")
+	mustInsert(t, ctx, repo, book)
+	book.Author[0] = "Changed after insert"
+
+	found := mustFind(t, ctx, repo, book.ISBN)
+	found.Author[1] = "Changed after find"
+
+	assertBook(t, mustFind(t, ctx, repo, book.ISBN), newBook(book.ISBN))
+}
+
+func testUpdate(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	tests := []struct {
+		name string
+		form entity.BookFormUpdate
+		want func(book *entity.Book)
+	}{
+		{
+			name: "title only",
+			form: entity.BookFormUpdate{Title: "Second Edition"},
+			want: func(book *entity.Book) { book.Title = "Second Edition" },
+		},
+		{
+			name: "publisher and authors",
+			form: entity.BookFormUpdate{Publisher: "Pearson", Author: []string{"Alan Donovan"}},
+			want: func(book *entity.Book) {
+				book.Publisher = "Pearson"
+				book.Author = []string{"Alan Donovan"}
+			},
+		},
+		{
+			name: "empty fields are kept",
+			form: entity.BookFormUpdate{},
+			want: func(*entity.Book) {},
+		},
+	}
+
+	for i, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			book := newBook(fmt.Sprintf("97801341904%02d", i))
+			mustInsert(t, ctx, repo, book)
+
+			updated := time.Date(2024, 4, 1, 12, 0, 0, 0, time.UTC)
+			form := tc.form
+			form.ISBN, form.UpdatedAt = book.ISBN, updated
+			if err := repo.UpdateBookByISBN(ctx, &form); err != nil {
+				t.Fatalf("UpdateBookByISBN: %v", err)
+			}
+
+			tc.want(book)
+			book.UpdatedAt = updated
+			assertBook(t, mustFind(t, ctx, repo, book.ISBN), book)
+		})
+	}
+}
+
+// testUpdateMissing checks that an update does not cache a book deleted
+// concurrently, or one that was never read.
+func testUpdateMissing(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	form := &entity.BookFormUpdate{ISBN: "9780134190440", Title: "Second Edition"}
+	if err := repo.UpdateBookByISBN(ctx, form); !errors.Is(err, utils.ErrNotExist) {
+		t.Fatalf("UpdateBookByISBN = %v, want ErrNotExist", err)
+	}
+	assertNotExist(t, ctx, repo, form.ISBN)
+}
+
+func testDelete(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	book, other := newBook("9780134190440"), newBook("9780262033848")
+	mustInsert(t, ctx, repo, book)
+	mustInsert(t, ctx, repo, other)
+
+	if err := repo.DeleteBookByISBN(ctx, book.ISBN); err != nil {
+		t.Fatalf("DeleteBookByISBN: %v", err)
+	}
+	assertNotExist(t, ctx, repo, book.ISBN)
+	assertBook(t, mustFind(t, ctx, repo, other.ISBN), other)
+
+	// a book may be deleted before it was ever cached
+	if err := repo.DeleteBookByISBN(ctx, book.ISBN); err != nil {
+		t.Fatalf("DeleteBookByISBN twice: %v", err)
+	}
+}
+
+func testListGenerations(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	query := &entity.BookListQuery{Page: 1, Limit: 10}
+	page := &entity.PaginatedBooks{Books: []*entity.Book{newBook("9780134190440")}, LastPage: 1}
+
+	gen := generation(t, ctx, repo)
+	if _, err := repo.FindBookList(ctx, gen, query); !errors.Is(err, utils.ErrNotExist) {
+		t.Fatalf("FindBookList before insert = %v, want ErrNotExist", err)
+	}
+	if err := repo.InsertBookList(ctx, gen, query, page); err != nil {
+		t.Fatalf("InsertBookList: %v", err)
+	}
+	found, err := repo.FindBookList(ctx, gen, query)
+	if err != nil {
+		t.Fatalf("FindBookList: %v", err)
+	}
+	if found.LastPage != page.LastPage || len(found.Books) != 1 {
+		t.Fatalf("FindBookList = %+v, want %+v", found, page)
+	}
+	assertBook(t, found.Books[0], page.Books[0])
+
+	if err = repo.InvalidateBookLists(ctx); err != nil {
+		t.Fatalf("InvalidateBookLists: %v", err)
+	}
+	next := generation(t, ctx, repo)
+	if next == gen {
+		t.Fatalf("BookListGeneration = %d after invalidation, want a new generation", next)
+	}
+	if _, err = repo.FindBookList(ctx, gen, query); !errors.Is(err, utils.ErrNotExist) {
+		t.Fatalf("FindBookList of the old generation = %v, want ErrNotExist", err)
+	}
+	if _, err = repo.FindBookList(ctx, next, query); !errors.Is(err, utils.ErrNotExist) {
+		t.Fatalf("FindBookList of the new generation = %v, want ErrNotExist", err)
+	}
+
+	// a page read before the invalidation is stored under the old
+	// generation and never served
+	if err = repo.InsertBookList(ctx, gen, query, page); err != nil {
+		t.Fatalf("InsertBookList: %v", err)
+	}
+	if _, err = repo.FindBookList(ctx, next, query); !errors.Is(err, utils.ErrNotExist) {
+		t.Fatalf("FindBookList after a late insert = %v, want ErrNotExist", err)
+	}
+}
+
+func testListPages(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	gen := generation(t, ctx, repo)
+	queries := []*entity.BookListQuery{
+		{Page: 1, Limit: 10},
+		{Page: 2, Limit: 10},
+		{Page: 1, Limit: 20},
+	}
+	for i, query := range queries {
+		page := &entity.PaginatedBooks{LastPage: i + 1}
+		if err := repo.InsertBookList(ctx, gen, query, page); err != nil {
+			t.Fatalf("InsertBookList(%+v): %v", query, err)
+		}
+	}
+	for i, query := range queries {
+		found, err := repo.FindBookList(ctx, gen, query)
+		if err != nil {
+			t.Fatalf("FindBookList(%+v): %v", query, err)
+		}
+		if found.LastPage != i+1 {
+			t.Fatalf("FindBookList(%+v).LastPage = %d, want %d", query, found.LastPage, i+1)
+		}
+	}
+}
+
+func testMissingBooks(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	isbn := "9780134190440"
+	assertMissing(t, ctx, repo, isbn, false)
+
+	if err := repo.InsertMissingBook(ctx, isbn, generation(t, ctx, repo)); err != nil {
+		t.Fatalf("InsertMissingBook: %v", err)
+	}
+	assertMissing(t, ctx, repo, isbn, true)
+	assertMissing(t, ctx, repo, "9780262033848", false)
+	// the negative entry is not a cached book
+	assertNotExist(t, ctx, repo, isbn)
+
+	if err := repo.DeleteMissingBook(ctx, isbn); err != nil {
+		t.Fatalf("DeleteMissingBook: %v", err)
+	}
+	assertMissing(t, ctx, repo, isbn, false)
+}
+
+// testMissingGeneration checks that a book created between the database
+// read and the negative entry is not hidden.
+func testMissingGeneration(t *testing.T, ctx context.Context, repo Repo, _ func(time.Duration)) {
+	isbn := "9780134190440"
+	gen := generation(t, ctx, repo)
+	if err := repo.InvalidateBookLists(ctx); err != nil {
+		t.Fatalf("InvalidateBookLists: %v", err)
+	}
+
+	if err := repo.InsertMissingBook(ctx, isbn, gen); err != nil {
+		t.Fatalf("InsertMissingBook: %v", err)
+	}
+	assertMissing(t, ctx, repo, isbn, false)
+
+	if err := repo.InsertMissingBook(ctx, isbn, generation(t, ctx, repo)); err != nil {
+		t.Fatalf("InsertMissingBook: %v", err)
+	}
+	assertMissing(t, ctx, repo, isbn, true)
+}
+
+func testBookExpiry(t *testing.T, ctx context.Context, repo Repo, advance func(time.Duration)) {
+	book := newBook("9780134190440")
+	mustInsert(t, ctx, repo, book)
+	assertBook(t, mustFind(t, ctx, repo, book.ISBN), book)
+
+	advance(2 * shortTTL)
+	assertNotExist(t, ctx, repo, book.ISBN)
+
+	// an expired entry no longer blocks the insert
+	book.Title = "Second Edition"
+	mustInsert(t, ctx, repo, book)
+	assertBook(t, mustFind(t, ctx, repo, book.ISBN), book)
+}
+
+func testListExpiry(t *testing.T, ctx context.Context, repo Repo, advance func(time.Duration)) {
+	gen := generation(t, ctx, repo)
+	query := &entity.BookListQuery{Page: 1, Limit: 10}
+	if err := repo.InsertBookList(ctx, gen, query, &entity.PaginatedBooks{LastPage: 1}); err != nil {
+		t.Fatalf("InsertBookList: %v", err)
+	}
+
+	advance(2 * shortTTL)
+	if _, err := repo.FindBookList(ctx, gen, query); !errors.Is(err, utils.ErrNotExist) {
+		t.Fatalf("FindBookList after expiry = %v, want ErrNotExist", err)
+	}
+}
+
+func testMissingExpiry(t *testing.T, ctx context.Context, repo Repo, advance func(time.Duration)) {
+	isbn := "9780134190440"
+	book := newBook("9780262033848")
+	mustInsert(t, ctx, repo, book)
+	if err := repo.InsertMissingBook(ctx, isbn, generation(t, ctx, repo)); err != nil {
+		t.Fatalf("InsertMissingBook: %v", err)
+	}
+
+	advance(2 * shortTTL)
+	assertMissing(t, ctx, repo, isbn, false)
+	// books keep their own TTL
+	assertBook(t, mustFind(t, ctx, repo, book.ISBN), book)
+}
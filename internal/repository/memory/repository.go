@@ -0,0 +1,251 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/ttlcache"
+	"template/pkg/validator"
+	"time"
+)
+
+// MemoryRepo keeps what RedisRepo keeps in Redis in process, for
+// deployments running a single replica without Redis. Entries are evicted
+// least recently used first once maxEntries is reached, which also bounds
+// the login attempts and locks a client spraying usernames can create.
+type MemoryRepo struct {
+	// mu makes the read-modify-write operations atomic, the caches are
+	// safe for concurrent use on their own
+	mu sync.Mutex
+
+	books          *ttlcache.Cache[string, entity.Book]
+	missingBooks   *ttlcache.Cache[string, struct{}]
+	bookLists      *ttlcache.Cache[string, entity.PaginatedBooks]
+	listGeneration int64
+
+	attempts   *ttlcache.Cache[string, attempts]
+	locks      *ttlcache.Cache[string, time.Time]
+	oidcStates *ttlcache.Cache[string, entity.OIDCState]
+}
+
+type attempts struct {
+	count     int64
+	expiresAt time.Time
+}
+
+func NewMemoryRepo(ttl, negativeTTL time.Duration, maxEntries int) *MemoryRepo {
+	return &MemoryRepo{
+		books:        ttlcache.New[string, entity.Book](ttl, maxEntries),
+		missingBooks: ttlcache.New[string, struct{}](negativeTTL, maxEntries),
+		bookLists:    ttlcache.New[string, entity.PaginatedBooks](ttl, maxEntries),
+		attempts:     ttlcache.New[string, attempts](0, maxEntries),
+		locks:        ttlcache.New[string, time.Time](0, maxEntries),
+		oidcStates:   ttlcache.New[string, entity.OIDCState](0, maxEntries),
+	}
+}
+
+func (r *MemoryRepo) InsertBook(_ context.Context, book *entity.Book) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.books.Get(book.ISBN); !ok {
+		r.books.Set(book.ISBN, copyBook(book))
+	}
+	return nil
+}
+
+func (r *MemoryRepo) FindBookByISBN(_ context.Context, id string) (*entity.Book, error) {
+	book, ok := r.books.Get(id)
+	if !ok {
+		return nil, utils.ErrNotExist
+	}
+	book = copyBook(&book)
+	return &book, nil
+}
+
+func (r *MemoryRepo) UpdateBookByISBN(_ context.Context, form *entity.BookFormUpdate) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	book, ok := r.books.Get(form.ISBN)
+	if !ok {
+		return utils.ErrNotExist
+	}
+
+	book = copyBook(&book)
+	if validator.MinChars(form.Title, 1) {
+		book.Title = form.Title
+	}
+	if validator.MinChars(form.Publisher, 1) {
+		book.Publisher = form.Publisher
+	}
+	if validator.CheckArr(form.Author) {
+		book.Author = append([]string(nil), form.Author...)
+	}
+	book.UpdatedAt = form.UpdatedAt
+	if book.UpdatedAt.IsZero() {
+		book.UpdatedAt = time.Now()
+	}
+
+	r.books.Set(form.ISBN, book)
+	return nil
+}
+
+func (r *MemoryRepo) DeleteBookByISBN(_ context.Context, id string) error {
+	r.books.Delete(id)
+	return nil
+}
+
+func (r *MemoryRepo) IsBookMissing(_ context.Context, id string) (bool, error) {
+	_, ok := r.missingBooks.Get(id)
+	return ok, nil
+}
+
+// InsertMissingBook is skipped when a create started a new generation
+// since the database was read.
+func (r *MemoryRepo) InsertMissingBook(_ context.Context, id string, generation int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.listGeneration == generation {
+		r.missingBooks.Set(id, struct{}{})
+	}
+	return nil
+}
+
+func (r *MemoryRepo) DeleteMissingBook(_ context.Context, id string) error {
+	r.missingBooks.Delete(id)
+	return nil
+}
+
+// BookCacheUsage only counts the books, their memory is not tracked.
+func (r *MemoryRepo) BookCacheUsage(_ context.Context) (*entity.BookCacheUsage, error) {
+	return &entity.BookCacheUsage{Keys: int64(r.books.Len() + r.missingBooks.Len())}, nil
+}
+
+func (r *MemoryRepo) FlushBooks(_ context.Context) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	flushed := r.books.Len() + r.missingBooks.Len()
+	r.books.Clear()
+	r.missingBooks.Clear()
+	return flushed, nil
+}
+
+// ScanCachedBooks returns every entry at once, entries expire with their
+// key here so none is ever gone.
+func (r *MemoryRepo) ScanCachedBooks(_ context.Context, _ uint64) ([]*entity.CachedBook, uint64, error) {
+	var books []*entity.CachedBook
+	for _, isbn := range r.books.Keys() {
+		if book, ok := r.books.Get(isbn); ok {
+			book = copyBook(&book)
+			books = append(books, &entity.CachedBook{ISBN: isbn, Book: &book})
+		}
+	}
+	for _, isbn := range r.missingBooks.Keys() {
+		books = append(books, &entity.CachedBook{ISBN: isbn, NotFound: true})
+	}
+	return books, 0, nil
+}
+
+// copyBook keeps callers from changing cached books through the author
+// slice.
+func copyBook(book *entity.Book) entity.Book {
+	res := *book
+	res.Author = append([]string(nil), book.Author...)
+	return res
+}
+
+func bookListKey(generation int64, query *entity.BookListQuery) string {
+	return fmt.Sprintf("%d:page=%d:limit=%d", generation, query.Page, query.Limit)
+}
+
+func (r *MemoryRepo) BookListGeneration(_ context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.listGeneration, nil
+}
+
+func (r *MemoryRepo) FindBookList(_ context.Context, generation int64, query *entity.BookListQuery) (*entity.PaginatedBooks, error) {
+	books, ok := r.bookLists.Get(bookListKey(generation, query))
+	if !ok {
+		return nil, utils.ErrNotExist
+	}
+	return &books, nil
+}
+
+func (r *MemoryRepo) InsertBookList(_ context.Context, generation int64, query *entity.BookListQuery, books *entity.PaginatedBooks) error {
+	r.bookLists.Set(bookListKey(generation, query), *books)
+	return nil
+}
+
+// InvalidateBookLists starts a new generation and drops the pages of the
+// previous ones, so a reader still holding the old generation misses like
+// it does with RedisRepo.
+func (r *MemoryRepo) InvalidateBookLists(_ context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.listGeneration++
+	r.bookLists.Clear()
+	return nil
+}
+
+func (r *MemoryRepo) IncrAttempts(_ context.Context, subject string, window time.Duration) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	a, ok := r.attempts.Get(subject)
+	if !ok {
+		a = attempts{expiresAt: time.Now().Add(window)}
+	}
+	a.count++
+	r.attempts.SetTTL(subject, a, time.Until(a.expiresAt))
+	return a.count, nil
+}
+
+func (r *MemoryRepo) ResetAttempts(_ context.Context, subject string) error {
+	r.attempts.Delete(subject)
+	return nil
+}
+
+func (r *MemoryRepo) Lock(_ context.Context, subject string, ttl time.Duration) error {
+	r.locks.SetTTL(subject, time.Now().Add(ttl), ttl)
+	return nil
+}
+
+func (r *MemoryRepo) LockTTL(_ context.Context, subject string) (time.Duration, error) {
+	until, ok := r.locks.Get(subject)
+	if !ok {
+		return 0, nil
+	}
+	return max(time.Until(until), 0), nil
+}
+
+func (r *MemoryRepo) Unlock(_ context.Context, subject string) error {
+	r.locks.Delete(subject)
+	r.attempts.Delete(subject)
+	return nil
+}
+
+func (r *MemoryRepo) SaveOIDCState(_ context.Context, state string, data *entity.OIDCState, ttl time.Duration) error {
+	r.oidcStates.SetTTL(state, *data, ttl)
+	return nil
+}
+
+// TakeOIDCState returns and deletes the state, so each one is used once.
+func (r *MemoryRepo) TakeOIDCState(_ context.Context, state string) (*entity.OIDCState, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	data, ok := r.oidcStates.Get(state)
+	if !ok {
+		return nil, utils.ErrNotExist
+	}
+	r.oidcStates.Delete(state)
+	return &data, nil
+}
@@ -0,0 +1,14 @@
+package memory
+
+import (
+	"template/internal/repository/cachetest"
+	"testing"
+	"time"
+)
+
+func TestBookCache(t *testing.T) {
+	cachetest.Run(t, func(t *testing.T, ttl, negativeTTL time.Duration) (cachetest.Repo, func(time.Duration)) {
+		// the caches read the wall clock
+		return NewMemoryRepo(ttl, negativeTTL, 100), time.Sleep
+	})
+}
@@ -0,0 +1,108 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"template/internal/entity"
+	"template/internal/utils"
+	"time"
+)
+
+func (r *MongoRepo) CreateAPIKey(ctx context.Context, key *entity.APIKey) (interface{}, error) {
+	res, err := r.apiKeysCollection.InsertOne(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	return res.InsertedID, nil
+}
+
+// ListAPIKeys lists the service keys, personal access tokens are listed by
+// ListUserAPIKeys.
+func (r *MongoRepo) ListAPIKeys(ctx context.Context) ([]*entity.APIKey, error) {
+	return r.listAPIKeys(ctx, bson.M{"userId": bson.M{"$exists": false}})
+}
+
+func (r *MongoRepo) ListUserAPIKeys(ctx context.Context, userID string) ([]*entity.APIKey, error) {
+	return r.listAPIKeys(ctx, bson.M{"userId": userID})
+}
+
+func (r *MongoRepo) listAPIKeys(ctx context.Context, filter bson.M) ([]*entity.APIKey, error) {
+	findOptions := options.Find().SetSort(bson.M{"createdAt": -1})
+	cursor, err := r.apiKeysCollection.Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch api keys: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	keys := make([]*entity.APIKey, 0)
+	if err = cursor.All(ctx, &keys); err != nil {
+		return nil, fmt.Errorf("failed to decode api keys: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (r *MongoRepo) GetAPIKeyByHash(ctx context.Context, hashedKey string) (*entity.APIKey, error) {
+	var key entity.APIKey
+	err := r.apiKeysCollection.FindOne(ctx, bson.M{"hashedKey": hashedKey}).Decode(&key)
+	switch {
+	case err == nil:
+		return &key, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrNotExist
+	default:
+		return nil, err
+	}
+}
+
+func (r *MongoRepo) RevokeAPIKey(ctx context.Context, id string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return utils.ErrNotExist
+	}
+
+	return r.revokeAPIKey(ctx, bson.M{"_id": objectID})
+}
+
+// RevokeUserAPIKey revokes a personal access token of the user.
+func (r *MongoRepo) RevokeUserAPIKey(ctx context.Context, id, userID string) error {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return utils.ErrNotExist
+	}
+
+	return r.revokeAPIKey(ctx, bson.M{"_id": objectID, "userId": userID})
+}
+
+// DeleteUserAPIKeys removes all personal access tokens of the user.
+func (r *MongoRepo) DeleteUserAPIKeys(ctx context.Context, userID string) error {
+	_, err := r.apiKeysCollection.DeleteMany(ctx, bson.M{"userId": userID})
+
+	return err
+}
+
+func (r *MongoRepo) revokeAPIKey(ctx context.Context, filter bson.M) error {
+	filter["revokedAt"] = bson.M{"$exists": false}
+	result, err := r.apiKeysCollection.UpdateOne(ctx, filter,
+		bson.M{"$set": bson.M{"revokedAt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrNotExist
+	}
+
+	return nil
+}
+
+func (r *MongoRepo) TouchAPIKey(ctx context.Context, id primitive.ObjectID, usedAt time.Time) error {
+	_, err := r.apiKeysCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"lastUsedAt": usedAt}})
+
+	return err
+}
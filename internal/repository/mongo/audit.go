@@ -0,0 +1,16 @@
+package mongo
+
+import (
+	"context"
+	"template/internal/entity"
+	"time"
+)
+
+func (r *MongoRepo) InsertAuditRecord(ctx context.Context, record *entity.AuditRecord) error {
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now()
+	}
+	_, err := r.auditCollection.InsertOne(ctx, record)
+
+	return err
+}
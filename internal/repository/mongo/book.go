@@ -49,7 +49,7 @@ func (r *MongoRepo) ListBook(ctx context.Context, page, pageSize int) (*entity.P
 
 	lastPage := int(math.Ceil(float64(totalCount) / float64(pageSize)))
 	if lastPage == 0 {
-		return &entity.PaginatedBooks{nil, 0}, nil
+		return &entity.PaginatedBooks{}, nil
 	}
 	if page > lastPage {
 		return nil, fmt.Errorf("the last page is %d: %w", lastPage, utils.ErrBadInput)
@@ -89,7 +89,11 @@ func (r *MongoRepo) ListBook(ctx context.Context, page, pageSize int) (*entity.P
 func (r *MongoRepo) UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error {
 	updateQuery := bson.M{}
 
-	updateQuery["updatedAt"] = time.Now()
+	// the cache is updated with the same time
+	updateQuery["updatedAt"] = book.UpdatedAt
+	if book.UpdatedAt.IsZero() {
+		updateQuery["updatedAt"] = time.Now()
+	}
 
 	if validator.MinChars(book.Title, 1) {
 		updateQuery["title"] = book.Title
@@ -125,3 +129,30 @@ func (r *MongoRepo) DeleteBookByISBN(ctx context.Context, id string) error {
 	}
 	return nil
 }
+
+func (r *MongoRepo) GetBooksByISBN(ctx context.Context, ids []string) ([]*entity.Book, error) {
+	return r.findBooks(ctx, bson.M{"_id": bson.M{"$in": ids}}, options.Find())
+}
+
+// ListRecentBooks returns the most recently updated books, followed by the
+// books never updated, newest first.
+func (r *MongoRepo) ListRecentBooks(ctx context.Context, limit int) ([]*entity.Book, error) {
+	opts := options.Find().
+		SetSort(bson.D{{"updatedAt", -1}, {"createdAt", -1}}).
+		SetLimit(int64(limit))
+	return r.findBooks(ctx, bson.M{}, opts)
+}
+
+func (r *MongoRepo) findBooks(ctx context.Context, filter interface{}, opts *options.FindOptions) ([]*entity.Book, error) {
+	cursor, err := r.booksCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch books: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var books []*entity.Book
+	if err = cursor.All(ctx, &books); err != nil {
+		return nil, fmt.Errorf("failed to decode books: %w", err)
+	}
+	return books, nil
+}
@@ -0,0 +1,67 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"template/internal/entity"
+	"template/internal/utils"
+	"time"
+)
+
+func (r *MongoRepo) CreatePasswordReset(ctx context.Context, reset *entity.PasswordReset) error {
+	_, err := r.resetsCollection.InsertOne(ctx, reset)
+
+	return err
+}
+
+// GetPasswordReset returns a usable token without consuming it.
+func (r *MongoRepo) GetPasswordReset(ctx context.Context, tokenHash string) (*entity.PasswordReset, error) {
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": time.Now()},
+	}
+
+	var reset entity.PasswordReset
+	err := r.resetsCollection.FindOne(ctx, filter).Decode(&reset)
+	switch {
+	case err == nil:
+		return &reset, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrInvalidResetToken
+	default:
+		return nil, err
+	}
+}
+
+// ConsumePasswordReset marks the token as used and returns it. A token can
+// only be consumed once and only before it expires.
+func (r *MongoRepo) ConsumePasswordReset(ctx context.Context, tokenHash string) (*entity.PasswordReset, error) {
+	now := time.Now()
+	filter := bson.M{
+		"tokenHash": tokenHash,
+		"usedAt":    bson.M{"$exists": false},
+		"expiresAt": bson.M{"$gt": now},
+	}
+
+	var reset entity.PasswordReset
+	err := r.resetsCollection.FindOneAndUpdate(ctx, filter, bson.M{"$set": bson.M{"usedAt": now}}).Decode(&reset)
+	switch {
+	case err == nil:
+		reset.UsedAt = &now
+		return &reset, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrInvalidResetToken
+	default:
+		return nil, err
+	}
+}
+
+func (r *MongoRepo) DeletePasswordResets(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.resetsCollection.DeleteMany(ctx, bson.M{"userId": userID})
+
+	return err
+}
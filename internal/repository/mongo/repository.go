@@ -1,15 +1,99 @@
 package mongo
 
-import "go.mongodb.org/mongo-driver/mongo"
+import (
+	"context"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"template/internal/config"
+	"template/internal/entity"
+)
 
 type MongoRepo struct {
-	usersCollection *mongo.Collection
-	booksCollection *mongo.Collection
+	usersCollection    *mongo.Collection
+	booksCollection    *mongo.Collection
+	apiKeysCollection  *mongo.Collection
+	auditCollection    *mongo.Collection
+	resetsCollection   *mongo.Collection
+	settingsCollection *mongo.Collection
 }
 
-func NewRepoMongo(usersCollection *mongo.Collection, booksCollection *mongo.Collection) *MongoRepo {
+func NewRepoMongo(db *mongo.Database, cfg *config.Mongo) *MongoRepo {
 	return &MongoRepo{
-		usersCollection: usersCollection,
-		booksCollection: booksCollection,
+		usersCollection:    db.Collection(cfg.UsersCollection),
+		booksCollection:    db.Collection(cfg.BooksCollection),
+		apiKeysCollection:  db.Collection(cfg.APIKeysCollection),
+		auditCollection:    db.Collection(cfg.AuditCollection),
+		resetsCollection:   db.Collection(cfg.ResetsCollection),
+		settingsCollection: db.Collection(cfg.SettingsCollection),
 	}
 }
+
+// EnsureIndexes creates the indexes the repository relies on.
+func (r *MongoRepo) EnsureIndexes(ctx context.Context) error {
+	_, err := r.usersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.M{"username": 1}, // index key ascending
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, provider := range []string{entity.ProviderOIDC, entity.ProviderLDAP, entity.ProviderSCIM} {
+		_, err = r.usersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+			Keys: bson.M{"externalIds." + provider: 1},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"externalIds." + provider: bson.M{"$exists": true}}),
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = r.usersCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys: bson.M{"email": 1},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"email": bson.M{"$type": "string"}}),
+		},
+		{
+			Keys:    bson.M{"emailVerification.tokenHash": 1},
+			Options: options.Index().SetSparse(true),
+		},
+		{
+			Keys:    bson.M{"session.tokenHash": 1},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.apiKeysCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.M{"hashedKey": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			Keys:    bson.M{"userId": 1},
+			Options: options.Index().SetSparse(true),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = r.resetsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.M{"tokenHash": 1},
+			Options: options.Index().SetUnique(true),
+		},
+		{
+			// expired tokens are removed by mongo
+			Keys:    bson.M{"expiresAt": 1},
+			Options: options.Index().SetExpireAfterSeconds(0),
+		},
+	})
+
+	return err
+}
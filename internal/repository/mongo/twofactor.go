@@ -0,0 +1,105 @@
+package mongo
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"template/internal/entity"
+	"template/internal/utils"
+	"time"
+)
+
+const twoFactorPolicyID = "twoFactorPolicy"
+
+// SetTwoFactorSecret stores a pending enrollment. It fails with
+// utils.ErrTwoFactorEnabled when the user already confirmed one.
+func (r *MongoRepo) SetTwoFactorSecret(ctx context.Context, userID primitive.ObjectID, secret string) error {
+	result, err := r.usersCollection.UpdateOne(ctx,
+		bson.M{"_id": userID, "twoFactor.enabled": bson.M{"$ne": true}},
+		bson.M{"$set": bson.M{"twoFactor": entity.TwoFactor{Secret: secret}}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func (r *MongoRepo) EnableTwoFactor(ctx context.Context, userID primitive.ObjectID, step int64, recoveryCodes []string) error {
+	result, err := r.usersCollection.UpdateOne(ctx,
+		bson.M{"_id": userID, "twoFactor.enabled": false},
+		bson.M{"$set": bson.M{
+			"twoFactor.enabled":       true,
+			"twoFactor.lastStep":      step,
+			"twoFactor.recoveryCodes": recoveryCodes,
+			"twoFactor.enabledAt":     time.Now(),
+		}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrTwoFactorEnabled
+	}
+	return nil
+}
+
+func (r *MongoRepo) DisableTwoFactor(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$unset": bson.M{"twoFactor": ""}})
+
+	return err
+}
+
+// UseTwoFactorStep records step as the last accepted code. A code from the
+// same or an earlier step is rejected, so codes cannot be replayed.
+func (r *MongoRepo) UseTwoFactorStep(ctx context.Context, userID primitive.ObjectID, step int64) error {
+	result, err := r.usersCollection.UpdateOne(ctx,
+		bson.M{"_id": userID, "twoFactor.lastStep": bson.M{"$lt": step}},
+		bson.M{"$set": bson.M{"twoFactor.lastStep": step}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrInvalidCode
+	}
+	return nil
+}
+
+// UseRecoveryCode removes the hashed recovery code, it can be used once.
+func (r *MongoRepo) UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, codeHash string) error {
+	result, err := r.usersCollection.UpdateOne(ctx,
+		bson.M{"_id": userID, "twoFactor.recoveryCodes": codeHash},
+		bson.M{"$pull": bson.M{"twoFactor.recoveryCodes": codeHash}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrInvalidCode
+	}
+	return nil
+}
+
+func (r *MongoRepo) GetTwoFactorPolicy(ctx context.Context) (*entity.TwoFactorPolicy, error) {
+	var policy entity.TwoFactorPolicy
+	err := r.settingsCollection.FindOne(ctx, bson.M{"_id": twoFactorPolicyID}).Decode(&policy)
+	switch {
+	case err == nil:
+		return &policy, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return &entity.TwoFactorPolicy{RequiredRoles: []int{}}, nil
+	default:
+		return nil, err
+	}
+}
+
+func (r *MongoRepo) SetTwoFactorPolicy(ctx context.Context, policy *entity.TwoFactorPolicy) error {
+	_, err := r.settingsCollection.UpdateOne(ctx,
+		bson.M{"_id": twoFactorPolicyID},
+		bson.M{"$set": policy},
+		options.Update().SetUpsert(true))
+
+	return err
+}
@@ -7,6 +7,10 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+	"math"
+	"regexp"
+	"strings"
 	"template/internal/entity"
 	"template/internal/utils"
 	"template/pkg/mongodb"
@@ -56,11 +60,11 @@ func (r *MongoRepo) GetByCredentials(ctx context.Context, username, password str
 	return user, nil
 }
 
-func (r *MongoRepo) GetByRefreshToken(ctx context.Context, refreshToken string) (entity.User, error) {
+func (r *MongoRepo) GetByRefreshToken(ctx context.Context, tokenHash string) (entity.User, error) {
 	var user entity.User
 	if err := r.usersCollection.FindOne(ctx, bson.M{
-		"session.refreshToken": refreshToken,
-		"session.expiresAt":    bson.M{"$gt": time.Now()},
+		"session.tokenHash":  tokenHash,
+		"session.expires_at": bson.M{"$gt": time.Now()},
 	}).Decode(&user); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return entity.User{}, utils.ErrUserNotFound
@@ -77,3 +81,350 @@ func (r *MongoRepo) SetSession(ctx context.Context, userID primitive.ObjectID, s
 
 	return err
 }
+
+func (r *MongoRepo) GetUserByUsername(ctx context.Context, username string) (*entity.User, error) {
+	var user entity.User
+	err := r.usersCollection.FindOne(ctx, bson.M{"username": username}).Decode(&user)
+	switch {
+	case err == nil:
+		return &user, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrUserNotFound
+	default:
+		return nil, err
+	}
+}
+
+func (r *MongoRepo) UpdatePassword(ctx context.Context, userID primitive.ObjectID, passwordHash string) error {
+	result, err := r.usersCollection.UpdateOne(ctx, bson.M{"_id": userID},
+		bson.M{"$set": bson.M{"password": passwordHash, "passwordChangedAt": time.Now()}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *MongoRepo) RevokeSessions(ctx context.Context, userID primitive.ObjectID) error {
+	_, err := r.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$unset": bson.M{"session": ""}})
+
+	return err
+}
+
+func (r *MongoRepo) GetUserByExternalID(ctx context.Context, provider, subject string) (*entity.User, error) {
+	var user entity.User
+	err := r.usersCollection.FindOne(ctx, bson.M{"externalIds." + provider: subject}).Decode(&user)
+	switch {
+	case err == nil:
+		return &user, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrUserNotFound
+	default:
+		return nil, err
+	}
+}
+
+// SyncExternalUser updates the attributes owned by the identity provider.
+// Empty values and a nil role are left untouched.
+func (r *MongoRepo) SyncExternalUser(ctx context.Context, userID primitive.ObjectID, ext *entity.ExternalIdentity) error {
+	set := bson.M{}
+	if ext.Email != "" {
+		set["email"] = ext.Email
+	}
+	if ext.DisplayName != "" {
+		set["displayName"] = ext.DisplayName
+	}
+	if ext.Role != nil {
+		set["role"] = *ext.Role
+	}
+	if len(set) == 0 {
+		return nil
+	}
+
+	_, err := r.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, bson.M{"$set": set})
+
+	return err
+}
+
+func (r *MongoRepo) UpdateProfile(ctx context.Context, userID primitive.ObjectID, update *entity.ProfileUpdate) (*entity.User, error) {
+	set := bson.M{}
+	if update.DisplayName != nil {
+		set["displayName"] = *update.DisplayName
+	}
+	doc := bson.M{}
+	if update.Notifications != nil {
+		set["notifications"] = *update.Notifications
+	}
+	if update.Email != nil {
+		// a new address has to be verified again
+		set["email"] = *update.Email
+		doc["$unset"] = bson.M{"emailVerified": "", "emailVerification": ""}
+	}
+
+	var user entity.User
+	var err error
+	if len(set) == 0 {
+		err = r.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	} else {
+		doc["$set"] = set
+		err = r.usersCollection.FindOneAndUpdate(ctx, bson.M{"_id": userID}, doc,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	}
+	switch {
+	case err == nil:
+		return &user, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrUserNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return nil, utils.ErrEmailAlreadyExists
+	default:
+		return nil, err
+	}
+}
+
+func (r *MongoRepo) DeleteUser(ctx context.Context, userID primitive.ObjectID) error {
+	result, err := r.usersCollection.DeleteOne(ctx, bson.M{"_id": userID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return utils.ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *MongoRepo) ListUsers(ctx context.Context, filter *entity.UserFilter, page, pageSize int) (*entity.PaginatedUsers, error) {
+	query := userQuery(filter)
+
+	totalCount, err := r.usersCollection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count documents: %v", err)
+	}
+
+	lastPage := int(math.Ceil(float64(totalCount) / float64(pageSize)))
+	if lastPage == 0 {
+		return &entity.PaginatedUsers{Users: []*entity.User{}}, nil
+	}
+	if page > lastPage {
+		return nil, fmt.Errorf("the last page is %d: %w", lastPage, utils.ErrBadInput)
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.M{"username": 1}).
+		SetSkip(int64((page - 1) * pageSize)).
+		SetLimit(int64(pageSize))
+
+	cursor, err := r.usersCollection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch documents: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := make([]*entity.User, 0, pageSize)
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, fmt.Errorf("failed to decode documents: %v", err)
+	}
+
+	return &entity.PaginatedUsers{Users: users, LastPage: lastPage}, nil
+}
+
+// FindUsers returns up to limit users matching filter after skipping
+// skip of them, along with the number of matching users. A limit of 0
+// returns all of them.
+func (r *MongoRepo) FindUsers(ctx context.Context, filter *entity.UserFilter, skip, limit int) ([]*entity.User, int, error) {
+	query := userQuery(filter)
+
+	totalCount, err := r.usersCollection.CountDocuments(ctx, query)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to count documents: %v", err)
+	}
+
+	findOptions := options.Find().
+		SetSort(bson.M{"_id": 1}).
+		SetSkip(int64(skip)).
+		SetLimit(int64(limit))
+
+	cursor, err := r.usersCollection.Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to fetch documents: %v", err)
+	}
+	defer cursor.Close(ctx)
+
+	users := make([]*entity.User, 0, limit)
+	if err = cursor.All(ctx, &users); err != nil {
+		return nil, 0, fmt.Errorf("failed to decode documents: %v", err)
+	}
+
+	return users, int(totalCount), nil
+}
+
+func userQuery(filter *entity.UserFilter) bson.M {
+	query := bson.M{}
+	if filter.Query != "" {
+		prefix := primitive.Regex{Pattern: "^" + regexp.QuoteMeta(filter.Query), Options: "i"}
+		query["$or"] = bson.A{bson.M{"username": prefix}, bson.M{"email": prefix}}
+	}
+	if filter.Username != "" {
+		query["username"] = filter.Username
+	}
+	if filter.Provider != "" {
+		query["externalIds."+filter.Provider] = filter.Subject
+	}
+	if filter.Role != nil {
+		query["role"] = *filter.Role
+	}
+	if filter.Disabled != nil {
+		if *filter.Disabled {
+			query["disabled"] = true
+		} else {
+			query["disabled"] = bson.M{"$ne": true}
+		}
+	}
+	return query
+}
+
+// UpdateProvisionedUser applies the changes of a provisioning client. The
+// client is the source of truth for the email, so a new address counts as
+// verified.
+func (r *MongoRepo) UpdateProvisionedUser(ctx context.Context, userID primitive.ObjectID, update *entity.ProvisionedUpdate) (*entity.User, error) {
+	set, unset := bson.M{}, bson.M{}
+	if update.Username != nil {
+		set["username"] = *update.Username
+	}
+	if update.DisplayName != nil {
+		set["displayName"] = *update.DisplayName
+	}
+	if update.Email != nil {
+		set["email"] = *update.Email
+		set["emailVerified"] = true
+		unset["emailVerification"] = ""
+	}
+	if update.Disabled != nil {
+		if *update.Disabled {
+			set["disabled"] = true
+			unset["session"] = ""
+		} else {
+			unset["disabled"] = ""
+		}
+	}
+	if update.ExternalID != nil {
+		set["externalIds."+entity.ProviderSCIM] = *update.ExternalID
+	}
+
+	doc := bson.M{}
+	if len(set) > 0 {
+		doc["$set"] = set
+	}
+	if len(unset) > 0 {
+		doc["$unset"] = unset
+	}
+
+	var user entity.User
+	var err error
+	if len(doc) == 0 {
+		err = r.usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	} else {
+		err = r.usersCollection.FindOneAndUpdate(ctx, bson.M{"_id": userID}, doc,
+			options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	}
+	switch {
+	case err == nil:
+		return &user, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrUserNotFound
+	case mongo.IsDuplicateKeyError(err) && strings.Contains(err.Error(), "email"):
+		return nil, utils.ErrEmailAlreadyExists
+	case mongo.IsDuplicateKeyError(err):
+		return nil, utils.ErrUserAlreadyExists
+	default:
+		return nil, err
+	}
+}
+
+func (r *MongoRepo) SetUserRole(ctx context.Context, userID primitive.ObjectID, role int) error {
+	return r.updateUser(ctx, userID, bson.M{"$set": bson.M{"role": role}})
+}
+
+// SetUserDisabled disables or enables the account. Disabling also drops
+// the refresh session.
+func (r *MongoRepo) SetUserDisabled(ctx context.Context, userID primitive.ObjectID, disabled bool) error {
+	if disabled {
+		return r.updateUser(ctx, userID, bson.M{"$set": bson.M{"disabled": true}, "$unset": bson.M{"session": ""}})
+	}
+	return r.updateUser(ctx, userID, bson.M{"$unset": bson.M{"disabled": ""}})
+}
+
+// ClearPassword removes the password, so the account can only be used
+// again after a reset. Access tokens issued before are rejected like after
+// a password change.
+func (r *MongoRepo) ClearPassword(ctx context.Context, userID primitive.ObjectID) error {
+	return r.updateUser(ctx, userID, bson.M{"$set": bson.M{"password": "", "passwordChangedAt": time.Now()}, "$unset": bson.M{"session": ""}})
+}
+
+func (r *MongoRepo) updateUser(ctx context.Context, userID primitive.ObjectID, update bson.M) error {
+	result, err := r.usersCollection.UpdateOne(ctx, bson.M{"_id": userID}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrUserNotFound
+	}
+	return nil
+}
+
+// GetUserByEmail matches the normalized address, see validator.NormalizeEmail.
+func (r *MongoRepo) GetUserByEmail(ctx context.Context, email string) (*entity.User, error) {
+	var user entity.User
+	err := r.usersCollection.FindOne(ctx, bson.M{"email": strings.ToLower(email)}).Decode(&user)
+	switch {
+	case err == nil:
+		return &user, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrUserNotFound
+	default:
+		return nil, err
+	}
+}
+
+// SetEmailVerification stores a new verification token unless the previous
+// one was sent after notSentAfter, in which case ErrTooManyAttempts is
+// returned. This keeps concurrent resends within the cooldown.
+func (r *MongoRepo) SetEmailVerification(ctx context.Context, userID primitive.ObjectID, verification *entity.EmailVerification, notSentAfter time.Time) error {
+	result, err := r.usersCollection.UpdateOne(ctx, bson.M{
+		"_id": userID,
+		"$or": bson.A{
+			bson.M{"emailVerification": bson.M{"$exists": false}},
+			bson.M{"emailVerification.sentAt": bson.M{"$lte": notSentAfter}},
+		},
+	}, bson.M{"$set": bson.M{"emailVerification": verification}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return utils.ErrTooManyAttempts
+	}
+	return nil
+}
+
+// VerifyEmail marks the email of the user holding the token as verified
+// and drops the token.
+func (r *MongoRepo) VerifyEmail(ctx context.Context, tokenHash string) (*entity.User, error) {
+	var user entity.User
+	err := r.usersCollection.FindOneAndUpdate(ctx, bson.M{
+		"emailVerification.tokenHash": tokenHash,
+		"emailVerification.expiresAt": bson.M{"$gt": time.Now()},
+	}, bson.M{
+		"$set":   bson.M{"emailVerified": true},
+		"$unset": bson.M{"emailVerification": ""},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&user)
+	switch {
+	case err == nil:
+		return &user, nil
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return nil, utils.ErrInvalidVerifyToken
+	default:
+		return nil, err
+	}
+}
@@ -0,0 +1,142 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"template/internal/entity"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// memorySampleSize bounds the MEMORY USAGE calls of one stats request
+	memorySampleSize = 100
+	// scanBatchSize is the SSCAN count hint used when flushing
+	scanBatchSize = 500
+)
+
+// BookCacheUsage counts the books set and estimates the memory of the
+// cached books from the first keys SSCAN returns. Members whose key has
+// expired are counted until the book is deleted or the cache flushed.
+func (r *RedisRepo) BookCacheUsage(ctx context.Context) (*entity.BookCacheUsage, error) {
+	keys, err := r.client.SCard(ctx, booksSetKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to count books: %w", err)
+	}
+	usage := &entity.BookCacheUsage{Keys: keys}
+	if keys == 0 {
+		return usage, nil
+	}
+
+	sample, _, err := r.client.SScan(ctx, booksSetKey, 0, "", memorySampleSize).Result()
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan books: %w", err)
+	}
+	if len(sample) > memorySampleSize {
+		sample = sample[:memorySampleSize]
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.IntCmd, len(sample))
+	for i, key := range sample {
+		cmds[i] = pipe.MemoryUsage(ctx, key)
+	}
+	// keys that expired since they were added answer nil
+	if _, err = pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("failed to get memory usage: %w", err)
+	}
+
+	var total int64
+	for _, cmd := range cmds {
+		if n, err := cmd.Result(); err == nil {
+			total += n
+			usage.Sampled++
+		}
+	}
+	if usage.Sampled > 0 {
+		usage.MemoryBytes = total / int64(usage.Sampled) * keys
+	}
+	return usage, nil
+}
+
+// FlushBooks deletes every cached book, walking the books set with SSCAN
+// so neither Redis nor other keys of the database are affected, and
+// returns how many were deleted. Cached pages are left to
+// InvalidateBookLists.
+func (r *RedisRepo) FlushBooks(ctx context.Context) (int, error) {
+	var (
+		cursor  uint64
+		flushed int
+	)
+	for {
+		keys, next, err := r.client.SScan(ctx, booksSetKey, cursor, "", scanBatchSize).Result()
+		if err != nil {
+			return flushed, fmt.Errorf("failed to scan books: %w", err)
+		}
+
+		if len(keys) > 0 {
+			members := make([]interface{}, len(keys))
+			for i, key := range keys {
+				members[i] = key
+			}
+			txn := r.client.TxPipeline()
+			del := txn.Del(ctx, keys...)
+			txn.SRem(ctx, booksSetKey, members...)
+			if _, err = txn.Exec(ctx); err != nil {
+				return flushed, fmt.Errorf("failed to delete books: %w", err)
+			}
+			flushed += int(del.Val())
+		}
+
+		if next == 0 {
+			return flushed, nil
+		}
+		cursor = next
+	}
+}
+
+// ScanCachedBooks returns one SSCAN batch of the books set with the
+// entries behind it, and the cursor of the next batch, zero at the end.
+func (r *RedisRepo) ScanCachedBooks(ctx context.Context, cursor uint64) ([]*entity.CachedBook, uint64, error) {
+	keys, next, err := r.client.SScan(ctx, booksSetKey, cursor, "", scanBatchSize).Result()
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to scan books: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, next, nil
+	}
+
+	pipe := r.client.Pipeline()
+	cmds := make([]*redis.StringCmd, len(keys))
+	for i, key := range keys {
+		cmds[i] = pipe.Get(ctx, key)
+	}
+	if _, err = pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, 0, fmt.Errorf("failed to get books: %w", err)
+	}
+
+	books := make([]*entity.CachedBook, 0, len(keys))
+	for i, key := range keys {
+		entry := &entity.CachedBook{}
+		if isbn, ok := strings.CutPrefix(key, missingBookKey("")); ok {
+			entry.ISBN, entry.NotFound = isbn, true
+		} else {
+			entry.ISBN = strings.TrimPrefix(key, bookIDKey(""))
+		}
+
+		value, err := cmds[i].Bytes()
+		switch {
+		case errors.Is(err, redis.Nil):
+			entry.Gone = true
+		case err != nil:
+			return nil, 0, fmt.Errorf("failed to get book: %w", err)
+		case !entry.NotFound:
+			// an undecodable book is left nil and reported stale
+			entry.Book, _ = decodeBook(value)
+		}
+		books = append(books, entry)
+	}
+	return books, next, nil
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func attemptsKey(subject string) string {
+	return fmt.Sprintf("login:attempts:%s", subject)
+}
+
+func lockKey(subject string) string {
+	return fmt.Sprintf("login:lock:%s", subject)
+}
+
+// IncrAttempts counts a failed attempt for subject. The counter expires
+// window after the first failure.
+func (r *RedisRepo) IncrAttempts(ctx context.Context, subject string, window time.Duration) (int64, error) {
+	key := attemptsKey(subject)
+
+	txn := r.client.TxPipeline()
+	incr := txn.Incr(ctx, key)
+	txn.ExpireNX(ctx, key, window)
+	if _, err := txn.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("failed to count attempt: %w", err)
+	}
+
+	return incr.Val(), nil
+}
+
+func (r *RedisRepo) ResetAttempts(ctx context.Context, subject string) error {
+	if err := r.client.Del(ctx, attemptsKey(subject)).Err(); err != nil {
+		return fmt.Errorf("failed to reset attempts: %w", err)
+	}
+
+	return nil
+}
+
+func (r *RedisRepo) Lock(ctx context.Context, subject string, ttl time.Duration) error {
+	if err := r.client.Set(ctx, lockKey(subject), time.Now().Add(ttl).Unix(), ttl).Err(); err != nil {
+		return fmt.Errorf("failed to lock: %w", err)
+	}
+
+	return nil
+}
+
+// LockTTL returns how long subject stays locked, zero if it is not.
+func (r *RedisRepo) LockTTL(ctx context.Context, subject string) (time.Duration, error) {
+	ttl, err := r.client.PTTL(ctx, lockKey(subject)).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("failed to get lock: %w", err)
+	}
+	if ttl < 0 {
+		return 0, nil
+	}
+
+	return ttl, nil
+}
+
+// Unlock removes the lock and the failed attempt counter of subject.
+func (r *RedisRepo) Unlock(ctx context.Context, subject string) error {
+	if err := r.client.Del(ctx, lockKey(subject), attemptsKey(subject)).Err(); err != nil {
+		return fmt.Errorf("failed to unlock: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"template/internal/entity"
+	"template/internal/utils"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// bookListGenerationKey is bumped on every catalog change. Cached pages
+// carry the generation in their key, so a bump makes all of them misses.
+// The pages of a generation are tagged in a set, like books in the books
+// set, so they can be deleted at once.
+const bookListGenerationKey = "books:generation"
+
+func bookListKey(generation int64, query *entity.BookListQuery) string {
+	return fmt.Sprintf("books:list:%d:page=%d:limit=%d", generation, query.Page, query.Limit)
+}
+
+func bookListTagKey(generation int64) string {
+	return fmt.Sprintf("books:lists:%d", generation)
+}
+
+// BookListGeneration returns the current generation of cached pages. It
+// has to be read before the database, so a page read concurrently with a
+// change is stored under the old generation.
+func (r *RedisRepo) BookListGeneration(ctx context.Context) (int64, error) {
+	generation, err := r.client.Get(ctx, bookListGenerationKey).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("get book list generation: %w", err)
+	}
+	return generation, nil
+}
+
+func (r *RedisRepo) FindBookList(ctx context.Context, generation int64, query *entity.BookListQuery) (*entity.PaginatedBooks, error) {
+	value, err := r.client.Get(ctx, bookListKey(generation, query)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return nil, utils.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("get book list: %w", err)
+	}
+
+	var books entity.PaginatedBooks
+	if err = decode(value, &books); err != nil {
+		// pages are overwritten, an outdated one is just a miss
+		if errors.Is(err, errSchemaVersion) {
+			return nil, utils.ErrNotExist
+		}
+		return nil, fmt.Errorf("failed to decode book list: %w", err)
+	}
+	for _, book := range books.Books {
+		normalizeBook(book)
+	}
+	return &books, nil
+}
+
+// InsertBookList caches a page and tags it with its generation.
+func (r *RedisRepo) InsertBookList(ctx context.Context, generation int64, query *entity.BookListQuery, books *entity.PaginatedBooks) error {
+	data, err := encode(books)
+	if err != nil {
+		return fmt.Errorf("failed to encode book list: %w", err)
+	}
+
+	key, tag := bookListKey(generation, query), bookListTagKey(generation)
+	txn := r.client.TxPipeline()
+	txn.Set(ctx, key, data, r.ttl)
+	txn.SAdd(ctx, tag, key)
+	txn.Expire(ctx, tag, r.ttl)
+	if _, err = txn.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to exec: %w", err)
+	}
+	return nil
+}
+
+// InvalidateBookLists starts a new generation of cached pages and deletes
+// the pages of the previous one. Pages left behind by a failed delete are
+// never read again and expire.
+func (r *RedisRepo) InvalidateBookLists(ctx context.Context) error {
+	generation, err := r.client.Incr(ctx, bookListGenerationKey).Result()
+	if err != nil {
+		return fmt.Errorf("failed to invalidate book lists: %w", err)
+	}
+
+	tag := bookListTagKey(generation - 1)
+	keys, err := r.client.SMembers(ctx, tag).Result()
+	if err != nil {
+		return fmt.Errorf("failed to get book lists: %w", err)
+	}
+	if err = r.client.Del(ctx, append(keys, tag)...).Err(); err != nil {
+		return fmt.Errorf("failed to delete book lists: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,71 @@
+package redis
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"template/internal/entity"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// schemaVersion is the first byte of every cached book and page. Bump it
+// whenever entity.Book or entity.PaginatedBooks changes: entries written
+// by another version are treated as misses and replaced, so entity
+// changes deploy without flushing Redis. Entries from before the envelope
+// start with the JSON '{' and are misses too.
+const schemaVersion byte = 1
+
+// errSchemaVersion marks an entry written with another schema version.
+var errSchemaVersion = errors.New("cached entry has another schema version")
+
+// encode wraps v in the versioned envelope: the schema version followed by
+// its MessagePack encoding, keyed by the JSON field names.
+func encode(v interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte(schemaVersion)
+
+	enc := msgpack.NewEncoder(&buf)
+	enc.SetCustomStructTag("json")
+	if err := enc.Encode(v); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func decode(data []byte, v interface{}) error {
+	if len(data) == 0 || data[0] != schemaVersion {
+		return errSchemaVersion
+	}
+
+	dec := msgpack.NewDecoder(bytes.NewReader(data[1:]))
+	dec.SetCustomStructTag("json")
+	return dec.Decode(v)
+}
+
+func encodeBook(book *entity.Book) ([]byte, error) {
+	data, err := encode(book)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode book: %w", err)
+	}
+	return data, nil
+}
+
+func decodeBook(data []byte) (*entity.Book, error) {
+	var book entity.Book
+	if err := decode(data, &book); err != nil {
+		if errors.Is(err, errSchemaVersion) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to decode book: %w", err)
+	}
+	normalizeBook(&book)
+	return &book, nil
+}
+
+// normalizeBook gives decoded times the UTC location Mongo decodes them
+// with, MessagePack timestamps carry none and come back local.
+func normalizeBook(book *entity.Book) {
+	book.CreatedAt = book.CreatedAt.UTC()
+	book.UpdatedAt = book.UpdatedAt.UTC()
+}
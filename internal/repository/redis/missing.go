@@ -0,0 +1,67 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func missingBookKey(id string) string {
+	return fmt.Sprintf("book:missing:%s", id)
+}
+
+// insertMissingBook only sets the entry while the generation is the one
+// read before the database, so a book created in between is not hidden.
+var insertMissingBook = redis.NewScript(`
+local current = redis.call("GET", KEYS[1]) or "0"
+if current ~= ARGV[1] then
+	return 0
+end
+redis.call("SET", KEYS[2], "1", "PX", ARGV[2])
+redis.call("SADD", KEYS[3], KEYS[2])
+return 1
+`)
+
+// IsBookMissing tells whether the database was found not to hold the
+// book within the negative TTL.
+func (r *RedisRepo) IsBookMissing(ctx context.Context, id string) (bool, error) {
+	if r.negativeTTL <= 0 {
+		return false, nil
+	}
+
+	n, err := r.client.Exists(ctx, missingBookKey(id)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check missing book: %w", err)
+	}
+	return n > 0, nil
+}
+
+// InsertMissingBook records that the book is not in the database. It is
+// skipped when the book list generation, which every create bumps, is no
+// longer generation. Entries are kept in the books set so a flush drops
+// them too.
+func (r *RedisRepo) InsertMissingBook(ctx context.Context, id string, generation int64) error {
+	if r.negativeTTL <= 0 {
+		return nil
+	}
+
+	keys := []string{bookListGenerationKey, missingBookKey(id), booksSetKey}
+	err := insertMissingBook.Run(ctx, r.client, keys, generation, r.negativeTTL.Milliseconds()).Err()
+	if err != nil {
+		return fmt.Errorf("failed to insert missing book: %w", err)
+	}
+	return nil
+}
+
+func (r *RedisRepo) DeleteMissingBook(ctx context.Context, id string) error {
+	key := missingBookKey(id)
+
+	txn := r.client.TxPipeline()
+	txn.Del(ctx, key)
+	txn.SRem(ctx, booksSetKey, key)
+	if _, err := txn.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to delete missing book: %w", err)
+	}
+	return nil
+}
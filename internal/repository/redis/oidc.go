@@ -0,0 +1,45 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"template/internal/entity"
+	"template/internal/utils"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func oidcStateKey(state string) string {
+	return fmt.Sprintf("oidc:state:%s", state)
+}
+
+func (r *RedisRepo) SaveOIDCState(ctx context.Context, state string, data *entity.OIDCState, ttl time.Duration) error {
+	value, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("failed to encode state: %w", err)
+	}
+
+	if err = r.client.Set(ctx, oidcStateKey(state), value, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to save state: %w", err)
+	}
+	return nil
+}
+
+// TakeOIDCState returns and deletes the state, so each one is used once.
+func (r *RedisRepo) TakeOIDCState(ctx context.Context, state string) (*entity.OIDCState, error) {
+	value, err := r.client.GetDel(ctx, oidcStateKey(state)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, utils.ErrNotExist
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to get state: %w", err)
+	}
+
+	var data entity.OIDCState
+	if err = json.Unmarshal([]byte(value), &data); err != nil {
+		return nil, fmt.Errorf("failed to decode state: %w", err)
+	}
+	return &data, nil
+}
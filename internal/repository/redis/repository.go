@@ -2,7 +2,6 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"template/internal/entity"
@@ -14,39 +13,43 @@ import (
 )
 
 type RedisRepo struct {
-	client *redis.Client
-	ttl    time.Duration
+	client      *redis.Client
+	ttl         time.Duration
+	negativeTTL time.Duration
 }
 
-func NewRedisRepo(client *redis.Client, ttl time.Duration) *RedisRepo {
+func NewRedisRepo(client *redis.Client, ttl, negativeTTL time.Duration) *RedisRepo {
 	return &RedisRepo{
-		client: client,
-		ttl:    ttl,
+		client:      client,
+		ttl:         ttl,
+		negativeTTL: negativeTTL,
 	}
 }
 
+// booksSetKey holds the key of every cached book.
+const booksSetKey = "books"
+
 func bookIDKey(id string) string {
 	return fmt.Sprintf("book:%s", id)
 }
 
 func (r *RedisRepo) InsertBook(ctx context.Context, book *entity.Book) error {
-	data, err := json.Marshal(book)
-	fmt.Println("book:", book)
+	data, err := encodeBook(book)
 	if err != nil {
-		return fmt.Errorf("failed to encode book: %w", err)
+		return err
 	}
 
 	key := bookIDKey(book.ISBN)
 
 	txn := r.client.TxPipeline()
 
-	res := txn.SetNX(ctx, key, string(data), r.ttl)
+	res := txn.SetNX(ctx, key, data, r.ttl)
 	if err := res.Err(); err != nil {
 		txn.Discard()
 		return fmt.Errorf("failed to set: %w", err)
 	}
 
-	if err := txn.SAdd(ctx, "books", key).Err(); err != nil {
+	if err := txn.SAdd(ctx, booksSetKey, key).Err(); err != nil {
 		txn.Discard()
 		return fmt.Errorf("failed to add to books set: %w", err)
 	}
@@ -61,20 +64,23 @@ func (r *RedisRepo) InsertBook(ctx context.Context, book *entity.Book) error {
 func (r *RedisRepo) FindBookByISBN(ctx context.Context, id string) (*entity.Book, error) {
 	key := bookIDKey(id)
 
-	value, err := r.client.Get(ctx, key).Result()
+	value, err := r.client.Get(ctx, key).Bytes()
 	if errors.Is(err, redis.Nil) {
 		return nil, utils.ErrNotExist
 	} else if err != nil {
 		return nil, fmt.Errorf("get book: %w", err)
 	}
 
-	var book entity.Book
-	err = json.Unmarshal([]byte(value), &book)
-	if err != nil {
-		return nil, fmt.Errorf("failed to decode book json: %w", err)
+	book, err := decodeBook(value)
+	if errors.Is(err, errSchemaVersion) {
+		// InsertBook does not overwrite, the entry has to go for the book
+		// read from the database to be cached
+		if err = r.client.Del(ctx, key).Err(); err != nil {
+			return nil, fmt.Errorf("failed to delete outdated book: %w", err)
+		}
+		return nil, utils.ErrNotExist
 	}
-
-	return &book, nil
+	return book, err
 }
 
 func (r *RedisRepo) DeleteBookByISBN(ctx context.Context, id string) error {
@@ -91,7 +97,7 @@ func (r *RedisRepo) DeleteBookByISBN(ctx context.Context, id string) error {
 		return fmt.Errorf("get book: %w", err)
 	}
 
-	if err := txn.SRem(ctx, "books", key).Err(); err != nil {
+	if err := txn.SRem(ctx, booksSetKey, key).Err(); err != nil {
 		txn.Discard()
 		return fmt.Errorf("failed to remove from books set: %w", err)
 	}
@@ -103,43 +109,35 @@ func (r *RedisRepo) DeleteBookByISBN(ctx context.Context, id string) error {
 	return nil
 }
 
-func (r *RedisRepo) UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error {
-	key := bookIDKey(book.ISBN)
-	existingData, err := r.client.Get(ctx, key).Result()
+// UpdateBookByISBN applies the update to the cached book. The entry is
+// only written back if it still exists, so a concurrent delete is not
+// undone.
+func (r *RedisRepo) UpdateBookByISBN(ctx context.Context, form *entity.BookFormUpdate) error {
+	book, err := r.FindBookByISBN(ctx, form.ISBN)
 	if err != nil {
-		if errors.Is(err, redis.Nil) {
-			return utils.ErrNotExist
-		}
-		return fmt.Errorf("get book: %w", err)
+		return err
 	}
 
-	var existingBook map[string]interface{}
-	if err := json.Unmarshal([]byte(existingData), &existingBook); err != nil {
-		return fmt.Errorf("unmarshal existing book: %w", err)
+	if validator.MinChars(form.Title, 1) {
+		book.Title = form.Title
 	}
-
-	if validator.MinChars(book.Title, 1) {
-		existingBook["title"] = book.Title
+	if validator.MinChars(form.Publisher, 1) {
+		book.Publisher = form.Publisher
 	}
-	if validator.MinChars(book.Publisher, 1) {
-		existingBook["publisher"] = book.Publisher
+	if validator.CheckArr(form.Author) {
+		book.Author = form.Author
 	}
-	if validator.CheckArr(book.Author) {
-		existingBook["author"] = book.Author
+	book.UpdatedAt = form.UpdatedAt
+	if book.UpdatedAt.IsZero() {
+		book.UpdatedAt = time.Now()
 	}
-	existingBook["updatedAt"] = time.Now().Format(time.RFC3339)
 
-	// Marshal the updated book data back to JSON
-	updatedData, err := json.Marshal(existingBook)
+	data, err := encodeBook(book)
 	if err != nil {
-		return fmt.Errorf("marshal updated book: %w", err)
+		return err
 	}
-
-	// Set the updated book data in Redis
-	err = r.client.Set(ctx, key, updatedData, r.ttl).Err()
-	if err != nil {
+	if err = r.client.SetXX(ctx, bookIDKey(form.ISBN), data, r.ttl).Err(); err != nil {
 		return fmt.Errorf("set book: %w", err)
 	}
-
 	return nil
 }
@@ -0,0 +1,19 @@
+package redis
+
+import (
+	"template/internal/repository/cachetest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestBookCache(t *testing.T) {
+	cachetest.Run(t, func(t *testing.T, ttl, negativeTTL time.Duration) (cachetest.Repo, func(time.Duration)) {
+		server := miniredis.RunT(t)
+		client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+		t.Cleanup(func() { client.Close() })
+		return NewRedisRepo(client, ttl, negativeTTL), server.FastForward
+	})
+}
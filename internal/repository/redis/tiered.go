@@ -0,0 +1,204 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"template/internal/entity"
+	"template/pkg/ttlcache"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+	"go.uber.org/zap"
+)
+
+// bookInvalidationChannel carries the ISBN of every book updated or deleted
+// by any replica, or flushAllPayload when the cache was flushed.
+const (
+	bookInvalidationChannel = "books:invalidate"
+	flushAllPayload         = "*"
+)
+
+// resubscribeDelay keeps a replica from spinning while Redis is down.
+const resubscribeDelay = time.Second
+
+// TieredRepo is a RedisRepo with an in-process L1 cache of books in front
+// of it. Updates and deletes are published on bookInvalidationChannel and
+// every replica evicts its copy when the message arrives. The L1 cache is
+// bypassed and emptied whenever the subscription is down, since messages
+// may be missed then.
+type TieredRepo struct {
+	*RedisRepo
+
+	l1     *ttlcache.Cache[string, entity.Book]
+	pubsub *redis.PubSub
+	logger *zap.Logger
+	done   chan struct{}
+
+	subscribed atomic.Bool
+	closed     atomic.Bool
+
+	// epoch is bumped on every eviction. A book read from Redis is only
+	// kept if no eviction happened during the read, so a message that
+	// arrives before the read completes is not undone by it.
+	mu    sync.Mutex
+	epoch uint64
+}
+
+func NewTieredRepo(repo *RedisRepo, ttl time.Duration, maxEntries int, logger *zap.Logger) *TieredRepo {
+	r := &TieredRepo{
+		RedisRepo: repo,
+		l1:        ttlcache.New[string, entity.Book](ttl, maxEntries),
+		pubsub:    repo.client.Subscribe(context.Background(), bookInvalidationChannel),
+		logger:    logger,
+		done:      make(chan struct{}),
+	}
+	go r.listen()
+	return r
+}
+
+// Close stops listening for invalidations, it has to be called before the
+// Redis client is closed.
+func (r *TieredRepo) Close() error {
+	r.closed.Store(true)
+	err := r.pubsub.Close()
+	<-r.done
+	return err
+}
+
+func (r *TieredRepo) listen() {
+	defer close(r.done)
+
+	ctx := context.Background()
+	for {
+		msg, err := r.pubsub.Receive(ctx)
+		if err != nil {
+			if r.subscribed.Swap(false) {
+				r.clear()
+			}
+			if r.closed.Load() || errors.Is(err, redis.ErrClosed) {
+				return
+			}
+			r.logger.Warn("book invalidation subscription lost", zap.Error(err))
+			time.Sleep(resubscribeDelay)
+			continue
+		}
+
+		switch msg := msg.(type) {
+		case *redis.Subscription:
+			// sent again after every reconnect, anything published in
+			// between was missed
+			if msg.Kind == "subscribe" {
+				r.clear()
+				r.subscribed.Store(true)
+			}
+		case *redis.Message:
+			if msg.Payload == flushAllPayload {
+				r.clear()
+			} else {
+				r.evict(msg.Payload)
+			}
+		}
+	}
+}
+
+func (r *TieredRepo) FindBookByISBN(ctx context.Context, id string) (*entity.Book, error) {
+	if !r.subscribed.Load() {
+		return r.RedisRepo.FindBookByISBN(ctx, id)
+	}
+	if book, ok := r.l1.Get(id); ok {
+		book = copyBook(&book)
+		return &book, nil
+	}
+
+	r.mu.Lock()
+	epoch := r.epoch
+	r.mu.Unlock()
+
+	book, err := r.RedisRepo.FindBookByISBN(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	if r.epoch == epoch && r.subscribed.Load() {
+		r.l1.Set(id, copyBook(book))
+	}
+	r.mu.Unlock()
+	return book, nil
+}
+
+// UpdateBookByISBN publishes the invalidation even when the book is not in
+// Redis, other replicas may still hold it in L1.
+func (r *TieredRepo) UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error {
+	err := r.RedisRepo.UpdateBookByISBN(ctx, book)
+	if perr := r.publish(ctx, book.ISBN); err == nil {
+		err = perr
+	}
+	return err
+}
+
+func (r *TieredRepo) DeleteBookByISBN(ctx context.Context, id string) error {
+	err := r.RedisRepo.DeleteBookByISBN(ctx, id)
+	if perr := r.publish(ctx, id); err == nil {
+		err = perr
+	}
+	return err
+}
+
+func (r *TieredRepo) FlushBooks(ctx context.Context) (int, error) {
+	flushed, err := r.RedisRepo.FlushBooks(ctx)
+	if perr := r.publish(ctx, flushAllPayload); err == nil {
+		err = perr
+	}
+	return flushed, err
+}
+
+func (r *TieredRepo) BookCacheUsage(ctx context.Context) (*entity.BookCacheUsage, error) {
+	usage, err := r.RedisRepo.BookCacheUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+	usage.L1Keys = r.l1.Len()
+	return usage, nil
+}
+
+// publish evicts the local copy right away rather than waiting for the
+// message to come back.
+func (r *TieredRepo) publish(ctx context.Context, id string) error {
+	if id == flushAllPayload {
+		r.clear()
+	} else {
+		r.evict(id)
+	}
+	if err := r.client.Publish(ctx, bookInvalidationChannel, id).Err(); err != nil {
+		return fmt.Errorf("failed to publish book invalidation: %w", err)
+	}
+	return nil
+}
+
+func (r *TieredRepo) evict(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.epoch++
+	r.l1.Delete(id)
+}
+
+func (r *TieredRepo) clear() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.epoch++
+	r.l1.Clear()
+}
+
+// copyBook keeps callers from changing cached books through the author
+// slice.
+func copyBook(book *entity.Book) entity.Book {
+	res := *book
+	res.Author = append([]string(nil), book.Author...)
+	return res
+}
@@ -0,0 +1,30 @@
+package server
+
+import (
+	"template/internal/config"
+	"template/pkg/breaker"
+	"time"
+)
+
+const (
+	defaultBreakerThreshold = 5
+	defaultBreakerCooldown  = 10 * time.Second
+	defaultDatabaseTimeout  = 3 * time.Second
+	defaultCacheTimeout     = 250 * time.Millisecond
+)
+
+// newBreaker fills what the config leaves out. ignore are the errors the
+// guarded calls answer with when they work.
+func newBreaker(name string, cfg config.BreakerConfig, timeout time.Duration, ignore ...error) *breaker.Breaker {
+	threshold, cooldown := cfg.Threshold, cfg.Cooldown
+	if threshold <= 0 {
+		threshold = defaultBreakerThreshold
+	}
+	if cooldown <= 0 {
+		cooldown = defaultBreakerCooldown
+	}
+	if cfg.Timeout > 0 {
+		timeout = cfg.Timeout
+	}
+	return breaker.New(name, threshold, cooldown, timeout, ignore...)
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"template/internal/entity"
+	"template/internal/repository/memory"
+	cache "template/internal/repository/redis"
+	"time"
+)
+
+const (
+	cacheDriverRedis  = "redis"
+	cacheDriverMemory = "memory"
+	cacheDriverNone   = "none"
+
+	defaultCacheEntries = 10000
+	defaultL1TTL        = time.Minute
+)
+
+// cacheRepo is implemented by the Redis and the memory repository.
+type cacheRepo interface {
+	InsertBook(ctx context.Context, book *entity.Book) error
+	FindBookByISBN(ctx context.Context, id string) (*entity.Book, error)
+	UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error
+	DeleteBookByISBN(ctx context.Context, id string) error
+	BookListGeneration(ctx context.Context) (int64, error)
+	FindBookList(ctx context.Context, generation int64, query *entity.BookListQuery) (*entity.PaginatedBooks, error)
+	InsertBookList(ctx context.Context, generation int64, query *entity.BookListQuery, books *entity.PaginatedBooks) error
+	InvalidateBookLists(ctx context.Context) error
+	BookCacheUsage(ctx context.Context) (*entity.BookCacheUsage, error)
+	FlushBooks(ctx context.Context) (int, error)
+	ScanCachedBooks(ctx context.Context, cursor uint64) ([]*entity.CachedBook, uint64, error)
+	IsBookMissing(ctx context.Context, id string) (bool, error)
+	InsertMissingBook(ctx context.Context, id string, generation int64) error
+	DeleteMissingBook(ctx context.Context, id string) error
+
+	IncrAttempts(ctx context.Context, subject string, window time.Duration) (int64, error)
+	ResetAttempts(ctx context.Context, subject string) error
+	Lock(ctx context.Context, subject string, ttl time.Duration) error
+	LockTTL(ctx context.Context, subject string) (time.Duration, error)
+	Unlock(ctx context.Context, subject string) error
+
+	SaveOIDCState(ctx context.Context, state string, data *entity.OIDCState, ttl time.Duration) error
+	TakeOIDCState(ctx context.Context, state string) (*entity.OIDCState, error)
+}
+
+// newCacheRepo sets up the configured cache driver and tells whether books
+// are cached. Redis is only dialed when it is the driver, and the L1 cache
+// can only sit in front of it.
+func (a *App) newCacheRepo() (cacheRepo, bool, error) {
+	cfg := a.cfg.Repository
+	maxEntries := cfg.Cache.MaxEntries
+	if maxEntries <= 0 {
+		maxEntries = defaultCacheEntries
+	}
+
+	if cfg.Cache.Driver == "" || cfg.Cache.Driver == cacheDriverRedis {
+		client, err := cache.NewRedisDB(&cfg.Redis)
+		if err != nil {
+			return nil, false, err
+		}
+		a.cache = client
+		repo := cache.NewRedisRepo(client, cfg.Redis.Ttl, cfg.Redis.NegativeTtl)
+		if !cfg.Cache.L1.Enabled {
+			return repo, true, nil
+		}
+
+		ttl, l1Entries := cfg.Cache.L1.TTL, cfg.Cache.L1.MaxEntries
+		if ttl <= 0 {
+			ttl = defaultL1TTL
+		}
+		if l1Entries <= 0 {
+			l1Entries = defaultCacheEntries
+		}
+		a.l1 = cache.NewTieredRepo(repo, ttl, l1Entries, a.logger)
+		return a.l1, true, nil
+	}
+
+	if cfg.Cache.L1.Enabled {
+		return nil, false, fmt.Errorf("the l1 cache needs the %q cache driver", cacheDriverRedis)
+	}
+	switch cfg.Cache.Driver {
+	case cacheDriverMemory:
+		return memory.NewMemoryRepo(cfg.Redis.Ttl, cfg.Redis.NegativeTtl, maxEntries), true, nil
+	case cacheDriverNone:
+		// login attempts and SSO states are not a cache, they are still
+		// kept in memory
+		return memory.NewMemoryRepo(cfg.Redis.Ttl, cfg.Redis.NegativeTtl, maxEntries), false, nil
+	default:
+		return nil, false, fmt.Errorf("unknown cache driver %q", cfg.Cache.Driver)
+	}
+}
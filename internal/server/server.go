@@ -4,8 +4,6 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/mongo/options"
 	"net/http"
 	"os"
 	_ "template/docs"
@@ -14,10 +12,20 @@ import (
 	"template/internal/delivery/http/v1"
 	db "template/internal/repository/mongo"
 	cache "template/internal/repository/redis"
+	api_key_service "template/internal/service/apikey"
 	book_service "template/internal/service/book"
+	ldap_service "template/internal/service/ldap"
+	lockout_service "template/internal/service/lockout"
+	oidc_service "template/internal/service/oidc"
+	scim_service "template/internal/service/scim"
 	user_service "template/internal/service/user"
+	"template/internal/utils"
 	"template/pkg/auth"
+	"template/pkg/breached"
+	"template/pkg/breaker"
 	"template/pkg/hash"
+	"template/pkg/notify"
+	"template/pkg/validator"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -36,6 +44,9 @@ type App struct {
 	logger *zap.Logger
 	db     *mongo.Client //iocloser
 	cache  *redis.Client
+	l1     *cache.TieredRepo
+	// stopJobs ends the background jobs
+	stopJobs context.CancelFunc
 }
 
 func NewApp(cfg *config.Config) *App {
@@ -81,6 +92,11 @@ func (a *App) Initialize() error {
 		)),
 	)
 	a.router = chi.NewRouter()
+	proxies, err := http2.ParseTrustedProxies(a.cfg.App.TrustedProxies)
+	if err != nil {
+		return err
+	}
+	a.router.Use(http2.RealIP(proxies))
 	a.router.Use(cors.Handler(cors.Options{
 		AllowedOrigins: a.cfg.App.Cors.AllowOrigins,
 		AllowedMethods: a.cfg.App.Cors.AllowMethods,
@@ -101,49 +117,190 @@ func (a *App) setHandler() error {
 		return err
 	}
 
-	a.cache, err = cache.NewRedisDB(&a.cfg.Repository.Redis)
+	// redis or its in-process replacement
+	cacheRepo, cacheBooks, err := a.newCacheRepo()
 	if err != nil {
 		return err
 	}
 
-	//redis
-	redisRepo := cache.NewRedisRepo(a.cache, a.cfg.Repository.Redis.Ttl)
-
 	// mongo
-	indexModel := mongo.IndexModel{
-		Keys:    bson.M{"username": 1}, // index key ascending
-		Options: options.Index().SetUnique(true),
-	}
-
-	bookCollection := a.db.Database(a.cfg.Repository.Mongo.DBName).Collection(a.cfg.Repository.Mongo.BooksCollection)
-	userCollection := a.db.Database(a.cfg.Repository.Mongo.DBName).Collection(a.cfg.Repository.Mongo.UsersCollection)
-
-	_, err = userCollection.Indexes().CreateOne(context.TODO(), indexModel)
-	if err != nil {
+	mongoRepo := db.NewRepoMongo(a.db.Database(a.cfg.Repository.Mongo.DBName), &a.cfg.Repository.Mongo)
+	if err = mongoRepo.EnsureIndexes(context.TODO()); err != nil {
 		return err
 	}
 
-	mongoRepo := db.NewRepoMongo(userCollection, bookCollection)
-
 	//jwt and hasher
-	tokenManager, err := auth.NewManager(a.cfg.Auth.JWT.SigningKey)
+	tokenManager, err := newTokenManager(&a.cfg.Auth.JWT)
 	if err != nil {
 		return err
 	}
 	hasher := hash.NewSHA1Hasher(a.cfg.Auth.PasswordSalt)
+	passwordPolicy, err := newPasswordPolicy(&a.cfg.Auth.Password)
+	if err != nil {
+		return err
+	}
 
 	// services
-	userService := user_service.NewUserService(mongoRepo, hasher, tokenManager, a.cfg.Auth.JWT.AccessTokenTTL, a.cfg.Auth.JWT.RefreshTokenTTL)
-	bookService := book_service.NewBookService(mongoRepo)
+	lockout := a.cfg.Auth.Lockout
+	if lockout.MaxLockout <= 0 {
+		lockout.MaxLockout = defaultMaxLockout
+	}
+	lockoutService := lockout_service.NewLockoutService(cacheRepo, mongoRepo, lockout.MaxAttempts, lockout.MaxIPAttempts, lockout.Window, lockout.BaseLockout, lockout.MaxLockout)
+	notifier, err := a.newNotifier()
+	if err != nil {
+		return err
+	}
+	reset, verification, twoFactor := a.cfg.Auth.PasswordReset, a.cfg.Auth.Verification, a.cfg.Auth.TwoFactor
+	if reset.RequestWindow <= 0 {
+		reset.RequestWindow = defaultResetRequestWindow
+	}
+	resetLimiter := lockout_service.NewLimiter(cacheRepo, "reset", reset.MaxRequests, reset.MaxIPRequests, reset.RequestWindow)
+	var authenticators []user_service.Authenticator
+	if ldap := a.cfg.Auth.LDAP; ldap.Enabled {
+		authenticators = append(authenticators, ldap_service.NewLDAPAuthenticator(ldap_service.Config{
+			URL:                  ldap.URL,
+			StartTLS:             ldap.StartTLS,
+			BindDN:               ldap.BindDN,
+			BindPassword:         ldap.BindPassword,
+			BaseDN:               ldap.BaseDN,
+			UserFilter:           ldap.UserFilter,
+			Timeout:              ldap.Timeout,
+			IDAttribute:          ldap.Attributes.ID,
+			UsernameAttribute:    ldap.Attributes.Username,
+			EmailAttribute:       ldap.Attributes.Email,
+			DisplayNameAttribute: ldap.Attributes.DisplayName,
+			GroupsAttribute:      ldap.Attributes.Groups,
+			RoleMapping:          ldap.RoleMapping,
+		}))
+	}
+	userService := user_service.NewUserService(user_service.Config{
+		AccessTokenTTL:   a.cfg.Auth.JWT.AccessTokenTTL,
+		RefreshTokenTTL:  a.cfg.Auth.JWT.RefreshTokenTTL,
+		ImpersonationTTL: a.cfg.Auth.ImpersonationTTL,
+		ResetTokenTTL:    reset.TokenTTL,
+		ResetURL:         reset.URL,
+		VerifyTokenTTL:   verification.TokenTTL,
+		VerifyURL:        verification.URL,
+		VerifyCooldown:   verification.ResendCooldown,
+		ChallengeTTL:     twoFactor.ChallengeTTL,
+		TOTPIssuer:       twoFactor.Issuer,
+		UserCacheTTL:     a.cfg.Auth.UserCacheTTL,
+	}, mongoRepo, lockoutService, resetLimiter, hasher, passwordPolicy, tokenManager, notifier, user_service.NoClosureGuard{}, authenticators...)
+	breakers := a.cfg.Repository.Breakers
+	dbBreaker := newBreaker("database", breakers.Database, defaultDatabaseTimeout, utils.ErrNotExist, utils.ErrBookAlreadyExists, utils.ErrBadInput)
+	cacheBreaker := newBreaker("cache", breakers.Cache, defaultCacheTimeout, utils.ErrNotExist)
+	guarded := []*breaker.Breaker{dbBreaker}
+	bookRepo := book_service.NewGuardedBookRepo(mongoRepo, dbBreaker)
+	bookService := book_service.NewBookService(bookRepo)
+	if cacheBooks {
+		guarded = append(guarded, cacheBreaker)
+		bookCache := book_service.NewGuardedBookCache(cacheRepo, cacheBreaker)
+		cachedRepo := book_service.NewCachedBookRepo(bookRepo, bookCache, a.logger)
+		bookService = book_service.NewBookService(cachedRepo)
+		if consistency := a.cfg.Repository.Cache.Consistency; consistency.Interval > 0 {
+			ctx, cancel := context.WithCancel(context.Background())
+			a.stopJobs = cancel
+			go cachedRepo.ScheduleConsistencyCheck(ctx, consistency.Interval, consistency.Repair)
+		}
+	}
+	apiKeyService := api_key_service.NewAPIKeyService(mongoRepo)
+	oidc := a.cfg.Auth.OIDC
+	oidcService := oidc_service.NewOIDCService(oidc_service.Config{
+		Enabled:       oidc.Enabled,
+		Issuer:        oidc.Issuer,
+		ClientID:      oidc.ClientID,
+		ClientSecret:  oidc.ClientSecret,
+		RedirectURL:   oidc.RedirectURL,
+		Scopes:        oidc.Scopes,
+		StateTTL:      oidc.StateTTL,
+		UsernameClaim: oidc.Claims.Username,
+		EmailClaim:    oidc.Claims.Email,
+		GroupsClaim:   oidc.Claims.Groups,
+		RoleMapping:   oidc.RoleMapping,
+	}, cacheRepo, userService)
+
+	scim := a.cfg.Auth.SCIM
+	if scim.Enabled && scim.Token == "" {
+		return errors.New("auth.scim is enabled but SCIM_TOKEN is not set")
+	}
+	scimService := scim_service.NewScimService(scim_service.Config{
+		Enabled: scim.Enabled,
+		Token:   scim.Token,
+	}, mongoRepo, userService)
 
 	a.router.Get("/swagger/*", httpSwagger.WrapHandler)
-	responder := http2.NewResponder(a.logger)
+	cachePolicies := make(map[string]http2.CachePolicy, len(a.cfg.App.HTTPCache))
+	for route, policy := range a.cfg.App.HTTPCache {
+		cachePolicies[route] = http2.CachePolicy{Authenticated: policy.Authenticated, Anonymous: policy.Anonymous}
+	}
+	responder := http2.NewResponder(a.logger, cachePolicies)
+	a.router.Get("/health", http2.HealthHandler(responder, guarded...))
 
-	v1.SetHandler(a.router, responder, a.logger, userService, bookService, redisRepo, tokenManager)
+	v1.SetHandler(a.router, responder, a.logger, userService, bookService, tokenManager, apiKeyService, lockoutService, oidcService, scimService, a.cfg.App.PublicCatalog)
 
 	return nil
 }
 
+const (
+	defaultPasswordMinLength  = 8
+	defaultMaxLockout         = time.Hour
+	defaultResetRequestWindow = time.Hour
+)
+
+func newPasswordPolicy(cfg *config.PasswordPolicy) (*validator.PasswordPolicy, error) {
+	minLength := cfg.MinLength
+	if minLength <= 0 {
+		minLength = defaultPasswordMinLength
+	}
+
+	policy := &validator.PasswordPolicy{
+		MinLength:      minLength,
+		MaxLength:      cfg.MaxLength,
+		RequireUpper:   cfg.RequireUpper,
+		RequireLower:   cfg.RequireLower,
+		RequireDigit:   cfg.RequireDigit,
+		RequireSymbol:  cfg.RequireSymbol,
+		RejectUsername: cfg.RejectUsername,
+	}
+	if cfg.BreachedDir != "" {
+		list, err := breached.NewList(cfg.BreachedDir)
+		if err != nil {
+			return nil, err
+		}
+		policy.Breached = list
+	}
+	return policy, nil
+}
+
+func newTokenManager(cfg *config.JWTConfig) (*auth.Manager, error) {
+	if len(cfg.Keys) == 0 {
+		return auth.NewManager(cfg.SigningKey)
+	}
+
+	keys := make([]*auth.Key, 0, len(cfg.Keys))
+	for _, k := range cfg.Keys {
+		key, err := auth.LoadKey(k.ID, k.Algorithm, k.PrivateKeyFile, k.PublicKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return auth.NewKeyManager(cfg.ActiveKeyID, keys...)
+}
+
+func (a *App) newNotifier() (notify.Notifier, error) {
+	if a.cfg.Notifier == nil || a.cfg.Notifier.Driver == "" || a.cfg.Notifier.Driver == "log" {
+		return notify.NewLogNotifier(a.logger), nil
+	}
+	if a.cfg.Notifier.Driver != "smtp" {
+		return nil, fmt.Errorf("unknown notifier driver %q", a.cfg.Notifier.Driver)
+	}
+
+	smtp := a.cfg.Notifier.SMTP
+	return notify.NewSMTPNotifier(smtp.Host, smtp.Port, smtp.From, smtp.Username, smtp.Password)
+}
+
 func (a *App) Run(ctx context.Context) {
 	var err error
 	defer a.closeConnections()
@@ -179,11 +336,21 @@ func (a *App) Run(ctx context.Context) {
 
 func (a *App) closeConnections() {
 	defer a.logger.Sync()
+	if a.stopJobs != nil {
+		a.stopJobs()
+	}
 	if err := a.db.Disconnect(context.Background()); err != nil {
 		a.logger.Error(err.Error())
 	}
-	if err := a.cache.Close(); err != nil {
-		a.logger.Error(err.Error())
+	if a.l1 != nil {
+		if err := a.l1.Close(); err != nil {
+			a.logger.Error(err.Error())
+		}
+	}
+	if a.cache != nil {
+		if err := a.cache.Close(); err != nil {
+			a.logger.Error(err.Error())
+		}
 	}
 	// если будет бд и т.д, закрывать коннект здесь
 }
@@ -0,0 +1,132 @@
+package apiKeyService
+
+import (
+	"context"
+	"errors"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/auth"
+	"template/pkg/hash"
+	"template/pkg/validator"
+	"time"
+)
+
+const (
+	keyPrefix    = "lmk_"
+	keyBytes     = 32
+	prefixLength = len(keyPrefix) + 8
+	// lastUsedResolution limits how often a busy key writes lastUsedAt.
+	lastUsedResolution = time.Minute
+)
+
+type APIKeyService struct {
+	apiKeyRepo apiKeyRepo
+}
+
+func NewAPIKeyService(apiKeyRepo apiKeyRepo) *APIKeyService {
+	return &APIKeyService{
+		apiKeyRepo: apiKeyRepo,
+	}
+}
+
+type apiKeyRepo interface {
+	CreateAPIKey(ctx context.Context, key *entity.APIKey) (interface{}, error)
+	ListAPIKeys(ctx context.Context) ([]*entity.APIKey, error)
+	GetAPIKeyByHash(ctx context.Context, hashedKey string) (*entity.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+	ListUserAPIKeys(ctx context.Context, userID string) ([]*entity.APIKey, error)
+	RevokeUserAPIKey(ctx context.Context, id, userID string) error
+	TouchAPIKey(ctx context.Context, id primitive.ObjectID, usedAt time.Time) error
+}
+
+func (s *APIKeyService) CreateAPIKey(ctx context.Context, form *v1.APIKeyInputForm, createdBy string) (*entity.APIKeyCreated, error) {
+	return s.issue(ctx, form, entity.APIKeyScopes, keyPrefix, &entity.APIKey{CreatedBy: createdBy})
+}
+
+// CreatePersonalToken issues a personal access token acting as the user
+// within the requested scopes.
+func (s *APIKeyService) CreatePersonalToken(ctx context.Context, form *v1.APIKeyInputForm, userID string) (*entity.APIKeyCreated, error) {
+	return s.issue(ctx, form, entity.PersonalTokenScopes, entity.PersonalTokenPrefix, &entity.APIKey{CreatedBy: userID, UserID: userID})
+}
+
+func (s *APIKeyService) ListPersonalTokens(ctx context.Context, userID string) ([]*entity.APIKey, error) {
+	return s.apiKeyRepo.ListUserAPIKeys(ctx, userID)
+}
+
+func (s *APIKeyService) RevokePersonalToken(ctx context.Context, id, userID string) error {
+	return s.apiKeyRepo.RevokeUserAPIKey(ctx, id, userID)
+}
+
+// issue validates the form against the permitted scopes and stores key
+// with a new secret.
+func (s *APIKeyService) issue(ctx context.Context, form *v1.APIKeyInputForm, scopes []string, prefix string, key *entity.APIKey) (*entity.APIKeyCreated, error) {
+	form.CheckField(validator.NotBlank(form.Name), &form.APIKeyErrors.Name, "This field cannot be blank")
+	form.CheckField(validator.MaxChars(form.Name, 64), &form.APIKeyErrors.Name, "Name must be max 64 chars long")
+	form.CheckField(len(form.Scopes) > 0, &form.APIKeyErrors.Scopes, "At least one scope is required")
+	form.CheckField(validator.PermittedValues(form.Scopes, scopes...), &form.APIKeyErrors.Scopes, "Unknown scope")
+	if form.ExpiresAt != nil {
+		form.CheckField(form.ExpiresAt.After(time.Now()), &form.APIKeyErrors.ExpiresAt, "Expiry must be in the future")
+	}
+	if !form.ValidAPIKey() {
+		return nil, utils.InvalidForm
+	}
+
+	secret, err := auth.NewRandomString(keyBytes)
+	if err != nil {
+		return nil, err
+	}
+	plain := prefix + secret
+
+	key.Name = form.Name
+	key.Prefix = plain[:prefixLength]
+	key.HashedKey = hash.Token(plain)
+	key.Scopes = form.Scopes
+	key.CreatedAt = time.Now()
+	key.ExpiresAt = form.ExpiresAt
+
+	id, err := s.apiKeyRepo.CreateAPIKey(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if oid, ok := id.(primitive.ObjectID); ok {
+		key.ID = oid
+	}
+
+	return &entity.APIKeyCreated{Key: plain, APIKey: key}, nil
+}
+
+func (s *APIKeyService) ListAPIKeys(ctx context.Context) ([]*entity.APIKey, error) {
+	return s.apiKeyRepo.ListAPIKeys(ctx)
+}
+
+func (s *APIKeyService) RevokeAPIKey(ctx context.Context, id string) error {
+	return s.apiKeyRepo.RevokeAPIKey(ctx, id)
+}
+
+// Authenticate resolves a plain API key. Unknown, revoked and expired keys
+// all return utils.ErrInvalidAPIKey.
+func (s *APIKeyService) Authenticate(ctx context.Context, plain string) (*entity.APIKey, error) {
+	key, err := s.apiKeyRepo.GetAPIKeyByHash(ctx, hash.Token(plain))
+	if err != nil {
+		if errors.Is(err, utils.ErrNotExist) {
+			return nil, utils.ErrInvalidAPIKey
+		}
+		return nil, err
+	}
+
+	now := time.Now()
+	if key.RevokedAt != nil || (key.ExpiresAt != nil && key.ExpiresAt.Before(now)) {
+		return nil, utils.ErrInvalidAPIKey
+	}
+
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > lastUsedResolution {
+		if err = s.apiKeyRepo.TouchAPIKey(ctx, key.ID, now); err != nil {
+			return nil, err
+		}
+		key.LastUsedAt = &now
+	}
+
+	return key, nil
+}
@@ -14,15 +14,22 @@ import (
 const (
 	limitDefault = 5
 	pageDefault  = 1
+
+	warmLimitDefault = 100
+	warmLimitMax     = 1000
 )
 
 type BookService struct {
 	bookRepo bookRepo
+	// cache is nil unless books are cached
+	cache *CachedBookRepo
 }
 
 func NewBookService(bookRepo bookRepo) *BookService {
+	cache, _ := bookRepo.(*CachedBookRepo)
 	return &BookService{
 		bookRepo: bookRepo,
+		cache:    cache,
 	}
 }
 
@@ -93,3 +100,59 @@ func (s *BookService) CreateBook(ctx context.Context, book *v1.BookInputForm) (i
 
 	return s.bookRepo.CreateBook(ctx, form)
 }
+
+func (s *BookService) CacheStats(ctx context.Context) (*entity.CacheStats, error) {
+	if s.cache == nil {
+		return nil, utils.ErrCacheDisabled
+	}
+	return s.cache.Stats(ctx)
+}
+
+func (s *BookService) EvictCachedBook(ctx context.Context, id string) error {
+	if s.cache == nil {
+		return utils.ErrCacheDisabled
+	}
+	return s.cache.Evict(ctx, id)
+}
+
+func (s *BookService) FlushCache(ctx context.Context) (int, error) {
+	if s.cache == nil {
+		return 0, utils.ErrCacheDisabled
+	}
+	return s.cache.Flush(ctx)
+}
+
+func (s *BookService) WarmCache(ctx context.Context, form *v1.CacheWarmForm) (int, error) {
+	if s.cache == nil {
+		return 0, utils.ErrCacheDisabled
+	}
+
+	limit := form.Limit
+	switch {
+	case limit < 0:
+		return 0, utils.ErrBadInput
+	case limit == 0:
+		limit = warmLimitDefault
+	case limit > warmLimitMax:
+		limit = warmLimitMax
+	}
+	return s.cache.Warm(ctx, form.By, limit)
+}
+
+func (s *BookService) CheckCacheConsistency(ctx context.Context, repair bool) (*entity.ConsistencyReport, error) {
+	if s.cache == nil {
+		return nil, utils.ErrCacheDisabled
+	}
+	return s.cache.CheckConsistency(ctx, repair)
+}
+
+func (s *BookService) LastCacheConsistencyCheck() (*entity.ConsistencyReport, error) {
+	if s.cache == nil {
+		return nil, utils.ErrCacheDisabled
+	}
+	report := s.cache.LastConsistencyCheck()
+	if report == nil {
+		return nil, utils.ErrNotExist
+	}
+	return report, nil
+}
@@ -0,0 +1,239 @@
+package bookService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/breaker"
+
+	"go.uber.org/zap"
+	"golang.org/x/sync/singleflight"
+)
+
+// CachedBookRepo is a cache-aside decorator of bookRepo. Concurrent misses
+// for the same ISBN share one database read, updates and deletes are
+// written through, and cache errors are logged but never fail a request:
+// the database stays the source of truth.
+type CachedBookRepo struct {
+	repo   bookSource
+	cache  bookCache
+	logger *zap.Logger
+	group  singleflight.Group
+
+	stats    map[string]*opStats
+	requests *requestCounter
+
+	checking  sync.Mutex
+	lastCheck atomic.Pointer[entity.ConsistencyReport]
+}
+
+func NewCachedBookRepo(repo bookSource, cache bookCache, logger *zap.Logger) *CachedBookRepo {
+	return &CachedBookRepo{
+		repo:   repo,
+		cache:  cache,
+		logger: logger,
+		stats: map[string]*opStats{
+			opGet:     new(opStats),
+			opMissing: new(opStats),
+			opList:    new(opStats),
+		},
+		requests: newRequestCounter(maxTrackedBooks),
+	}
+}
+
+// bookStore is the database behind the cache, it also picks the books to
+// pre-warm the cache with.
+type bookStore interface {
+	bookRepo
+	GetBooksByISBN(ctx context.Context, ids []string) ([]*entity.Book, error)
+	ListRecentBooks(ctx context.Context, limit int) ([]*entity.Book, error)
+}
+
+// bookSource is a bookStore telling whether cached reads can be trusted,
+// see GuardedBookRepo.
+type bookSource interface {
+	bookStore
+	Available() bool
+}
+
+type bookCache interface {
+	InsertBook(ctx context.Context, book *entity.Book) error
+	FindBookByISBN(ctx context.Context, id string) (*entity.Book, error)
+	UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error
+	DeleteBookByISBN(ctx context.Context, id string) error
+	BookListGeneration(ctx context.Context) (int64, error)
+	FindBookList(ctx context.Context, generation int64, query *entity.BookListQuery) (*entity.PaginatedBooks, error)
+	InsertBookList(ctx context.Context, generation int64, query *entity.BookListQuery, books *entity.PaginatedBooks) error
+	InvalidateBookLists(ctx context.Context) error
+	BookCacheUsage(ctx context.Context) (*entity.BookCacheUsage, error)
+	FlushBooks(ctx context.Context) (int, error)
+	ScanCachedBooks(ctx context.Context, cursor uint64) ([]*entity.CachedBook, uint64, error)
+	IsBookMissing(ctx context.Context, id string) (bool, error)
+	InsertMissingBook(ctx context.Context, id string, generation int64) error
+	DeleteMissingBook(ctx context.Context, id string) error
+}
+
+func (r *CachedBookRepo) GetBookByISBN(ctx context.Context, id string) (*entity.Book, error) {
+	book, err := r.cache.FindBookByISBN(ctx, id)
+	r.stats[opGet].record(err)
+	if err == nil {
+		r.requests.add(id)
+		book.Stale = !r.repo.Available()
+		return book, nil
+	}
+	if !errors.Is(err, utils.ErrNotExist) {
+		r.cacheError("find", id, err)
+	}
+
+	missing, err := r.cache.IsBookMissing(ctx, id)
+	switch {
+	case err != nil:
+		r.stats[opMissing].record(err)
+		r.cacheError("find missing", id, err)
+	case missing:
+		r.stats[opMissing].record(nil)
+		return nil, utils.ErrNotExist
+	default:
+		r.stats[opMissing].record(utils.ErrNotExist)
+	}
+
+	// the shared read must not fail for everyone when the first caller
+	// goes away
+	shared, err, _ := r.group.Do("book:"+id, func() (interface{}, error) {
+		ctx := context.WithoutCancel(ctx)
+		// read before the database, see InsertMissingBook
+		generation, genErr := r.cache.BookListGeneration(ctx)
+		book, err := r.repo.GetBookByISBN(ctx, id)
+		if errors.Is(err, utils.ErrNotExist) && genErr == nil {
+			if err := r.cache.InsertMissingBook(ctx, id, generation); err != nil {
+				r.cacheError("insert missing", id, err)
+			}
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = r.cache.InsertBook(ctx, book); err != nil {
+			r.cacheError("insert", id, err)
+		}
+		return book, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.requests.add(id)
+
+	// callers may modify their book
+	book = new(entity.Book)
+	*book = *shared.(*entity.Book)
+	return book, nil
+}
+
+func (r *CachedBookRepo) CreateBook(ctx context.Context, book *entity.BookFormCreate) (interface{}, error) {
+	id, err := r.repo.CreateBook(ctx, book)
+	if err != nil {
+		return nil, err
+	}
+
+	// the generation bump keeps reads running now from recording the book
+	// as missing again
+	r.invalidateLists(ctx)
+	if err = r.cache.DeleteMissingBook(ctx, book.ISBN); err != nil {
+		r.cacheError("delete missing", book.ISBN, err)
+	}
+	return id, nil
+}
+
+// ListBook caches pages per generation, any change to the catalog starts
+// a new one. The database is used directly when the generation cannot be
+// read.
+func (r *CachedBookRepo) ListBook(ctx context.Context, page, pageSize int) (*entity.PaginatedBooks, error) {
+	generation, err := r.cache.BookListGeneration(ctx)
+	if err != nil {
+		r.stats[opList].record(err)
+		r.cacheError("list generation", "", err)
+		return r.repo.ListBook(ctx, page, pageSize)
+	}
+
+	query := &entity.BookListQuery{Page: page, Limit: pageSize}
+	books, err := r.cache.FindBookList(ctx, generation, query)
+	r.stats[opList].record(err)
+	if err == nil {
+		books.Stale = !r.repo.Available()
+		return books, nil
+	}
+	if !errors.Is(err, utils.ErrNotExist) {
+		r.cacheError("find list", "", err)
+	}
+
+	key := fmt.Sprintf("list:%d:%d:%d", generation, page, pageSize)
+	shared, err, _ := r.group.Do(key, func() (interface{}, error) {
+		ctx := context.WithoutCancel(ctx)
+		books, err := r.repo.ListBook(ctx, page, pageSize)
+		if err != nil {
+			return nil, err
+		}
+		if err = r.cache.InsertBookList(ctx, generation, query, books); err != nil {
+			r.cacheError("insert list", "", err)
+		}
+		return books, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	books = new(entity.PaginatedBooks)
+	*books = *shared.(*entity.PaginatedBooks)
+	return books, nil
+}
+
+// UpdateBookByISBN updates the cached copy after the database. If that
+// fails the copy is evicted, so it is not served stale until it expires.
+func (r *CachedBookRepo) UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error {
+	if err := r.repo.UpdateBookByISBN(ctx, book); err != nil {
+		return err
+	}
+
+	err := r.cache.UpdateBookByISBN(ctx, book)
+	if err != nil && !errors.Is(err, utils.ErrNotExist) {
+		r.cacheError("update", book.ISBN, err)
+		r.evict(ctx, book.ISBN)
+	}
+	r.invalidateLists(ctx)
+	return nil
+}
+
+func (r *CachedBookRepo) DeleteBookByISBN(ctx context.Context, id string) error {
+	if err := r.repo.DeleteBookByISBN(ctx, id); err != nil {
+		return err
+	}
+
+	r.evict(ctx, id)
+	r.invalidateLists(ctx)
+	return nil
+}
+
+func (r *CachedBookRepo) evict(ctx context.Context, id string) {
+	err := r.cache.DeleteBookByISBN(ctx, id)
+	if err != nil && !errors.Is(err, utils.ErrNotExist) {
+		r.cacheError("delete", id, err)
+	}
+}
+
+func (r *CachedBookRepo) invalidateLists(ctx context.Context) {
+	if err := r.cache.InvalidateBookLists(ctx); err != nil {
+		r.cacheError("invalidate lists", "", err)
+	}
+}
+
+func (r *CachedBookRepo) cacheError(op, isbn string, err error) {
+	// an open breaker fails every call, logging each would flood the log
+	if errors.Is(err, breaker.ErrOpen) {
+		return
+	}
+	r.logger.Warn("book cache error", zap.String("op", op), zap.String("isbn", isbn), zap.Error(err))
+}
@@ -0,0 +1,178 @@
+package bookService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"template/internal/entity"
+	"template/internal/utils"
+)
+
+// Cache operations whose lookups are counted.
+const (
+	opGet     = "get"
+	opMissing = "missing"
+	opList    = "list"
+)
+
+// maxTrackedBooks bounds the ISBNs whose reads are counted for pre-warming.
+const maxTrackedBooks = 10000
+
+type opStats struct {
+	hits, misses, errors atomic.Int64
+}
+
+func (s *opStats) record(err error) {
+	switch {
+	case err == nil:
+		s.hits.Add(1)
+	case errors.Is(err, utils.ErrNotExist):
+		s.misses.Add(1)
+	default:
+		s.errors.Add(1)
+	}
+}
+
+func (s *opStats) snapshot() entity.CacheOpStats {
+	res := entity.CacheOpStats{
+		Hits:   s.hits.Load(),
+		Misses: s.misses.Load(),
+		Errors: s.errors.Load(),
+	}
+	if total := res.Hits + res.Misses + res.Errors; total > 0 {
+		res.HitRatio = float64(res.Hits) / float64(total)
+	}
+	return res
+}
+
+// requestCounter counts the reads of every ISBN served by this replica.
+// Once max ISBNs are tracked all counts are halved and the ones reaching
+// zero dropped, so old traffic fades out and a scan of many ISBNs read
+// once cannot grow it.
+type requestCounter struct {
+	mu     sync.Mutex
+	max    int
+	counts map[string]int64
+}
+
+func newRequestCounter(max int) *requestCounter {
+	return &requestCounter{
+		max:    max,
+		counts: make(map[string]int64),
+	}
+}
+
+func (c *requestCounter) add(id string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.counts[id]; !ok {
+		for len(c.counts) >= c.max {
+			for key, n := range c.counts {
+				if n /= 2; n == 0 {
+					delete(c.counts, key)
+				} else {
+					c.counts[key] = n
+				}
+			}
+		}
+	}
+	c.counts[id]++
+}
+
+// top returns up to n ISBNs, the most read first.
+func (c *requestCounter) top(n int) []string {
+	c.mu.Lock()
+	counts := maps.Clone(c.counts)
+	c.mu.Unlock()
+
+	ids := make([]string, 0, len(counts))
+	for id := range counts {
+		ids = append(ids, id)
+	}
+
+	sort.Slice(ids, func(i, j int) bool {
+		return counts[ids[i]] > counts[ids[j]]
+	})
+	if len(ids) > n {
+		ids = ids[:n]
+	}
+	return ids
+}
+
+// Stats reports the lookups counted by this replica since it started and
+// what the cache backend knows about its size.
+func (r *CachedBookRepo) Stats(ctx context.Context) (*entity.CacheStats, error) {
+	usage, err := r.cache.BookCacheUsage(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &entity.CacheStats{
+		Operations:     make(map[string]entity.CacheOpStats, len(r.stats)),
+		BookCacheUsage: *usage,
+	}
+	for op, s := range r.stats {
+		stats.Operations[op] = s.snapshot()
+	}
+	return stats, nil
+}
+
+// Evict drops the cached book, or the record of it missing.
+func (r *CachedBookRepo) Evict(ctx context.Context, id string) error {
+	err := r.cache.DeleteBookByISBN(ctx, id)
+	if err != nil && !errors.Is(err, utils.ErrNotExist) {
+		return err
+	}
+	return r.cache.DeleteMissingBook(ctx, id)
+}
+
+// Flush deletes every cached book and page.
+func (r *CachedBookRepo) Flush(ctx context.Context) (int, error) {
+	flushed, err := r.cache.FlushBooks(ctx)
+	if err != nil {
+		return flushed, err
+	}
+	if err = r.cache.InvalidateBookLists(ctx); err != nil {
+		return flushed, err
+	}
+	return flushed, nil
+}
+
+// Warm caches up to limit books picked by entity.CacheWarmPopular or
+// entity.CacheWarmRecent and returns how many were cached. Books already
+// in the cache are left as they are.
+func (r *CachedBookRepo) Warm(ctx context.Context, by string, limit int) (int, error) {
+	var (
+		books []*entity.Book
+		err   error
+	)
+	switch by {
+	case entity.CacheWarmPopular:
+		ids := r.requests.top(limit)
+		if len(ids) == 0 {
+			return 0, nil
+		}
+		books, err = r.repo.GetBooksByISBN(ctx, ids)
+	case entity.CacheWarmRecent:
+		books, err = r.repo.ListRecentBooks(ctx, limit)
+	default:
+		return 0, fmt.Errorf("unknown warm order %q: %w", by, utils.ErrBadInput)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	warmed := 0
+	for _, book := range books {
+		if err = r.cache.InsertBook(ctx, book); err != nil {
+			return warmed, err
+		}
+		warmed++
+	}
+	return warmed, nil
+}
@@ -0,0 +1,157 @@
+package bookService
+
+import (
+	"context"
+	"slices"
+	"template/internal/entity"
+	"template/internal/utils"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// maxReportedISBNs caps the ISBN lists of a consistency report.
+const maxReportedISBNs = 100
+
+// CheckConsistency walks the books set and compares every cached entry
+// with the database. With repair, drifting entries are evicted and the
+// next read caches the database copy again, which is safe even when a
+// book changes while the check runs. Only one check runs at a time.
+func (r *CachedBookRepo) CheckConsistency(ctx context.Context, repair bool) (*entity.ConsistencyReport, error) {
+	if !r.checking.TryLock() {
+		return nil, utils.ErrCheckRunning
+	}
+	defer r.checking.Unlock()
+
+	report := &entity.ConsistencyReport{StartedAt: time.Now(), Repair: repair}
+	var cursor uint64
+	for {
+		entries, next, err := r.cache.ScanCachedBooks(ctx, cursor)
+		if err != nil {
+			return r.finish(ctx, report, err)
+		}
+		if err = r.checkEntries(ctx, report, entries, repair); err != nil {
+			return r.finish(ctx, report, err)
+		}
+
+		if next == 0 {
+			return r.finish(ctx, report, nil)
+		}
+		cursor = next
+	}
+}
+
+// finish invalidates the cached pages when books were evicted, they may
+// hold the same drift.
+func (r *CachedBookRepo) finish(ctx context.Context, report *entity.ConsistencyReport, err error) (*entity.ConsistencyReport, error) {
+	if report.Repaired > 0 {
+		r.invalidateLists(ctx)
+	}
+	report.FinishedAt = time.Now()
+	if err != nil {
+		report.Error = err.Error()
+	}
+	r.lastCheck.Store(report)
+	return report, err
+}
+
+func (r *CachedBookRepo) checkEntries(ctx context.Context, report *entity.ConsistencyReport, entries []*entity.CachedBook, repair bool) error {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if !entry.Gone {
+			ids = append(ids, entry.ISBN)
+		}
+	}
+	byISBN := make(map[string]*entity.Book, len(ids))
+	if len(ids) > 0 {
+		stored, err := r.repo.GetBooksByISBN(ctx, ids)
+		if err != nil {
+			return err
+		}
+		for _, book := range stored {
+			byISBN[book.ISBN] = book
+		}
+	}
+
+	for _, entry := range entries {
+		report.Checked++
+		book, exists := byISBN[entry.ISBN]
+		stale := exists && (entry.NotFound || !sameBook(entry.Book, book))
+
+		switch {
+		case entry.Gone:
+			report.Missing++
+		case stale:
+			report.Stale++
+			if len(report.StaleISBNs) < maxReportedISBNs {
+				report.StaleISBNs = append(report.StaleISBNs, entry.ISBN)
+			}
+		case !entry.NotFound && !exists:
+			report.Orphaned++
+			if len(report.OrphanedISBNs) < maxReportedISBNs {
+				report.OrphanedISBNs = append(report.OrphanedISBNs, entry.ISBN)
+			}
+		default:
+			continue
+		}
+
+		if !repair {
+			continue
+		}
+		var err error
+		if entry.NotFound {
+			err = r.cache.DeleteMissingBook(ctx, entry.ISBN)
+		} else {
+			err = r.cache.DeleteBookByISBN(ctx, entry.ISBN)
+		}
+		if err != nil {
+			return err
+		}
+		report.Repaired++
+	}
+	return nil
+}
+
+// sameBook compares a cached copy with the database one, a copy that could
+// not be decoded never matches.
+func sameBook(cached, stored *entity.Book) bool {
+	return cached != nil &&
+		cached.Title == stored.Title &&
+		cached.Publisher == stored.Publisher &&
+		slices.Equal(cached.Author, stored.Author) &&
+		cached.CreatedAt.Equal(stored.CreatedAt) &&
+		cached.UpdatedAt.Equal(stored.UpdatedAt)
+}
+
+// LastConsistencyCheck returns the report of the latest check, scheduled
+// or not, or nil before the first one.
+func (r *CachedBookRepo) LastConsistencyCheck() *entity.ConsistencyReport {
+	return r.lastCheck.Load()
+}
+
+// ScheduleConsistencyCheck runs a check every interval until ctx is done.
+func (r *CachedBookRepo) ScheduleConsistencyCheck(ctx context.Context, interval time.Duration, repair bool) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		report, err := r.CheckConsistency(ctx, repair)
+		if err != nil {
+			r.logger.Warn("book cache consistency check failed", zap.Error(err))
+			continue
+		}
+		r.logger.Info("book cache consistency check",
+			zap.Int("checked", report.Checked),
+			zap.Int("missing", report.Missing),
+			zap.Int("stale", report.Stale),
+			zap.Int("orphaned", report.Orphaned),
+			zap.Int("repaired", report.Repaired),
+		)
+	}
+}
@@ -0,0 +1,180 @@
+package bookService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/breaker"
+)
+
+// GuardedBookRepo runs every database call through a circuit breaker, so
+// a slow or failing database answers utils.ErrUnavailable at once instead
+// of holding requests until the write timeout.
+type GuardedBookRepo struct {
+	repo    bookStore
+	breaker *breaker.Breaker
+}
+
+func NewGuardedBookRepo(repo bookStore, b *breaker.Breaker) *GuardedBookRepo {
+	return &GuardedBookRepo{
+		repo:    repo,
+		breaker: b,
+	}
+}
+
+// Available tells whether the database is believed to be up. Anything read
+// from the cache while it is not may be stale.
+func (r *GuardedBookRepo) Available() bool {
+	return r.breaker.State() == breaker.Closed
+}
+
+func (r *GuardedBookRepo) GetBookByISBN(ctx context.Context, id string) (*entity.Book, error) {
+	book, err := breaker.Call(ctx, r.breaker, func(ctx context.Context) (*entity.Book, error) {
+		return r.repo.GetBookByISBN(ctx, id)
+	})
+	return book, unavailable(err)
+}
+
+func (r *GuardedBookRepo) CreateBook(ctx context.Context, book *entity.BookFormCreate) (interface{}, error) {
+	id, err := breaker.Call(ctx, r.breaker, func(ctx context.Context) (interface{}, error) {
+		return r.repo.CreateBook(ctx, book)
+	})
+	return id, unavailable(err)
+}
+
+func (r *GuardedBookRepo) ListBook(ctx context.Context, page, pageSize int) (*entity.PaginatedBooks, error) {
+	books, err := breaker.Call(ctx, r.breaker, func(ctx context.Context) (*entity.PaginatedBooks, error) {
+		return r.repo.ListBook(ctx, page, pageSize)
+	})
+	return books, unavailable(err)
+}
+
+func (r *GuardedBookRepo) UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error {
+	return unavailable(r.breaker.Do(ctx, func(ctx context.Context) error {
+		return r.repo.UpdateBookByISBN(ctx, book)
+	}))
+}
+
+func (r *GuardedBookRepo) DeleteBookByISBN(ctx context.Context, id string) error {
+	return unavailable(r.breaker.Do(ctx, func(ctx context.Context) error {
+		return r.repo.DeleteBookByISBN(ctx, id)
+	}))
+}
+
+func (r *GuardedBookRepo) GetBooksByISBN(ctx context.Context, ids []string) ([]*entity.Book, error) {
+	books, err := breaker.Call(ctx, r.breaker, func(ctx context.Context) ([]*entity.Book, error) {
+		return r.repo.GetBooksByISBN(ctx, ids)
+	})
+	return books, unavailable(err)
+}
+
+func (r *GuardedBookRepo) ListRecentBooks(ctx context.Context, limit int) ([]*entity.Book, error) {
+	books, err := breaker.Call(ctx, r.breaker, func(ctx context.Context) ([]*entity.Book, error) {
+		return r.repo.ListRecentBooks(ctx, limit)
+	})
+	return books, unavailable(err)
+}
+
+func unavailable(err error) error {
+	if errors.Is(err, breaker.ErrOpen) || errors.Is(err, breaker.ErrTimeout) {
+		return fmt.Errorf("%w: %w", utils.ErrUnavailable, err)
+	}
+	return err
+}
+
+// GuardedBookCache runs cache calls through a circuit breaker. Its errors
+// make CachedBookRepo bypass the cache, so an unreachable cache costs one
+// timeout per call until the breaker opens and nothing after.
+type GuardedBookCache struct {
+	cache   bookCache
+	breaker *breaker.Breaker
+}
+
+func NewGuardedBookCache(cache bookCache, b *breaker.Breaker) *GuardedBookCache {
+	return &GuardedBookCache{
+		cache:   cache,
+		breaker: b,
+	}
+}
+
+func (c *GuardedBookCache) InsertBook(ctx context.Context, book *entity.Book) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.InsertBook(ctx, book)
+	})
+}
+
+func (c *GuardedBookCache) FindBookByISBN(ctx context.Context, id string) (*entity.Book, error) {
+	return breaker.Call(ctx, c.breaker, func(ctx context.Context) (*entity.Book, error) {
+		return c.cache.FindBookByISBN(ctx, id)
+	})
+}
+
+func (c *GuardedBookCache) UpdateBookByISBN(ctx context.Context, book *entity.BookFormUpdate) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.UpdateBookByISBN(ctx, book)
+	})
+}
+
+func (c *GuardedBookCache) DeleteBookByISBN(ctx context.Context, id string) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.DeleteBookByISBN(ctx, id)
+	})
+}
+
+func (c *GuardedBookCache) BookListGeneration(ctx context.Context) (int64, error) {
+	return breaker.Call(ctx, c.breaker, func(ctx context.Context) (int64, error) {
+		return c.cache.BookListGeneration(ctx)
+	})
+}
+
+func (c *GuardedBookCache) FindBookList(ctx context.Context, generation int64, query *entity.BookListQuery) (*entity.PaginatedBooks, error) {
+	return breaker.Call(ctx, c.breaker, func(ctx context.Context) (*entity.PaginatedBooks, error) {
+		return c.cache.FindBookList(ctx, generation, query)
+	})
+}
+
+func (c *GuardedBookCache) InsertBookList(ctx context.Context, generation int64, query *entity.BookListQuery, books *entity.PaginatedBooks) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.InsertBookList(ctx, generation, query, books)
+	})
+}
+
+func (c *GuardedBookCache) InvalidateBookLists(ctx context.Context) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.InvalidateBookLists(ctx)
+	})
+}
+
+func (c *GuardedBookCache) IsBookMissing(ctx context.Context, id string) (bool, error) {
+	return breaker.Call(ctx, c.breaker, func(ctx context.Context) (bool, error) {
+		return c.cache.IsBookMissing(ctx, id)
+	})
+}
+
+func (c *GuardedBookCache) InsertMissingBook(ctx context.Context, id string, generation int64) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.InsertMissingBook(ctx, id, generation)
+	})
+}
+
+func (c *GuardedBookCache) DeleteMissingBook(ctx context.Context, id string) error {
+	return c.breaker.Do(ctx, func(ctx context.Context) error {
+		return c.cache.DeleteMissingBook(ctx, id)
+	})
+}
+
+// BookCacheUsage, FlushBooks and ScanCachedBooks are admin operations
+// walking the books set, they are not bound by the per-call timeout.
+func (c *GuardedBookCache) BookCacheUsage(ctx context.Context) (*entity.BookCacheUsage, error) {
+	return c.cache.BookCacheUsage(ctx)
+}
+
+func (c *GuardedBookCache) FlushBooks(ctx context.Context) (int, error) {
+	return c.cache.FlushBooks(ctx)
+}
+
+func (c *GuardedBookCache) ScanCachedBooks(ctx context.Context, cursor uint64) ([]*entity.CachedBook, uint64, error) {
+	return c.cache.ScanCachedBooks(ctx, cursor)
+}
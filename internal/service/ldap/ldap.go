@@ -0,0 +1,197 @@
+package ldapService
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"template/internal/entity"
+	"template/internal/utils"
+	"time"
+
+	"github.com/go-ldap/ldap/v3"
+)
+
+const defaultTimeout = 5 * time.Second
+
+// Config holds the directory connection and the attribute mapping, see
+// config.LDAPConfig.
+type Config struct {
+	URL          string
+	StartTLS     bool
+	BindDN       string
+	BindPassword string
+	BaseDN       string
+	// UserFilter is a filter with a single %s receiving the escaped
+	// username, e.g. (uid=%s) or (sAMAccountName=%s).
+	UserFilter string
+	Timeout    time.Duration
+
+	IDAttribute          string // empty uses the entry DN
+	UsernameAttribute    string
+	EmailAttribute       string
+	DisplayNameAttribute string
+	GroupsAttribute      string
+	RoleMapping          map[string]int
+}
+
+// LDAPAuthenticator checks passwords with a search-then-bind against an
+// LDAP directory such as OpenLDAP or Active Directory.
+type LDAPAuthenticator struct {
+	cfg Config
+}
+
+// NewLDAPAuthenticator fills unset attributes with the inetOrgPerson
+// defaults.
+func NewLDAPAuthenticator(cfg Config) *LDAPAuthenticator {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultTimeout
+	}
+	setDefault(&cfg.UserFilter, "(uid=%s)")
+	setDefault(&cfg.UsernameAttribute, "uid")
+	setDefault(&cfg.EmailAttribute, "mail")
+	setDefault(&cfg.DisplayNameAttribute, "cn")
+	setDefault(&cfg.GroupsAttribute, "memberOf")
+	return &LDAPAuthenticator{cfg: cfg}
+}
+
+// Authenticate binds as the directory entry matching username. It returns
+// utils.ErrInvalidCredentials when there is no single matching entry or the
+// directory rejects the password.
+func (a *LDAPAuthenticator) Authenticate(ctx context.Context, username, password string) (*entity.ExternalIdentity, error) {
+	// an empty password would be an unauthenticated bind, which most
+	// directories accept for any DN
+	if username == "" || password == "" {
+		return nil, utils.ErrInvalidCredentials
+	}
+
+	conn, err := a.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if a.cfg.BindDN != "" {
+		if err = conn.Bind(a.cfg.BindDN, a.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	entry, err := a.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	err = conn.Bind(entry.DN, password)
+	switch {
+	case err == nil:
+	case ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials):
+		return nil, utils.ErrInvalidCredentials
+	default:
+		return nil, fmt.Errorf("ldap bind: %w", err)
+	}
+
+	ext := a.mapEntry(entry)
+	if ext.Username == "" {
+		ext.Username = username
+	}
+	return ext, nil
+}
+
+func (a *LDAPAuthenticator) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: a.cfg.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+
+	conn, err := ldap.DialURL(a.cfg.URL, ldap.DialWithDialer(dialer))
+	if err != nil {
+		return nil, fmt.Errorf("ldap dial: %w", err)
+	}
+	conn.SetTimeout(a.cfg.Timeout)
+
+	if a.cfg.StartTLS {
+		u, err := url.Parse(a.cfg.URL)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap url: %w", err)
+		}
+		if err = conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+func (a *LDAPAuthenticator) findUser(conn *ldap.Conn, username string) (*ldap.Entry, error) {
+	attributes := []string{a.cfg.UsernameAttribute, a.cfg.EmailAttribute, a.cfg.DisplayNameAttribute, a.cfg.GroupsAttribute}
+	if a.cfg.IDAttribute != "" {
+		attributes = append(attributes, a.cfg.IDAttribute)
+	}
+
+	// a size limit of 2 is enough to tell an ambiguous filter from a
+	// unique match
+	res, err := conn.Search(ldap.NewSearchRequest(
+		a.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases, 2, int(a.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(a.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil && !ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if res == nil || len(res.Entries) != 1 {
+		return nil, utils.ErrInvalidCredentials
+	}
+	return res.Entries[0], nil
+}
+
+func (a *LDAPAuthenticator) mapEntry(entry *ldap.Entry) *entity.ExternalIdentity {
+	ext := &entity.ExternalIdentity{
+		Provider:    entity.ProviderLDAP,
+		Subject:     entry.DN,
+		Username:    entry.GetAttributeValue(a.cfg.UsernameAttribute),
+		Email:       entry.GetAttributeValue(a.cfg.EmailAttribute),
+		DisplayName: entry.GetAttributeValue(a.cfg.DisplayNameAttribute),
+	}
+	if a.cfg.IDAttribute != "" {
+		// objectGUID and friends are binary, so the raw value is hex encoded
+		if raw := entry.GetRawAttributeValue(a.cfg.IDAttribute); len(raw) > 0 {
+			ext.Subject = hex.EncodeToString(raw)
+		}
+	}
+
+	if len(a.cfg.RoleMapping) > 0 {
+		role := entity.RoleUser
+		for _, group := range entry.GetAttributeValues(a.cfg.GroupsAttribute) {
+			if mapped, ok := a.roleForGroup(group); ok && mapped > role {
+				role = mapped
+			}
+		}
+		ext.Role = &role
+	}
+	return ext
+}
+
+// roleForGroup matches group DNs case-insensitively, directories do not
+// preserve the case used in the configuration.
+func (a *LDAPAuthenticator) roleForGroup(group string) (int, bool) {
+	if role, ok := a.cfg.RoleMapping[group]; ok {
+		return role, true
+	}
+	for dn, role := range a.cfg.RoleMapping {
+		if strings.EqualFold(dn, group) {
+			return role, true
+		}
+	}
+	return 0, false
+}
+
+func setDefault(value *string, def string) {
+	if *value == "" {
+		*value = def
+	}
+}
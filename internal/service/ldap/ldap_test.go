@@ -0,0 +1,514 @@
+package ldapService
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/service/user/usertest"
+	"template/internal/utils"
+	"testing"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+const (
+	testBaseDN          = "dc=example,dc=org"
+	testServiceDN       = "cn=library,ou=services,dc=example,dc=org"
+	testServicePassword = "service-secret"
+	testLibrariansDN    = "cn=Librarians,ou=groups,dc=example,dc=org"
+)
+
+// directory is an in-process LDAP server answering simple binds and
+// searches with equality filters. Like most real directories it accepts
+// a bind with an empty password as unauthenticated, for any DN.
+type directory struct {
+	listener net.Listener
+
+	mu      sync.Mutex
+	entries map[string]*dirEntry
+	// ops records the binds and searches in the order they arrived
+	ops []string
+}
+
+type dirEntry struct {
+	password   string
+	attributes map[string][]string
+}
+
+func newDirectory(t *testing.T) *directory {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := &directory{listener: listener, entries: make(map[string]*dirEntry)}
+	d.add(testServiceDN, testServicePassword, nil)
+	go d.serve()
+	t.Cleanup(func() { listener.Close() })
+	return d
+}
+
+func (d *directory) url() string {
+	return "ldap://" + d.listener.Addr().String()
+}
+
+func (d *directory) add(dn, password string, attributes map[string][]string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[dn] = &dirEntry{password: password, attributes: attributes}
+}
+
+func (d *directory) setAttribute(dn, name string, values ...string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.entries[dn].attributes[name] = values
+}
+
+func (d *directory) recorded() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return append([]string(nil), d.ops...)
+}
+
+func (d *directory) record(op string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.ops = append(d.ops, op)
+}
+
+func (d *directory) serve() {
+	for {
+		conn, err := d.listener.Accept()
+		if err != nil {
+			return
+		}
+		go d.handle(conn)
+	}
+}
+
+func (d *directory) handle(conn net.Conn) {
+	defer conn.Close()
+
+	bound := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		var responses []*ber.Packet
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			var code int64
+			bound, code = d.bind(op)
+			responses = append(responses, result(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			responses = d.search(op, bound)
+		case ldap.ApplicationUnbindRequest:
+			return
+		default:
+			return
+		}
+
+		for _, res := range responses {
+			message := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+			message.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "Message ID"))
+			message.AppendChild(res)
+			if _, err = conn.Write(message.Bytes()); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// bind returns the DN the connection is bound as and the result code.
+func (d *directory) bind(op *ber.Packet) (string, int64) {
+	dn, password := op.Children[1].Data.String(), op.Children[2].Data.String()
+	d.record("bind " + dn)
+
+	if password == "" {
+		return "", ldap.LDAPResultSuccess
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if entry, ok := d.entries[dn]; ok && entry.password == password {
+		return dn, ldap.LDAPResultSuccess
+	}
+	return "", ldap.LDAPResultInvalidCredentials
+}
+
+func (d *directory) search(op *ber.Packet, bound string) []*ber.Packet {
+	if bound != testServiceDN {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultInsufficientAccessRights)}
+	}
+
+	base := op.Children[0].Data.String()
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter, err := ldap.DecompileFilter(op.Children[6])
+	if err != nil {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError)}
+	}
+	d.record("search " + filter)
+
+	// only equality filters like (uid=alice) are understood
+	name, value, ok := strings.Cut(strings.TrimSuffix(strings.TrimPrefix(filter, "("), ")"), "=")
+	if !ok {
+		return []*ber.Packet{result(ldap.ApplicationSearchResultDone, ldap.LDAPResultUnwillingToPerform)}
+	}
+
+	var attributes []string
+	for _, attr := range op.Children[7].Children {
+		attributes = append(attributes, attr.Data.String())
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	var res []*ber.Packet
+	for dn, entry := range d.entries {
+		if !strings.HasSuffix(dn, ","+base) || !contains(entry.attributes[name], value) {
+			continue
+		}
+		if sizeLimit > 0 && int64(len(res)) == sizeLimit {
+			return append(res, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSizeLimitExceeded))
+		}
+		res = append(res, searchEntry(dn, entry, attributes))
+	}
+	return append(res, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func result(tag ber.Tag, code int64) *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	res.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, code, "Result Code"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return res
+}
+
+func searchEntry(dn string, entry *dirEntry, attributes []string) *ber.Packet {
+	res := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	res.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, dn, "Object Name"))
+
+	attrs := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for _, name := range attributes {
+		values, ok := entry.attributes[name]
+		if !ok {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		for _, value := range values {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		}
+		attr.AppendChild(set)
+		attrs.AppendChild(attr)
+	}
+	res.AppendChild(attrs)
+	return res
+}
+
+func userDN(uid string) string {
+	return "uid=" + uid + ",ou=people," + testBaseDN
+}
+
+func addUser(d *directory, uid, password string, groups ...string) {
+	d.add(userDN(uid), password, map[string][]string{
+		"uid":        {uid},
+		"mail":       {strings.ToUpper(uid[:1]) + uid[1:] + "@Example.org"},
+		"cn":         {strings.ToUpper(uid[:1]) + uid[1:] + " Example"},
+		"memberOf":   groups,
+		"objectGUID": {"\x01\x02\xab" + uid},
+	})
+}
+
+func testConfig(d *directory) Config {
+	return Config{
+		URL:          d.url(),
+		BindDN:       testServiceDN,
+		BindPassword: testServicePassword,
+		BaseDN:       testBaseDN,
+		RoleMapping:  map[string]int{strings.ToLower(testLibrariansDN): entity.RoleAdmin},
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	d := newDirectory(t)
+	addUser(d, "alice", "alice-password")
+	addUser(d, "bob", "bob-password", testLibrariansDN)
+	// two entries matching (uid=twin) make the login ambiguous
+	addUser(d, "twin", "twin-password")
+	d.add("uid=twin,ou=staff,"+testBaseDN, "twin-password", map[string][]string{"uid": {"twin"}})
+
+	adminRole, userRole := entity.RoleAdmin, entity.RoleUser
+	tests := []struct {
+		name     string
+		cfg      func(cfg *Config)
+		username string
+		password string
+		want     *entity.ExternalIdentity
+		wantErr  error
+	}{
+		{
+			name:     "search then bind",
+			username: "alice",
+			password: "alice-password",
+			want: &entity.ExternalIdentity{
+				Provider:    entity.ProviderLDAP,
+				Subject:     userDN("alice"),
+				Username:    "alice",
+				Email:       "Alice@Example.org",
+				DisplayName: "Alice Example",
+				Role:        &userRole,
+			},
+		},
+		{
+			name:     "group mapped to role",
+			username: "bob",
+			password: "bob-password",
+			want: &entity.ExternalIdentity{
+				Provider:    entity.ProviderLDAP,
+				Subject:     userDN("bob"),
+				Username:    "bob",
+				Email:       "Bob@Example.org",
+				DisplayName: "Bob Example",
+				Role:        &adminRole,
+			},
+		},
+		{
+			name:     "no role mapping keeps the role",
+			cfg:      func(cfg *Config) { cfg.RoleMapping = nil },
+			username: "bob",
+			password: "bob-password",
+			want: &entity.ExternalIdentity{
+				Provider:    entity.ProviderLDAP,
+				Subject:     userDN("bob"),
+				Username:    "bob",
+				Email:       "Bob@Example.org",
+				DisplayName: "Bob Example",
+			},
+		},
+		{
+			name:     "binary id attribute",
+			cfg:      func(cfg *Config) { cfg.IDAttribute = "objectGUID" },
+			username: "alice",
+			password: "alice-password",
+			want: &entity.ExternalIdentity{
+				Provider:    entity.ProviderLDAP,
+				Subject:     "0102ab616c696365",
+				Username:    "alice",
+				Email:       "Alice@Example.org",
+				DisplayName: "Alice Example",
+				Role:        &userRole,
+			},
+		},
+		{
+			name:     "wrong password",
+			username: "alice",
+			password: "bob-password",
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+		{
+			name:     "empty password",
+			username: "alice",
+			password: "",
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+		{
+			name:     "unknown user",
+			username: "mallory",
+			password: "alice-password",
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+		{
+			name:     "filter injection",
+			username: "*",
+			password: "alice-password",
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+		{
+			name:     "ambiguous user",
+			username: "twin",
+			password: "twin-password",
+			wantErr:  utils.ErrInvalidCredentials,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := testConfig(d)
+			if tc.cfg != nil {
+				tc.cfg(&cfg)
+			}
+
+			ext, err := NewLDAPAuthenticator(cfg).Authenticate(context.Background(), tc.username, tc.password)
+			if tc.wantErr != nil {
+				if !errors.Is(err, tc.wantErr) {
+					t.Fatalf("Authenticate = %+v, %v, want %v", ext, err, tc.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Authenticate: %v", err)
+			}
+			assertIdentity(t, ext, tc.want)
+		})
+	}
+}
+
+func assertIdentity(t *testing.T, got, want *entity.ExternalIdentity) {
+	t.Helper()
+	if got.Provider != want.Provider || got.Subject != want.Subject || got.Username != want.Username ||
+		got.Email != want.Email || got.DisplayName != want.DisplayName ||
+		(got.Role == nil) != (want.Role == nil) || (got.Role != nil && *got.Role != *want.Role) {
+		t.Fatalf("identity = %+v, want %+v", got, want)
+	}
+}
+
+func TestAuthenticateSearchThenBind(t *testing.T) {
+	d := newDirectory(t)
+	addUser(d, "alice", "alice-password")
+
+	if _, err := NewLDAPAuthenticator(testConfig(d)).Authenticate(context.Background(), "alice", "alice-password"); err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	want := []string{"bind " + testServiceDN, "search (uid=alice)", "bind " + userDN("alice")}
+	if got := d.recorded(); strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("directory operations = %q, want %q", got, want)
+	}
+}
+
+func TestAuthenticateEmptyPasswordNeverBinds(t *testing.T) {
+	d := newDirectory(t)
+	addUser(d, "alice", "alice-password")
+
+	if _, err := NewLDAPAuthenticator(testConfig(d)).Authenticate(context.Background(), "alice", ""); !errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want ErrInvalidCredentials", err)
+	}
+	if ops := d.recorded(); len(ops) != 0 {
+		t.Fatalf("directory operations = %q, want none", ops)
+	}
+}
+
+func TestAuthenticateServiceBindFails(t *testing.T) {
+	d := newDirectory(t)
+	addUser(d, "alice", "alice-password")
+	cfg := testConfig(d)
+	cfg.BindPassword = "outdated"
+
+	_, err := NewLDAPAuthenticator(cfg).Authenticate(context.Background(), "alice", "alice-password")
+	if err == nil || errors.Is(err, utils.ErrInvalidCredentials) {
+		t.Fatalf("Authenticate error = %v, want a directory error", err)
+	}
+}
+
+func login(t *testing.T, users interface {
+	Login(ctx context.Context, form *v1.UserLoginForm) (*entity.LoginResult, error)
+}, username, password string) (*entity.LoginResult, error) {
+	t.Helper()
+	return users.Login(context.Background(), &v1.UserLoginForm{Username: username, Password: password, IP: "192.0.2.1"})
+}
+
+func TestLoginProvisionsAndSyncsUser(t *testing.T) {
+	d := newDirectory(t)
+	addUser(d, "alice", "alice-password")
+	repo := usertest.NewRepo()
+	users, err := usertest.NewService(repo, NewLDAPAuthenticator(testConfig(d)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err := login(t, users, "alice", "alice-password")
+	if err != nil {
+		t.Fatalf("first Login: %v", err)
+	}
+	if res.Tokens == nil {
+		t.Fatalf("first Login = %+v, want tokens", res)
+	}
+	stored := repo.Users()
+	if len(stored) != 1 {
+		t.Fatalf("%d users after the first login, want 1", len(stored))
+	}
+	if user := stored[0]; user.Username != "alice" || user.Email != "alice@example.org" ||
+		user.DisplayName != "Alice Example" || user.Role != entity.RoleUser ||
+		user.ExternalIDs[entity.ProviderLDAP] != userDN("alice") {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+
+	d.setAttribute(userDN("alice"), "mail", "alice@library.example")
+	d.setAttribute(userDN("alice"), "cn", "Alice Librarian")
+	d.setAttribute(userDN("alice"), "memberOf", testLibrariansDN)
+
+	if _, err = login(t, users, "alice", "alice-password"); err != nil {
+		t.Fatalf("second Login: %v", err)
+	}
+	stored = repo.Users()
+	if len(stored) != 1 {
+		t.Fatalf("%d users after the second login, want 1", len(stored))
+	}
+	if user := stored[0]; user.Email != "alice@library.example" || user.DisplayName != "Alice Librarian" ||
+		user.Role != entity.RoleAdmin {
+		t.Fatalf("synced user = %+v", user)
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	d := newDirectory(t)
+	addUser(d, "alice", "alice-password")
+	addUser(d, "bob", "bob-directory-password")
+
+	repo := usertest.NewRepo()
+	// a local account holds the username of a directory user
+	local := repo.AddUser(&entity.User{Username: "bob", Email: "bob@local.example", HashedPassword: "local-hash"})
+	users, err := usertest.NewService(repo, NewLDAPAuthenticator(testConfig(d)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		password string
+	}{
+		{name: "wrong password", username: "alice", password: "bob-directory-password"},
+		{name: "empty password", username: "alice", password: ""},
+		{name: "username of a local account", username: "bob", password: "bob-directory-password"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := login(t, users, tc.username, tc.password)
+			// all of them look like a wrong password to the client
+			if !errors.Is(err, utils.ErrUserNotFound) {
+				t.Fatalf("Login = %+v, %v, want ErrUserNotFound", res, err)
+			}
+		})
+	}
+
+	stored := repo.Users()
+	if len(stored) != 1 || stored[0].ID != local.ID || stored[0].ExternalIDs != nil {
+		t.Fatalf("users = %+v, want the local account untouched", stored)
+	}
+}
@@ -0,0 +1,230 @@
+package lockoutService
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/validator"
+	"time"
+)
+
+// maxLockout bounds the lockout when no upper bound is configured, and
+// keeps the doubling from overflowing.
+const maxLockout = 365 * 24 * time.Hour
+
+type LockoutService struct {
+	attemptRepo attemptRepo
+	auditRepo   auditRepo
+
+	maxAttempts   int
+	maxIPAttempts int
+	window        time.Duration
+	baseLockout   time.Duration
+	maxLockout    time.Duration
+}
+
+func NewLockoutService(attemptRepo attemptRepo, auditRepo auditRepo, maxAttempts, maxIPAttempts int, window, baseLockout, maxLockout time.Duration) *LockoutService {
+	return &LockoutService{
+		attemptRepo:   attemptRepo,
+		auditRepo:     auditRepo,
+		maxAttempts:   maxAttempts,
+		maxIPAttempts: maxIPAttempts,
+		window:        window,
+		baseLockout:   baseLockout,
+		maxLockout:    maxLockout,
+	}
+}
+
+type attemptRepo interface {
+	IncrAttempts(ctx context.Context, subject string, window time.Duration) (int64, error)
+	ResetAttempts(ctx context.Context, subject string) error
+	Lock(ctx context.Context, subject string, ttl time.Duration) error
+	LockTTL(ctx context.Context, subject string) (time.Duration, error)
+	Unlock(ctx context.Context, subject string) error
+}
+
+type auditRepo interface {
+	InsertAuditRecord(ctx context.Context, record *entity.AuditRecord) error
+}
+
+func userSubject(username string) string {
+	return "user:" + strings.TrimSpace(username)
+}
+
+func ipSubject(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns a *utils.LockoutError when either the username or the
+// client IP is currently locked out.
+func (s *LockoutService) Check(ctx context.Context, username, ip string) error {
+	var retryAfter time.Duration
+	for _, subject := range []string{userSubject(username), ipSubject(ip)} {
+		ttl, err := s.attemptRepo.LockTTL(ctx, subject)
+		if err != nil {
+			return err
+		}
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	if retryAfter > 0 {
+		return &utils.LockoutError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+// RegisterFailure counts a failed login for the username and the client IP
+// and locks whichever of them went over its limit.
+func (s *LockoutService) RegisterFailure(ctx context.Context, username, ip string) error {
+	if err := s.registerFailure(ctx, userSubject(username), s.maxAttempts, username, ip); err != nil {
+		return err
+	}
+	return s.registerFailure(ctx, ipSubject(ip), s.maxIPAttempts, username, ip)
+}
+
+func (s *LockoutService) registerFailure(ctx context.Context, subject string, limit int, username, ip string) error {
+	attempts, err := s.attemptRepo.IncrAttempts(ctx, subject, s.window)
+	if err != nil {
+		return err
+	}
+	if limit <= 0 || attempts < int64(limit) {
+		return nil
+	}
+
+	lockout := s.lockoutFor(attempts - int64(limit))
+	if err = s.attemptRepo.Lock(ctx, subject, lockout); err != nil {
+		return err
+	}
+
+	return s.auditRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action: entity.AuditLoginLockout,
+		Target: subject,
+		IP:     ip,
+		Details: map[string]string{
+			"username": username,
+			"attempts": strconv.FormatInt(attempts, 10),
+			"lockout":  lockout.String(),
+		},
+	})
+}
+
+// lockoutFor doubles the base lockout for every failure past the limit.
+func (s *LockoutService) lockoutFor(over int64) time.Duration {
+	limit := s.maxLockout
+	if limit <= 0 {
+		limit = maxLockout
+	}
+
+	lockout := s.baseLockout
+	for i := int64(0); i < over && lockout < limit; i++ {
+		lockout *= 2
+	}
+	if lockout > limit {
+		lockout = limit
+	}
+	return lockout
+}
+
+// RegisterSuccess clears the failed attempts of the username. The client IP
+// counter is kept, otherwise an attacker could reset it with an account of
+// their own.
+func (s *LockoutService) RegisterSuccess(ctx context.Context, username string) error {
+	return s.attemptRepo.ResetAttempts(ctx, userSubject(username))
+}
+
+func (s *LockoutService) Unlock(ctx context.Context, form *v1.UnlockInputForm, actorID string) error {
+	if !validator.NotBlank(form.Username) && !validator.NotBlank(form.IP) {
+		return fmt.Errorf("username or ip is required: %w", utils.ErrBadInput)
+	}
+
+	var subjects []string
+	if validator.NotBlank(form.Username) {
+		subjects = append(subjects, userSubject(form.Username))
+	}
+	if validator.NotBlank(form.IP) {
+		subjects = append(subjects, ipSubject(strings.TrimSpace(form.IP)))
+	}
+
+	for _, subject := range subjects {
+		if err := s.attemptRepo.Unlock(ctx, subject); err != nil {
+			return err
+		}
+		err := s.auditRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+			Action:  entity.AuditLoginUnlock,
+			ActorID: actorID,
+			Target:  subject,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Limiter caps how often an action, like requesting a password reset, is
+// taken per username and per client IP. Unlike failed logins every request
+// counts, and going over a limit blocks it for the rest of the window.
+type Limiter struct {
+	attemptRepo attemptRepo
+
+	action        string
+	maxRequests   int
+	maxIPRequests int
+	window        time.Duration
+}
+
+func NewLimiter(attemptRepo attemptRepo, action string, maxRequests, maxIPRequests int, window time.Duration) *Limiter {
+	return &Limiter{
+		attemptRepo:   attemptRepo,
+		action:        action,
+		maxRequests:   maxRequests,
+		maxIPRequests: maxIPRequests,
+		window:        window,
+	}
+}
+
+// Allow counts a request and returns a *utils.LockoutError when the
+// username or the client IP is over its limit.
+func (l *Limiter) Allow(ctx context.Context, username, ip string) error {
+	var retryAfter time.Duration
+	for subject, limit := range map[string]int{
+		l.action + ":" + userSubject(username): l.maxRequests,
+		l.action + ":" + ipSubject(ip):         l.maxIPRequests,
+	} {
+		ttl, err := l.allow(ctx, subject, limit)
+		if err != nil {
+			return err
+		}
+		if ttl > retryAfter {
+			retryAfter = ttl
+		}
+	}
+	if retryAfter > 0 {
+		return &utils.LockoutError{RetryAfter: retryAfter}
+	}
+	return nil
+}
+
+func (l *Limiter) allow(ctx context.Context, subject string, limit int) (time.Duration, error) {
+	if limit <= 0 {
+		return 0, nil
+	}
+	ttl, err := l.attemptRepo.LockTTL(ctx, subject)
+	if err != nil || ttl > 0 {
+		return ttl, err
+	}
+
+	requests, err := l.attemptRepo.IncrAttempts(ctx, subject, l.window)
+	if err != nil {
+		return 0, err
+	}
+	if requests <= int64(limit) {
+		return 0, nil
+	}
+	return l.window, l.attemptRepo.Lock(ctx, subject, l.window)
+}
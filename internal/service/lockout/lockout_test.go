@@ -0,0 +1,87 @@
+package lockoutService
+
+import (
+	"context"
+	"errors"
+	"template/internal/entity"
+	"template/internal/repository/memory"
+	"template/internal/utils"
+	"testing"
+	"time"
+)
+
+func TestLockoutFor(t *testing.T) {
+	tests := []struct {
+		name       string
+		base       time.Duration
+		maxLockout time.Duration
+		over       int64
+		want       time.Duration
+	}{
+		{"at the limit", time.Minute, time.Hour, 0, time.Minute},
+		{"one past", time.Minute, time.Hour, 1, 2 * time.Minute},
+		{"two past", time.Minute, time.Hour, 2, 4 * time.Minute},
+		{"five past", time.Minute, time.Hour, 5, 32 * time.Minute},
+		{"capped", time.Minute, time.Hour, 6, time.Hour},
+		{"far past the cap", time.Minute, time.Hour, 1000, time.Hour},
+		{"base above the cap", 2 * time.Hour, time.Hour, 0, time.Hour},
+		{"no cap configured", time.Minute, 0, 10, 1024 * time.Minute},
+		{"no cap configured, far past", time.Minute, 0, 1 << 40, maxLockout},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewLockoutService(nil, nil, 5, 20, time.Minute, tt.base, tt.maxLockout)
+			if got := s.lockoutFor(tt.over); got != tt.want {
+				t.Errorf("lockoutFor(%d) = %s, want %s", tt.over, got, tt.want)
+			}
+		})
+	}
+}
+
+type auditLog []*entity.AuditRecord
+
+func (a *auditLog) InsertAuditRecord(_ context.Context, record *entity.AuditRecord) error {
+	*a = append(*a, record)
+	return nil
+}
+
+// TestRegisterFailureDoubles checks that every failure past the limit locks
+// the username out for twice as long, up to the configured maximum.
+func TestRegisterFailureDoubles(t *testing.T) {
+	ctx := context.Background()
+	attempts := memory.NewMemoryRepo(time.Minute, time.Minute, 1000)
+	var audit auditLog
+	s := NewLockoutService(attempts, &audit, 3, 100, time.Hour, time.Minute, 4*time.Minute)
+
+	want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 4 * time.Minute}
+	for i, lockout := range want {
+		if err := s.RegisterFailure(ctx, "alice", "192.0.2.1"); err != nil {
+			t.Fatalf("failure %d: %v", i+1, err)
+		}
+
+		ttl, err := attempts.LockTTL(ctx, userSubject("alice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the TTL runs down from the lockout while the test runs
+		if ttl > lockout || ttl < lockout-time.Second {
+			t.Errorf("after failure %d locked out for %s, want %s", i+1, ttl, lockout)
+		}
+	}
+
+	if len(audit) != 4 {
+		t.Fatalf("got %d audit records, want 4", len(audit))
+	}
+	if got := audit[len(audit)-1].Details["lockout"]; got != (4 * time.Minute).String() {
+		t.Errorf("last audit record has lockout %s, want %s", got, 4*time.Minute)
+	}
+
+	var lockoutErr *utils.LockoutError
+	if err := s.Check(ctx, "alice", "198.51.100.1"); !errors.As(err, &lockoutErr) {
+		t.Fatalf("Check = %v, want a lockout error", err)
+	}
+	if lockoutErr.RetryAfter > 4*time.Minute {
+		t.Errorf("Check retry after %s, want at most %s", lockoutErr.RetryAfter, 4*time.Minute)
+	}
+}
@@ -0,0 +1,209 @@
+package oidcService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/auth"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"golang.org/x/oauth2"
+)
+
+const stateBytes = 32
+
+// Config holds the client registration and the claim mapping, see
+// config.OIDCConfig.
+type Config struct {
+	Enabled      bool
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	StateTTL     time.Duration
+
+	UsernameClaim string
+	EmailClaim    string
+	GroupsClaim   string
+	RoleMapping   map[string]int
+}
+
+// OIDCService implements the authorization code flow with PKCE against an
+// OpenID Connect provider.
+type OIDCService struct {
+	cfg       Config
+	stateRepo stateRepo
+	users     externalLogin
+
+	// the provider is discovered on first use, so the API starts while the
+	// identity provider is unreachable
+	mu       sync.Mutex
+	provider *oidc.Provider
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+func NewOIDCService(cfg Config, stateRepo stateRepo, users externalLogin) *OIDCService {
+	return &OIDCService{
+		cfg:       cfg,
+		stateRepo: stateRepo,
+		users:     users,
+	}
+}
+
+type stateRepo interface {
+	SaveOIDCState(ctx context.Context, state string, data *entity.OIDCState, ttl time.Duration) error
+	TakeOIDCState(ctx context.Context, state string) (*entity.OIDCState, error)
+}
+
+type externalLogin interface {
+	LoginExternal(ctx context.Context, ext *entity.ExternalIdentity) (*entity.LoginResult, error)
+}
+
+func (s *OIDCService) init(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.provider != nil {
+		return nil
+	}
+
+	provider, err := oidc.NewProvider(ctx, s.cfg.Issuer)
+	if err != nil {
+		return fmt.Errorf("oidc discovery: %w", err)
+	}
+
+	scopes := s.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "profile", "email"}
+	}
+
+	s.provider = provider
+	s.oauth = &oauth2.Config{
+		ClientID:     s.cfg.ClientID,
+		ClientSecret: s.cfg.ClientSecret,
+		RedirectURL:  s.cfg.RedirectURL,
+		Endpoint:     provider.Endpoint(),
+		Scopes:       scopes,
+	}
+	s.verifier = provider.Verifier(&oidc.Config{ClientID: s.cfg.ClientID})
+	return nil
+}
+
+// AuthCodeURL starts a login. It returns the provider URL to redirect the
+// browser to and the state the callback has to present.
+func (s *OIDCService) AuthCodeURL(ctx context.Context) (string, string, error) {
+	if !s.cfg.Enabled {
+		return "", "", utils.ErrSSODisabled
+	}
+	if err := s.init(ctx); err != nil {
+		return "", "", err
+	}
+
+	state, err := auth.NewRandomString(stateBytes)
+	if err != nil {
+		return "", "", err
+	}
+	nonce, err := auth.NewRandomString(stateBytes)
+	if err != nil {
+		return "", "", err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	err = s.stateRepo.SaveOIDCState(ctx, state, &entity.OIDCState{Nonce: nonce, Verifier: verifier}, s.cfg.StateTTL)
+	if err != nil {
+		return "", "", err
+	}
+
+	return s.oauth.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)), state, nil
+}
+
+// Exchange completes a login: it redeems the code, verifies the ID token
+// and signs the user in with local tokens, or a two-factor challenge.
+func (s *OIDCService) Exchange(ctx context.Context, state, code string) (*entity.LoginResult, error) {
+	if !s.cfg.Enabled {
+		return nil, utils.ErrSSODisabled
+	}
+	if err := s.init(ctx); err != nil {
+		return nil, err
+	}
+
+	pending, err := s.stateRepo.TakeOIDCState(ctx, state)
+	if err != nil {
+		if errors.Is(err, utils.ErrNotExist) {
+			return nil, utils.ErrInvalidState
+		}
+		return nil, err
+	}
+
+	token, err := s.oauth.Exchange(ctx, code, oauth2.VerifierOption(pending.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("code exchange: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("token response without id_token")
+	}
+	idToken, err := s.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("id token: %w", err)
+	}
+	if idToken.Nonce != pending.Nonce {
+		return nil, utils.ErrInvalidState
+	}
+
+	var claims map[string]interface{}
+	if err = idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("id token claims: %w", err)
+	}
+
+	return s.users.LoginExternal(ctx, s.mapClaims(idToken.Subject, claims))
+}
+
+func (s *OIDCService) mapClaims(subject string, claims map[string]interface{}) *entity.ExternalIdentity {
+	ext := &entity.ExternalIdentity{
+		Provider: entity.ProviderOIDC,
+		Subject:  subject,
+		Username: stringClaim(claims, s.cfg.UsernameClaim),
+		Email:    stringClaim(claims, s.cfg.EmailClaim),
+	}
+
+	if len(s.cfg.RoleMapping) > 0 {
+		role := entity.RoleUser
+		for _, group := range listClaim(claims, s.cfg.GroupsClaim) {
+			if mapped, ok := s.cfg.RoleMapping[group]; ok && mapped > role {
+				role = mapped
+			}
+		}
+		ext.Role = &role
+	}
+	return ext
+}
+
+func stringClaim(claims map[string]interface{}, name string) string {
+	value, _ := claims[name].(string)
+	return value
+}
+
+// listClaim accepts both a single string and an array of strings, providers
+// differ in how they encode groups.
+func listClaim(claims map[string]interface{}, name string) []string {
+	switch value := claims[name].(type) {
+	case string:
+		return []string{value}
+	case []interface{}:
+		res := make([]string, 0, len(value))
+		for _, v := range value {
+			if s, ok := v.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	}
+	return nil
+}
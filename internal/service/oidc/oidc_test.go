@@ -0,0 +1,474 @@
+package oidcService
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"template/internal/entity"
+	"template/internal/repository/memory"
+	"template/internal/service/user/usertest"
+	"template/internal/utils"
+	"testing"
+	"time"
+)
+
+const (
+	testClientID     = "library"
+	testClientSecret = "library-secret"
+	testRedirectURL  = "https://library.example/api/v1/auth/oidc/callback"
+	testKeyID        = "test-key"
+)
+
+// provider is an OpenID Connect provider serving discovery, its signing
+// keys and the token endpoint. Codes are issued by authorize instead of a
+// login page.
+type provider struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]grant
+}
+
+// grant is an authorization code along with what the token endpoint
+// checks and returns for it.
+type grant struct {
+	challenge string
+	nonce     string
+	claims    map[string]interface{}
+}
+
+func newProvider(t *testing.T) *provider {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &provider{key: key, codes: make(map[string]grant)}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/token", p.token)
+	p.Server = httptest.NewServer(mux)
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *provider) discovery(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.URL,
+		"authorization_endpoint":                p.URL + "/authorize",
+		"token_endpoint":                        p.URL + "/token",
+		"jwks_uri":                              p.URL + "/keys",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+func (p *provider) keys(w http.ResponseWriter, _ *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"alg": "RS256",
+			"use": "sig",
+			"kid": testKeyID,
+			"n":   base64.RawURLEncoding.EncodeToString(p.key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(p.key.E)).Bytes()),
+		}},
+	})
+}
+
+// token redeems a code once, for the client holding the PKCE verifier.
+func (p *provider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_request"})
+		return
+	}
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != testClientID || secret != testClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" ||
+		r.PostForm.Get("redirect_uri") != testRedirectURL ||
+		s256(r.PostForm.Get("code_verifier")) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	claims := map[string]interface{}{
+		"iss":   p.URL,
+		"aud":   testClientID,
+		"iat":   time.Now().Unix(),
+		"exp":   time.Now().Add(time.Minute).Unix(),
+		"nonce": g.nonce,
+	}
+	for name, value := range g.claims {
+		claims[name] = value
+	}
+	idToken, err := p.sign(claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": "provider-access-token",
+		"token_type":   "Bearer",
+		"expires_in":   60,
+		"id_token":     idToken,
+	})
+}
+
+func (p *provider) sign(claims map[string]interface{}) (string, error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "kid": testKeyID, "typ": "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	digest := sha256.Sum256([]byte(signed))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, p.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// authorize plays the browser and the login page: it checks the
+// authorization request and issues a code for a user with the given
+// claims. The nonce of the request is returned in the ID token unless
+// claims override it.
+func (p *provider) authorize(t *testing.T, authURL string, claims map[string]interface{}) (state, code string) {
+	t.Helper()
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatalf("auth URL: %v", err)
+	}
+	if u.Scheme+"://"+u.Host+u.Path != p.URL+"/authorize" {
+		t.Fatalf("auth URL %q does not point at the provider", authURL)
+	}
+
+	q := u.Query()
+	want := map[string]string{
+		"response_type":         "code",
+		"client_id":             testClientID,
+		"redirect_uri":          testRedirectURL,
+		"code_challenge_method": "S256",
+	}
+	for name, value := range want {
+		if q.Get(name) != value {
+			t.Fatalf("auth URL %s = %q, want %q", name, q.Get(name), value)
+		}
+	}
+	for _, name := range []string{"state", "nonce", "code_challenge"} {
+		if q.Get(name) == "" {
+			t.Fatalf("auth URL without %s", name)
+		}
+	}
+
+	code = base64.RawURLEncoding.EncodeToString([]byte(q.Get("state")))
+	p.mu.Lock()
+	p.codes[code] = grant{challenge: q.Get("code_challenge"), nonce: q.Get("nonce"), claims: claims}
+	p.mu.Unlock()
+	return q.Get("state"), code
+}
+
+func s256(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+type fixture struct {
+	provider *provider
+	users    *usertest.Repo
+	service  *OIDCService
+}
+
+func newFixture(t *testing.T) *fixture {
+	t.Helper()
+	p := newProvider(t)
+	users := usertest.NewRepo()
+	userService, err := usertest.NewService(users)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewOIDCService(Config{
+		Enabled:       true,
+		Issuer:        p.URL,
+		ClientID:      testClientID,
+		ClientSecret:  testClientSecret,
+		RedirectURL:   testRedirectURL,
+		StateTTL:      time.Minute,
+		UsernameClaim: "preferred_username",
+		EmailClaim:    "email",
+		GroupsClaim:   "groups",
+		RoleMapping:   map[string]int{"librarians": entity.RoleAdmin},
+	}, memory.NewMemoryRepo(time.Minute, time.Minute, 100), userService)
+
+	return &fixture{provider: p, users: users, service: service}
+}
+
+// login runs the flow from the auth URL to the callback.
+func (f *fixture) login(t *testing.T, claims map[string]interface{}) (*entity.LoginResult, error) {
+	t.Helper()
+	authURL, state, err := f.service.AuthCodeURL(context.Background())
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	urlState, code := f.provider.authorize(t, authURL, claims)
+	if urlState != state {
+		t.Fatalf("auth URL state = %q, want %q", urlState, state)
+	}
+	return f.service.Exchange(context.Background(), state, code)
+}
+
+func aliceClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"sub":                "alice-subject",
+		"preferred_username": "alice",
+		"email":              "Alice@Example.com",
+		"groups":             []string{"readers"},
+	}
+}
+
+func TestAuthCodeURL(t *testing.T) {
+	f := newFixture(t)
+
+	first, firstState, err := f.service.AuthCodeURL(context.Background())
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	second, secondState, err := f.service.AuthCodeURL(context.Background())
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+	if firstState == secondState {
+		t.Fatal("two logins got the same state")
+	}
+
+	firstQuery, secondQuery := parseQuery(t, first), parseQuery(t, second)
+	for _, name := range []string{"nonce", "code_challenge"} {
+		if firstQuery.Get(name) == secondQuery.Get(name) {
+			t.Fatalf("two logins got the same %s", name)
+		}
+	}
+	f.provider.authorize(t, first, nil)
+}
+
+func parseQuery(t *testing.T, rawURL string) url.Values {
+	t.Helper()
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u.Query()
+}
+
+func TestExchangeProvisionsUser(t *testing.T) {
+	f := newFixture(t)
+
+	res, err := f.login(t, aliceClaims())
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if res.Tokens == nil || res.Tokens.AccessToken == "" || res.Challenge != nil {
+		t.Fatalf("Exchange = %+v, want tokens", res)
+	}
+
+	users := f.users.Users()
+	if len(users) != 1 {
+		t.Fatalf("%d users after the first login, want 1", len(users))
+	}
+	user := users[0]
+	if user.Username != "alice" || user.Email != "alice@example.com" || user.Role != entity.RoleUser ||
+		user.ExternalIDs[entity.ProviderOIDC] != "alice-subject" || user.HashedPassword != "" {
+		t.Fatalf("provisioned user = %+v", user)
+	}
+
+	audit := f.users.Audit()
+	if len(audit) != 1 || audit[0].Action != entity.AuditUserProvisioned || audit[0].Target != user.ID.Hex() {
+		t.Fatalf("audit = %+v, want one provisioning record", audit)
+	}
+}
+
+func TestExchangeSyncsUser(t *testing.T) {
+	f := newFixture(t)
+	if _, err := f.login(t, aliceClaims()); err != nil {
+		t.Fatalf("first Exchange: %v", err)
+	}
+
+	claims := aliceClaims()
+	claims["email"] = "alice@library.example"
+	claims["groups"] = []string{"readers", "Librarians", "librarians"}
+	if _, err := f.login(t, claims); err != nil {
+		t.Fatalf("second Exchange: %v", err)
+	}
+
+	users := f.users.Users()
+	if len(users) != 1 {
+		t.Fatalf("%d users after the second login, want 1", len(users))
+	}
+	if users[0].Email != "alice@library.example" || users[0].Role != entity.RoleAdmin {
+		t.Fatalf("synced user = %+v", users[0])
+	}
+	if audit := f.users.Audit(); len(audit) != 1 {
+		t.Fatalf("audit = %+v, want the provisioning record only", audit)
+	}
+}
+
+func TestExchangeTwoFactorPolicy(t *testing.T) {
+	f := newFixture(t)
+	f.users.RequireTwoFactor(entity.RoleUser)
+
+	res, err := f.login(t, aliceClaims())
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if res.Tokens != nil || res.Challenge == nil || !res.Challenge.EnrollmentRequired {
+		t.Fatalf("Exchange = %+v, want an enrollment challenge", res)
+	}
+}
+
+func TestExchangeRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		// run returns what the callback receives
+		run     func(t *testing.T, f *fixture) (state, code string)
+		wantErr error
+	}{
+		{
+			name: "unknown state",
+			run: func(t *testing.T, f *fixture) (string, string) {
+				authURL, _, err := f.service.AuthCodeURL(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, code := f.provider.authorize(t, authURL, aliceClaims())
+				return "forged-state", code
+			},
+			wantErr: utils.ErrInvalidState,
+		},
+		{
+			name: "replayed state",
+			run: func(t *testing.T, f *fixture) (string, string) {
+				authURL, state, err := f.service.AuthCodeURL(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, code := f.provider.authorize(t, authURL, aliceClaims())
+				if _, err = f.service.Exchange(context.Background(), state, code); err != nil {
+					t.Fatalf("first Exchange: %v", err)
+				}
+				return state, code
+			},
+			wantErr: utils.ErrInvalidState,
+		},
+		{
+			name: "nonce mismatch",
+			run: func(t *testing.T, f *fixture) (string, string) {
+				authURL, state, err := f.service.AuthCodeURL(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				claims := aliceClaims()
+				claims["nonce"] = "nonce-of-another-login"
+				_, code := f.provider.authorize(t, authURL, claims)
+				return state, code
+			},
+			wantErr: utils.ErrInvalidState,
+		},
+		{
+			name: "code of another login",
+			run: func(t *testing.T, f *fixture) (string, string) {
+				// the code was issued for a different PKCE challenge, so
+				// the verifier kept with the state does not redeem it
+				authURL, _, err := f.service.AuthCodeURL(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, code := f.provider.authorize(t, authURL, aliceClaims())
+				_, state, err := f.service.AuthCodeURL(context.Background())
+				if err != nil {
+					t.Fatal(err)
+				}
+				return state, code
+			},
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			f := newFixture(t)
+			state, code := tc.run(t, f)
+			before := len(f.users.Users())
+
+			res, err := f.service.Exchange(context.Background(), state, code)
+			if err == nil {
+				t.Fatalf("Exchange = %+v, want an error", res)
+			}
+			if tc.wantErr != nil && !errors.Is(err, tc.wantErr) {
+				t.Fatalf("Exchange error = %v, want %v", err, tc.wantErr)
+			}
+			if after := len(f.users.Users()); after != before {
+				t.Fatalf("%d users after a rejected login, want %d", after, before)
+			}
+		})
+	}
+}
+
+func TestExchangeLocalUsernameTaken(t *testing.T) {
+	f := newFixture(t)
+	f.users.AddUser(&entity.User{Username: "alice", Email: "alice@local.example", HashedPassword: "hash"})
+
+	if _, err := f.login(t, aliceClaims()); !errors.Is(err, utils.ErrUserAlreadyExists) {
+		t.Fatalf("Exchange error = %v, want ErrUserAlreadyExists", err)
+	}
+	if users := f.users.Users(); len(users) != 1 || users[0].ExternalIDs != nil {
+		t.Fatalf("users = %+v, want the local account untouched", users)
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	service := NewOIDCService(Config{}, memory.NewMemoryRepo(time.Minute, time.Minute, 100), nil)
+
+	if _, _, err := service.AuthCodeURL(context.Background()); !errors.Is(err, utils.ErrSSODisabled) {
+		t.Fatalf("AuthCodeURL error = %v, want ErrSSODisabled", err)
+	}
+	if _, err := service.Exchange(context.Background(), "state", "code"); !errors.Is(err, utils.ErrSSODisabled) {
+		t.Fatalf("Exchange error = %v, want ErrSSODisabled", err)
+	}
+}
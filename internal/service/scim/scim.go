@@ -0,0 +1,584 @@
+package scimService
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"regexp"
+	"strconv"
+	"strings"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/validator"
+	"time"
+)
+
+const (
+	countDefault = 100
+	countMax     = 200
+
+	// auditActor marks changes made by the provisioning client in the
+	// audit log.
+	auditActor = "scim"
+)
+
+// groupNames are the display names of the groups standing for roles.
+var groupNames = map[int]string{
+	entity.RoleUser:  "Users",
+	entity.RoleAdmin: "Admins",
+}
+
+var filterPattern = regexp.MustCompile(`(?i)^\s*([a-z.]+)\s+eq\s+"((?:[^"\\]|\\.)*)"\s*$`)
+
+type Config struct {
+	Enabled bool
+	Token   string
+}
+
+// ScimService implements SCIM 2.0 provisioning (RFC 7644) of users. Roles
+// are exposed as groups, so moving a user between groups changes the role.
+type ScimService struct {
+	enabled   bool
+	tokenHash [sha256.Size]byte
+	repo      scimRepo
+	users     userCache
+}
+
+func NewScimService(cfg Config, repo scimRepo, users userCache) *ScimService {
+	return &ScimService{
+		enabled:   cfg.Enabled,
+		tokenHash: sha256.Sum256([]byte(cfg.Token)),
+		repo:      repo,
+		users:     users,
+	}
+}
+
+type scimRepo interface {
+	CreateUser(ctx context.Context, user *entity.User) (interface{}, error)
+	GetUserByID(ctx context.Context, id string) (*entity.User, error)
+	GetUserByEmail(ctx context.Context, email string) (*entity.User, error)
+	FindUsers(ctx context.Context, filter *entity.UserFilter, skip, limit int) ([]*entity.User, int, error)
+	UpdateProvisionedUser(ctx context.Context, userID primitive.ObjectID, update *entity.ProvisionedUpdate) (*entity.User, error)
+	SetUserRole(ctx context.Context, userID primitive.ObjectID, role int) error
+	InsertAuditRecord(ctx context.Context, record *entity.AuditRecord) error
+}
+
+// userCache is the user cache of userService, which has to forget users
+// changed here.
+type userCache interface {
+	ForgetUser(id string)
+}
+
+// Authenticate checks the bearer token of the provisioning client.
+func (s *ScimService) Authenticate(token string) error {
+	if !s.enabled {
+		return utils.ErrSCIMDisabled
+	}
+	sum := sha256.Sum256([]byte(token))
+	if token == "" || subtle.ConstantTimeCompare(sum[:], s.tokenHash[:]) != 1 {
+		return utils.ErrInvalidCredentials
+	}
+	return nil
+}
+
+// ListUsers supports the userName and externalId eq filters.
+func (s *ScimService) ListUsers(ctx context.Context, filter, startIndexStr, countStr string) (*entity.ScimListResponse, error) {
+	userFilter := &entity.UserFilter{}
+	if filter != "" {
+		attr, value, err := parseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		switch strings.ToLower(attr) {
+		case "username":
+			userFilter.Username = value
+		case "externalid":
+			userFilter.Provider, userFilter.Subject = entity.ProviderSCIM, value
+		default:
+			return nil, fmt.Errorf("cannot filter users by %s: %w", attr, utils.ErrInvalidFilter)
+		}
+	}
+
+	startIndex, count, err := parsePaging(startIndexStr, countStr)
+	if err != nil {
+		return nil, err
+	}
+
+	users, total, err := s.repo.FindUsers(ctx, userFilter, startIndex-1, count)
+	if err != nil {
+		return nil, err
+	}
+
+	resources := make([]*entity.ScimUser, 0, len(users))
+	for _, user := range users {
+		resources = append(resources, toScimUser(user))
+	}
+	return listResponse(resources, total, startIndex, len(resources)), nil
+}
+
+func (s *ScimService) GetUser(ctx context.Context, id string) (*entity.ScimUser, error) {
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return toScimUser(user), nil
+}
+
+// CreateUser provisions a user without a password. Users log in with
+// single sign-on or set a password with the forgot password flow.
+func (s *ScimService) CreateUser(ctx context.Context, form *v1.ScimUserForm) (*entity.ScimUser, error) {
+	if !validator.NotBlank(form.UserName) {
+		return nil, fmt.Errorf("userName is required: %w", utils.ErrBadInput)
+	}
+	email := primaryEmail(form.Emails)
+	if email != "" && !validator.ValidEmail(email) {
+		return nil, fmt.Errorf("email %q is not valid: %w", email, utils.ErrBadInput)
+	}
+
+	user := &entity.User{
+		Username:      form.UserName,
+		DisplayName:   form.DisplayName,
+		Email:         email,
+		EmailVerified: email != "",
+		Role:          entity.RoleUser,
+		Disabled:      form.Active != nil && !*form.Active,
+		CreatedAt:     time.Now(),
+	}
+	if user.DisplayName == "" && form.Name != nil {
+		user.DisplayName = form.Name.Display()
+	}
+	if form.ExternalID != "" {
+		user.ExternalIDs = map[string]string{entity.ProviderSCIM: form.ExternalID}
+	}
+
+	if email != "" {
+		_, err := s.repo.GetUserByEmail(ctx, email)
+		switch {
+		case err == nil:
+			return nil, utils.ErrEmailAlreadyExists
+		case !errors.Is(err, utils.ErrUserNotFound):
+			return nil, err
+		}
+	}
+
+	id, err := s.repo.CreateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if oid, ok := id.(primitive.ObjectID); ok {
+		user.ID = oid
+	}
+
+	err = s.repo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditUserProvisioned,
+		ActorID: auditActor,
+		Target:  user.ID.Hex(),
+		Details: map[string]string{
+			"provider": entity.ProviderSCIM,
+			"subject":  form.ExternalID,
+			"username": user.Username,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toScimUser(user), nil
+}
+
+// PatchUser applies add, replace and remove operations. Attributes that
+// are not stored, such as name parts or phone numbers, are ignored, so
+// clients sending their full attribute mapping keep working. Setting
+// active to false deactivates the account.
+func (s *ScimService) PatchUser(ctx context.Context, id string, form *v1.ScimPatchForm) (*entity.ScimUser, error) {
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	update := &entity.ProvisionedUpdate{}
+	for _, op := range form.Operations {
+		switch strings.ToLower(op.Op) {
+		case "add", "replace":
+			if op.Path != "" {
+				err = setUserAttribute(update, op.Path, op.Value)
+				break
+			}
+			var attributes map[string]json.RawMessage
+			if err = json.Unmarshal(op.Value, &attributes); err != nil {
+				return nil, fmt.Errorf("value must be an object without a path: %w", utils.ErrBadInput)
+			}
+			for name, value := range attributes {
+				if err = setUserAttribute(update, name, value); err != nil {
+					break
+				}
+			}
+		case "remove":
+			if strings.EqualFold(op.Path, "displayName") {
+				empty := ""
+				update.DisplayName = &empty
+			}
+		default:
+			return nil, fmt.Errorf("unknown operation %q: %w", op.Op, utils.ErrBadInput)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	updated, err := s.repo.UpdateProvisionedUser(ctx, user.ID, update)
+	if err != nil {
+		return nil, err
+	}
+	s.users.ForgetUser(id)
+
+	if updated.Disabled != user.Disabled {
+		action := entity.AuditUserEnable
+		if updated.Disabled {
+			action = entity.AuditUserDisable
+		}
+		err = s.repo.InsertAuditRecord(ctx, &entity.AuditRecord{
+			Action:  action,
+			ActorID: auditActor,
+			Target:  id,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return toScimUser(updated), nil
+}
+
+func setUserAttribute(update *entity.ProvisionedUpdate, path string, raw json.RawMessage) error {
+	path = strings.ToLower(path)
+	switch {
+	case path == "username":
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil || !validator.NotBlank(value) {
+			return fmt.Errorf("userName must be a non-empty string: %w", utils.ErrBadInput)
+		}
+		update.Username = &value
+	case path == "displayname":
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("displayName must be a string: %w", utils.ErrBadInput)
+		}
+		update.DisplayName = &value
+	case path == "externalid":
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return fmt.Errorf("externalId must be a string: %w", utils.ErrBadInput)
+		}
+		update.ExternalID = &value
+	case path == "active":
+		active, err := parseBool(raw)
+		if err != nil {
+			return err
+		}
+		disabled := !active
+		update.Disabled = &disabled
+	case strings.HasPrefix(path, "emails"):
+		// either the whole list or a single value such as
+		// emails[type eq "work"].value
+		var email string
+		if err := json.Unmarshal(raw, &email); err != nil {
+			var emails []entity.ScimEmail
+			if err = json.Unmarshal(raw, &emails); err != nil {
+				return fmt.Errorf("emails must be a list or a string: %w", utils.ErrBadInput)
+			}
+			email = primaryEmail(emails)
+		}
+		email = validator.NormalizeEmail(email)
+		if !validator.ValidEmail(email) {
+			return fmt.Errorf("email %q is not valid: %w", email, utils.ErrBadInput)
+		}
+		update.Email = &email
+	}
+	return nil
+}
+
+// parseBool accepts the strings some clients send for booleans.
+func parseBool(raw json.RawMessage) (bool, error) {
+	var value bool
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value, nil
+	}
+	var str string
+	if err := json.Unmarshal(raw, &str); err == nil {
+		if value, err = strconv.ParseBool(str); err == nil {
+			return value, nil
+		}
+	}
+	return false, fmt.Errorf("active must be a boolean: %w", utils.ErrBadInput)
+}
+
+// ListGroups lists the role groups, with the displayName eq filter. Members
+// are left out unless requested, and then capped to the first page, see
+// GetGroup.
+func (s *ScimService) ListGroups(ctx context.Context, filter, attributes string) (*entity.ScimListResponse, error) {
+	var name string
+	if filter != "" {
+		attr, value, err := parseFilter(filter)
+		if err != nil {
+			return nil, err
+		}
+		if !strings.EqualFold(attr, "displayName") {
+			return nil, fmt.Errorf("cannot filter groups by %s: %w", attr, utils.ErrInvalidFilter)
+		}
+		name = value
+	}
+
+	groups := make([]*entity.ScimGroup, 0, len(entity.Roles))
+	for _, role := range entity.Roles {
+		if name != "" && !strings.EqualFold(name, groupNames[role]) {
+			continue
+		}
+		group, err := s.group(ctx, role, wantsMembers(attributes), 1, countMax)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+	return listResponse(groups, len(groups), 1, len(groups)), nil
+}
+
+// GetGroup returns a role group. A role can have the whole student body as
+// members, so they are only listed when the client asks for them with
+// attributes=members, a page at a time with startIndex and count.
+func (s *ScimService) GetGroup(ctx context.Context, id, attributes, startIndexStr, countStr string) (*entity.ScimGroup, error) {
+	role, err := groupRole(id)
+	if err != nil {
+		return nil, err
+	}
+	startIndex, count, err := parsePaging(startIndexStr, countStr)
+	if err != nil {
+		return nil, err
+	}
+	return s.group(ctx, role, wantsMembers(attributes), startIndex, count)
+}
+
+func wantsMembers(attributes string) bool {
+	for _, attr := range strings.Split(attributes, ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			return true
+		}
+	}
+	return false
+}
+
+// PatchGroup adds and removes members. Every user is in exactly one group,
+// so adding a user moves them, and removing one from a group other than
+// Users moves them back to Users. Replacing all members is not supported.
+func (s *ScimService) PatchGroup(ctx context.Context, id string, form *v1.ScimPatchForm) error {
+	role, err := groupRole(id)
+	if err != nil {
+		return err
+	}
+
+	for _, op := range form.Operations {
+		var members []string
+		switch strings.ToLower(op.Op) {
+		case "add":
+			if members, err = memberIDs(op.Path, op.Value); err != nil {
+				return err
+			}
+			for _, member := range members {
+				if err = s.setRole(ctx, member, role, nil); err != nil {
+					return err
+				}
+			}
+		case "remove":
+			if members, err = memberIDs(op.Path, op.Value); err != nil {
+				return err
+			}
+			if role == entity.RoleUser {
+				continue
+			}
+			for _, member := range members {
+				if err = s.setRole(ctx, member, entity.RoleUser, &role); err != nil {
+					return err
+				}
+			}
+		default:
+			return fmt.Errorf("operation %q is not supported on groups: %w", op.Op, utils.ErrBadInput)
+		}
+	}
+	return nil
+}
+
+// setRole changes the role of a member, if it is still from when given.
+func (s *ScimService) setRole(ctx context.Context, id string, role int, from *int) error {
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+	if user.Role == role || (from != nil && user.Role != *from) {
+		return nil
+	}
+
+	if err = s.repo.SetUserRole(ctx, user.ID, role); err != nil {
+		return err
+	}
+	s.users.ForgetUser(id)
+
+	return s.repo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditUserRole,
+		ActorID: auditActor,
+		Target:  id,
+		Details: map[string]string{
+			"from": strconv.Itoa(user.Role),
+			"to":   strconv.Itoa(role),
+		},
+	})
+}
+
+var memberPathPattern = regexp.MustCompile(`(?i)^members\[value\s+eq\s+"([^"]*)"\]$`)
+
+// memberIDs reads the members of an operation, given either in the value
+// or in a path like members[value eq "id"].
+func memberIDs(path string, raw json.RawMessage) ([]string, error) {
+	if match := memberPathPattern.FindStringSubmatch(path); match != nil {
+		return []string{match[1]}, nil
+	}
+
+	var members []entity.ScimMember
+	switch {
+	case strings.EqualFold(path, "members"):
+		if err := json.Unmarshal(raw, &members); err != nil {
+			return nil, fmt.Errorf("members must be a list: %w", utils.ErrBadInput)
+		}
+	case path == "":
+		var value struct {
+			Members []entity.ScimMember `json:"members"`
+		}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return nil, fmt.Errorf("value must be an object without a path: %w", utils.ErrBadInput)
+		}
+		members = value.Members
+	default:
+		return nil, fmt.Errorf("unsupported path %q: %w", path, utils.ErrBadInput)
+	}
+
+	ids := make([]string, 0, len(members))
+	for _, member := range members {
+		ids = append(ids, member.Value)
+	}
+	return ids, nil
+}
+
+func (s *ScimService) group(ctx context.Context, role int, withMembers bool, startIndex, count int) (*entity.ScimGroup, error) {
+	group := &entity.ScimGroup{
+		Schemas:     []string{entity.ScimSchemaGroup},
+		ID:          strconv.Itoa(role),
+		DisplayName: groupNames[role],
+		Meta:        entity.ScimMeta{ResourceType: "Group"},
+	}
+	if !withMembers {
+		return group, nil
+	}
+
+	users, _, err := s.repo.FindUsers(ctx, &entity.UserFilter{Role: &role}, startIndex-1, count)
+	if err != nil {
+		return nil, err
+	}
+	group.Members = make([]entity.ScimMember, 0, len(users))
+	for _, user := range users {
+		group.Members = append(group.Members, entity.ScimMember{Value: user.ID.Hex(), Display: user.Username})
+	}
+	return group, nil
+}
+
+func (s *ScimService) getUser(ctx context.Context, id string) (*entity.User, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, utils.ErrUserNotFound
+	}
+	user, err := s.repo.GetUserByID(ctx, id)
+	if errors.Is(err, utils.ErrNotExist) {
+		return nil, utils.ErrUserNotFound
+	}
+	return user, err
+}
+
+func groupRole(id string) (int, error) {
+	role, err := strconv.Atoi(id)
+	if _, ok := groupNames[role]; err != nil || !ok {
+		return 0, utils.ErrNotExist
+	}
+	return role, nil
+}
+
+func toScimUser(user *entity.User) *entity.ScimUser {
+	created := user.CreatedAt
+	res := &entity.ScimUser{
+		Schemas:     []string{entity.ScimSchemaUser},
+		ID:          user.ID.Hex(),
+		ExternalID:  user.ExternalIDs[entity.ProviderSCIM],
+		UserName:    user.Username,
+		DisplayName: user.DisplayName,
+		Active:      !user.Disabled,
+		Groups:      []entity.ScimMember{{Value: strconv.Itoa(user.Role), Display: groupNames[user.Role]}},
+		Meta:        entity.ScimMeta{ResourceType: "User", Created: &created},
+	}
+	if user.Email != "" {
+		res.Emails = []entity.ScimEmail{{Value: user.Email, Type: "work", Primary: true}}
+	}
+	return res
+}
+
+func listResponse(resources interface{}, total, startIndex, itemsPerPage int) *entity.ScimListResponse {
+	return &entity.ScimListResponse{
+		Schemas:      []string{entity.ScimSchemaListResponse},
+		TotalResults: total,
+		StartIndex:   startIndex,
+		ItemsPerPage: itemsPerPage,
+		Resources:    resources,
+	}
+}
+
+// primaryEmail picks the primary address, or the first one.
+func primaryEmail(emails []entity.ScimEmail) string {
+	for _, email := range emails {
+		if email.Primary {
+			return validator.NormalizeEmail(email.Value)
+		}
+	}
+	if len(emails) > 0 {
+		return validator.NormalizeEmail(emails[0].Value)
+	}
+	return ""
+}
+
+// parseFilter parses the only filter form supported, attr eq "value".
+func parseFilter(filter string) (string, string, error) {
+	match := filterPattern.FindStringSubmatch(filter)
+	if match == nil {
+		return "", "", fmt.Errorf("only 'attribute eq \"value\"' is supported: %w", utils.ErrInvalidFilter)
+	}
+	value, err := strconv.Unquote(`"` + match[2] + `"`)
+	if err != nil {
+		return "", "", fmt.Errorf("%v: %w", err, utils.ErrInvalidFilter)
+	}
+	return match[1], value, nil
+}
+
+// parsePaging reads the 1-based startIndex and count, values below 1 are
+// raised to 1 as RFC 7644 suggests.
+func parsePaging(startIndexStr, countStr string) (int, int, error) {
+	startIndex, count := 1, countDefault
+	var err error
+	if startIndexStr != "" {
+		if startIndex, err = strconv.Atoi(startIndexStr); err != nil {
+			return 0, 0, fmt.Errorf("startIndex must be a number: %w", utils.ErrBadInput)
+		}
+	}
+	if countStr != "" {
+		if count, err = strconv.Atoi(countStr); err != nil {
+			return 0, 0, fmt.Errorf("count must be a number: %w", utils.ErrBadInput)
+		}
+	}
+	return max(startIndex, 1), min(max(count, 1), countMax), nil
+}
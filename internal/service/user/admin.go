@@ -0,0 +1,238 @@
+package userService
+
+import (
+	"context"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"strconv"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/utils"
+	"time"
+)
+
+const (
+	limitDefault = 20
+	limitMax     = 100
+	pageDefault  = 1
+)
+
+// ListUsers searches the users for the admin API. Empty parameters do not
+// filter. Searches are audited like changes, since they expose emails.
+func (s *UserService) ListUsers(ctx context.Context, query, roleStr, disabledStr, pageStr, limitStr, actorID string) (*entity.PaginatedUsers, error) {
+	filter := &entity.UserFilter{Query: query}
+	if roleStr != "" {
+		role, err := strconv.Atoi(roleStr)
+		if err != nil || !knownRole(role) {
+			return nil, fmt.Errorf("unknown role %q: %w", roleStr, utils.ErrBadInput)
+		}
+		filter.Role = &role
+	}
+	if disabledStr != "" {
+		disabled, err := strconv.ParseBool(disabledStr)
+		if err != nil {
+			return nil, fmt.Errorf("disabled must be true or false: %w", utils.ErrBadInput)
+		}
+		filter.Disabled = &disabled
+	}
+
+	page, err := parsePositive(pageStr, pageDefault)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := parsePositive(limitStr, limitDefault)
+	if err != nil {
+		return nil, err
+	}
+	if limit > limitMax {
+		limit = limitMax
+	}
+
+	users, err := s.userRepo.ListUsers(ctx, filter, page, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	details := map[string]string{"page": strconv.Itoa(page), "limit": strconv.Itoa(limit)}
+	for name, value := range map[string]string{"q": query, "role": roleStr, "disabled": disabledStr} {
+		if value != "" {
+			details[name] = value
+		}
+	}
+	err = s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditUserList,
+		ActorID: actorID,
+		Details: details,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func parsePositive(value string, def int) (int, error) {
+	if value == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		return 0, utils.ErrBadInput
+	}
+	return n, nil
+}
+
+// GetUser returns a user record for the admin API, the view is audited.
+func (s *UserService) GetUser(ctx context.Context, id, actorID string) (*entity.User, error) {
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditUserView,
+		ActorID: actorID,
+		Target:  id,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (s *UserService) getUser(ctx context.Context, id string) (*entity.User, error) {
+	if _, err := primitive.ObjectIDFromHex(id); err != nil {
+		return nil, utils.ErrUserNotFound
+	}
+	return s.userRepo.GetUserByID(ctx, id)
+}
+
+// SetUserRole changes the role of a user. Admins cannot change their own
+// role, so the last admin cannot demote themselves by accident.
+func (s *UserService) SetUserRole(ctx context.Context, id string, form *v1.UserRoleForm, actorID string) (*entity.User, error) {
+	if form.Role == nil || !knownRole(*form.Role) {
+		return nil, fmt.Errorf("unknown role: %w", utils.ErrBadInput)
+	}
+	if id == actorID {
+		return nil, fmt.Errorf("cannot change own role: %w", utils.ErrForbidden)
+	}
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == *form.Role {
+		return user, nil
+	}
+
+	if err = s.userRepo.SetUserRole(ctx, user.ID, *form.Role); err != nil {
+		return nil, err
+	}
+	s.users.Delete(id)
+
+	err = s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditUserRole,
+		ActorID: actorID,
+		Target:  id,
+		Details: map[string]string{
+			"from": strconv.Itoa(user.Role),
+			"to":   strconv.Itoa(*form.Role),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	user.Role = *form.Role
+	return user, nil
+}
+
+// SetUserDisabled disables or enables an account. A disabled user cannot
+// log in and their access tokens are rejected.
+func (s *UserService) SetUserDisabled(ctx context.Context, id string, disabled bool, actorID string) error {
+	if id == actorID {
+		return fmt.Errorf("cannot disable own account: %w", utils.ErrForbidden)
+	}
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err = s.userRepo.SetUserDisabled(ctx, user.ID, disabled); err != nil {
+		return err
+	}
+	s.users.Delete(id)
+
+	action := entity.AuditUserEnable
+	if disabled {
+		action = entity.AuditUserDisable
+	}
+	return s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  action,
+		ActorID: actorID,
+		Target:  id,
+	})
+}
+
+// ForcePasswordReset clears the password and the session of a user and
+// sends them a reset link.
+func (s *UserService) ForcePasswordReset(ctx context.Context, id string, actorID string) error {
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return err
+	}
+
+	if err = s.userRepo.ClearPassword(ctx, user.ID); err != nil {
+		return err
+	}
+	s.users.Delete(id)
+
+	err = s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditPasswordForceReset,
+		ActorID: actorID,
+		Target:  id,
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.sendResetLink(ctx, user)
+}
+
+// ImpersonateUser issues a short-lived access token for acting as the user.
+// Admins cannot be impersonated, so the token never grants more than the
+// user's own rights.
+func (s *UserService) ImpersonateUser(ctx context.Context, id string, actorID string) (*entity.ImpersonationToken, error) {
+	if id == actorID {
+		return nil, fmt.Errorf("cannot impersonate yourself: %w", utils.ErrBadInput)
+	}
+
+	user, err := s.getUser(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if user.Role == entity.RoleAdmin {
+		return nil, fmt.Errorf("cannot impersonate an admin: %w", utils.ErrForbidden)
+	}
+	if user.Disabled {
+		return nil, utils.ErrAccountDisabled
+	}
+
+	token, err := s.tokenManager.NewImpersonationJWT(id, user.Role, actorID, s.cfg.ImpersonationTTL)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(s.cfg.ImpersonationTTL)
+
+	err = s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditUserImpersonate,
+		ActorID: actorID,
+		Target:  id,
+		Details: map[string]string{"expiresAt": expiresAt.Format(time.RFC3339)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.ImpersonationToken{AccessToken: token, UserID: id, ExpiresAt: expiresAt}, nil
+}
@@ -0,0 +1,79 @@
+package userService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/auth"
+	"template/pkg/hash"
+	"template/pkg/notify"
+	"template/pkg/validator"
+	"time"
+)
+
+const verifyTokenBytes = 32
+
+// VerifyEmail consumes a verification token.
+func (s *UserService) VerifyEmail(ctx context.Context, form *v1.EmailVerifyForm) error {
+	if !validator.NotBlank(form.Token) {
+		return utils.ErrInvalidVerifyToken
+	}
+
+	user, err := s.userRepo.VerifyEmail(ctx, hash.Token(form.Token))
+	if err != nil {
+		return err
+	}
+	s.users.Delete(user.ID.Hex())
+	return nil
+}
+
+// ResendVerification sends a new verification link, at most once per
+// resend cooldown.
+func (s *UserService) ResendVerification(ctx context.Context, userID string) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if user.EmailVerified {
+		return utils.ErrEmailVerified
+	}
+	if user.Email == "" {
+		return fmt.Errorf("no email address: %w", utils.ErrBadInput)
+	}
+
+	return s.sendVerification(ctx, user)
+}
+
+func (s *UserService) sendVerification(ctx context.Context, user *entity.User) error {
+	token, err := auth.NewRandomString(verifyTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.userRepo.SetEmailVerification(ctx, user.ID, &entity.EmailVerification{
+		TokenHash: hash.Token(token),
+		SentAt:    now,
+		ExpiresAt: now.Add(s.cfg.VerifyTokenTTL),
+	}, now.Add(-s.cfg.VerifyCooldown))
+	if err != nil {
+		if errors.Is(err, utils.ErrTooManyAttempts) {
+			retryAfter := s.cfg.VerifyCooldown
+			if user.EmailVerification != nil {
+				retryAfter = user.EmailVerification.SentAt.Add(s.cfg.VerifyCooldown).Sub(now)
+			}
+			return &utils.LockoutError{RetryAfter: retryAfter}
+		}
+		return err
+	}
+
+	return s.notifier.Notify(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Hello %s,\n\nuse the link below to confirm your email address. It is valid for %s.\n\n%s\n",
+			user.Username, s.cfg.VerifyTokenTTL, fmt.Sprintf(s.cfg.VerifyURL, token)),
+	})
+}
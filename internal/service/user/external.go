@@ -0,0 +1,120 @@
+package userService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/validator"
+	"time"
+)
+
+// LoginExternal signs in a user authenticated by an identity provider.
+// Unknown users are created just in time. A local account with the same
+// username is never linked automatically, since that would let the
+// provider take it over. Like any login it ends in a two-factor challenge
+// when the user or their role requires one.
+func (s *UserService) LoginExternal(ctx context.Context, ext *entity.ExternalIdentity) (*entity.LoginResult, error) {
+	user, err := s.externalUser(ctx, ext)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.startSession(ctx, user)
+}
+
+// loginAuthenticators tries the authenticators in order once the local
+// password check failed. Only a rejection by all of them counts as a
+// failed attempt. A directory user whose username is taken by a local
+// account is rejected too, and answered like a wrong password so the
+// clash does not reveal the account.
+func (s *UserService) loginAuthenticators(ctx context.Context, form *v1.UserLoginForm) (*entity.LoginResult, error) {
+	for _, a := range s.authenticators {
+		ext, err := a.Authenticate(ctx, form.Username, form.Password)
+		if errors.Is(err, utils.ErrInvalidCredentials) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		user, err := s.externalUser(ctx, ext)
+		if errors.Is(err, utils.ErrUserAlreadyExists) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err = s.loginGuard.RegisterSuccess(ctx, form.Username); err != nil {
+			return nil, err
+		}
+		return s.startSession(ctx, user)
+	}
+
+	return nil, s.loginFailed(ctx, form, utils.ErrUserNotFound)
+}
+
+// externalUser finds the user linked to ext and syncs the attributes the
+// provider owns, or creates the user on the first login.
+func (s *UserService) externalUser(ctx context.Context, ext *entity.ExternalIdentity) (*entity.User, error) {
+	if !validator.NotBlank(ext.Subject) || !validator.NotBlank(ext.Username) {
+		return nil, fmt.Errorf("identity without subject or username: %w", utils.ErrBadInput)
+	}
+	ext.Email = validator.NormalizeEmail(ext.Email)
+
+	user, err := s.userRepo.GetUserByExternalID(ctx, ext.Provider, ext.Subject)
+	switch {
+	case err == nil:
+		if user.Disabled {
+			return nil, utils.ErrAccountDisabled
+		}
+		if err = s.userRepo.SyncExternalUser(ctx, user.ID, ext); err != nil {
+			return nil, err
+		}
+		s.users.Delete(user.ID.Hex())
+		return s.userRepo.GetUserByID(ctx, user.ID.Hex())
+	case errors.Is(err, utils.ErrUserNotFound):
+		return s.provisionExternal(ctx, ext)
+	default:
+		return nil, err
+	}
+}
+
+func (s *UserService) provisionExternal(ctx context.Context, ext *entity.ExternalIdentity) (*entity.User, error) {
+	user := &entity.User{
+		Username:    ext.Username,
+		Email:       ext.Email,
+		DisplayName: ext.DisplayName,
+		Role:        entity.RoleUser,
+		CreatedAt:   time.Now(),
+		ExternalIDs: map[string]string{ext.Provider: ext.Subject},
+	}
+	if ext.Role != nil {
+		user.Role = *ext.Role
+	}
+
+	id, err := s.userRepo.CreateUser(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	if oid, ok := id.(primitive.ObjectID); ok {
+		user.ID = oid
+	}
+
+	err = s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action: entity.AuditUserProvisioned,
+		Target: user.ID.Hex(),
+		Details: map[string]string{
+			"provider": ext.Provider,
+			"subject":  ext.Subject,
+			"username": ext.Username,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
@@ -0,0 +1,160 @@
+package userService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/auth"
+	"template/pkg/hash"
+	"template/pkg/notify"
+	"template/pkg/validator"
+	"time"
+)
+
+const resetTokenBytes = 32
+
+// ChangePassword sets a new password for the user and starts a new session.
+// The stored session is replaced, so refresh tokens issued to any other
+// client stop working.
+func (s *UserService) ChangePassword(ctx context.Context, userID string, form *v1.PasswordChangeForm) (entity.Tokens, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	form.CheckField(validator.NotBlank(form.OldPassword), &form.PasswordErrors.OldPassword, "This field cannot be blank")
+	form.CheckField(form.NewPassword != form.OldPassword, &form.PasswordErrors.NewPassword, "New password must differ from the old one")
+	if err = form.CheckPassword(s.passwordPolicy, form.NewPassword, user.Username, &form.PasswordErrors.NewPassword); err != nil {
+		return entity.Tokens{}, err
+	}
+	if !form.ValidPasswordForm() {
+		return entity.Tokens{}, utils.InvalidForm
+	}
+
+	oldHash, err := s.hasher.Hash(form.OldPassword)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+	if oldHash != user.HashedPassword {
+		form.PasswordErrors.OldPassword = "Password is incorrect"
+		return entity.Tokens{}, utils.InvalidForm
+	}
+
+	if err = s.setPassword(ctx, user, form.NewPassword, entity.AuditPasswordChange); err != nil {
+		return entity.Tokens{}, err
+	}
+
+	return s.createSession(ctx, user)
+}
+
+// ForgotPassword sends a reset link to the user. Requests are limited per
+// username and client IP, so the endpoint cannot flood a mailbox. Unknown
+// usernames are not reported, and callers must not tell other errors apart
+// either: only existing accounts get to the notifier.
+func (s *UserService) ForgotPassword(ctx context.Context, form *v1.PasswordForgotForm) error {
+	if err := s.resetLimiter.Allow(ctx, form.Username, form.IP); err != nil {
+		return err
+	}
+
+	user, err := s.userRepo.GetUserByUsername(ctx, form.Username)
+	if err != nil {
+		if errors.Is(err, utils.ErrUserNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	return s.sendResetLink(ctx, user)
+}
+
+func (s *UserService) sendResetLink(ctx context.Context, user *entity.User) error {
+	token, err := auth.NewRandomString(resetTokenBytes)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = s.userRepo.CreatePasswordReset(ctx, &entity.PasswordReset{
+		TokenHash: hash.Token(token),
+		UserID:    user.ID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(s.cfg.ResetTokenTTL),
+	})
+	if err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(ctx, notify.Message{
+		To:      user.Email,
+		Subject: "Password reset",
+		Body: fmt.Sprintf("Hello %s,\n\nuse the link below to choose a new password. It is valid for %s.\n\n%s\n\nIf you did not ask for a reset, ignore this message.\n",
+			user.Username, s.cfg.ResetTokenTTL, fmt.Sprintf(s.cfg.ResetURL, token)),
+	})
+}
+
+// ResetPassword consumes a reset token and sets the new password. All
+// sessions, personal access tokens and outstanding reset tokens of the
+// user are revoked.
+func (s *UserService) ResetPassword(ctx context.Context, form *v1.PasswordResetForm) error {
+	form.CheckField(validator.NotBlank(form.Token), &form.PasswordErrors.Token, "This field cannot be blank")
+	if !form.ValidPasswordForm() {
+		return utils.InvalidForm
+	}
+
+	// the token is only consumed once the password passes the policy, which
+	// needs the username
+	reset, err := s.userRepo.GetPasswordReset(ctx, hash.Token(form.Token))
+	if err != nil {
+		return err
+	}
+	user, err := s.userRepo.GetUserByID(ctx, reset.UserID.Hex())
+	if err != nil {
+		return err
+	}
+
+	if err = form.CheckPassword(s.passwordPolicy, form.NewPassword, user.Username, &form.PasswordErrors.NewPassword); err != nil {
+		return err
+	}
+	if !form.ValidPasswordForm() {
+		return utils.InvalidForm
+	}
+
+	if _, err = s.userRepo.ConsumePasswordReset(ctx, reset.TokenHash); err != nil {
+		return err
+	}
+
+	if err = s.setPassword(ctx, user, form.NewPassword, entity.AuditPasswordReset); err != nil {
+		return err
+	}
+	if err = s.userRepo.RevokeSessions(ctx, user.ID); err != nil {
+		return err
+	}
+	if err = s.userRepo.DeleteUserAPIKeys(ctx, user.ID.Hex()); err != nil {
+		return err
+	}
+
+	return s.userRepo.DeletePasswordResets(ctx, user.ID)
+}
+
+func (s *UserService) setPassword(ctx context.Context, user *entity.User, password, action string) error {
+	passwordHash, err := s.hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+
+	if err = s.userRepo.UpdatePassword(ctx, user.ID, passwordHash); err != nil {
+		return err
+	}
+	// access tokens issued before the change are rejected once the cached
+	// user is gone
+	s.users.Delete(user.ID.Hex())
+
+	return s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  action,
+		ActorID: user.ID.Hex(),
+		Target:  user.ID.Hex(),
+	})
+}
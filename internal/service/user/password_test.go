@@ -0,0 +1,94 @@
+package userService_test
+
+import (
+	"context"
+	"errors"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/service/user/usertest"
+	"template/internal/utils"
+	"testing"
+	"time"
+)
+
+func TestResetPasswordSingleUse(t *testing.T) {
+	ctx := context.Background()
+	repo := usertest.NewRepo()
+	user := repo.AddUser(&entity.User{
+		Username:       "alice",
+		Email:          "alice@library.example",
+		HashedPassword: usertest.HashPassword("old password"),
+	})
+	repo.AddPasswordReset(user.ID, "reset-token", time.Hour)
+	repo.AddPasswordReset(user.ID, "other-token", time.Hour)
+	service, err := usertest.NewService(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a password rejected by the policy leaves the token usable
+	err = service.ResetPassword(ctx, &v1.PasswordResetForm{Token: "reset-token", NewPassword: "short"})
+	if !errors.Is(err, utils.InvalidForm) {
+		t.Fatalf("ResetPassword with a short password = %v, want %v", err, utils.InvalidForm)
+	}
+
+	if err = service.ResetPassword(ctx, &v1.PasswordResetForm{Token: "reset-token", NewPassword: "new password"}); err != nil {
+		t.Fatalf("ResetPassword: %v", err)
+	}
+
+	for _, token := range []string{"reset-token", "other-token"} {
+		err = service.ResetPassword(ctx, &v1.PasswordResetForm{Token: token, NewPassword: "another password"})
+		if !errors.Is(err, utils.ErrInvalidResetToken) {
+			t.Errorf("second ResetPassword with %s = %v, want %v", token, err, utils.ErrInvalidResetToken)
+		}
+	}
+
+	stored, err := repo.GetUserByID(ctx, user.ID.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.HashedPassword != usertest.HashPassword("new password") {
+		t.Error("password is not the one set by the first reset")
+	}
+	if stored.PasswordChangedAt == nil {
+		t.Error("passwordChangedAt is not set")
+	}
+
+	var resets int
+	for _, record := range repo.Audit() {
+		if record.Action == entity.AuditPasswordReset {
+			resets++
+		}
+	}
+	if resets != 1 {
+		t.Errorf("got %d password reset audit records, want 1", resets)
+	}
+}
+
+func TestResetPasswordUnknownToken(t *testing.T) {
+	repo := usertest.NewRepo()
+	service, err := usertest.NewService(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.ResetPassword(context.Background(), &v1.PasswordResetForm{Token: "unknown", NewPassword: "new password"})
+	if !errors.Is(err, utils.ErrInvalidResetToken) {
+		t.Fatalf("ResetPassword = %v, want %v", err, utils.ErrInvalidResetToken)
+	}
+}
+
+func TestResetPasswordExpiredToken(t *testing.T) {
+	repo := usertest.NewRepo()
+	user := repo.AddUser(&entity.User{Username: "alice", HashedPassword: usertest.HashPassword("old password")})
+	repo.AddPasswordReset(user.ID, "reset-token", -time.Second)
+	service, err := usertest.NewService(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = service.ResetPassword(context.Background(), &v1.PasswordResetForm{Token: "reset-token", NewPassword: "new password"})
+	if !errors.Is(err, utils.ErrInvalidResetToken) {
+		t.Fatalf("ResetPassword = %v, want %v", err, utils.ErrInvalidResetToken)
+	}
+}
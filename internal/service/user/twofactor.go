@@ -0,0 +1,305 @@
+package userService
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/utils"
+	"template/pkg/auth"
+	"template/pkg/hash"
+	"template/pkg/totp"
+	"time"
+)
+
+const (
+	// challenge token purposes
+	challengeTwoFactor       = "2fa"
+	challengeTwoFactorEnroll = "2fa-enroll"
+
+	recoveryCodeCount = 10
+	// accepted clock drift, in TOTP periods
+	totpSkew = 1
+)
+
+// startSession issues tokens after the password was verified, unless the
+// user has to pass or enroll in two-factor authentication first.
+func (s *UserService) startSession(ctx context.Context, user *entity.User) (*entity.LoginResult, error) {
+	if user.TwoFactorEnabled() {
+		return s.challenge(user, challengeTwoFactor)
+	}
+
+	policy, err := s.userRepo.GetTwoFactorPolicy(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if policy.Requires(user.Role) {
+		return s.challenge(user, challengeTwoFactorEnroll)
+	}
+
+	tokens, err := s.createSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.LoginResult{Tokens: &tokens}, nil
+}
+
+func (s *UserService) challenge(user *entity.User, purpose string) (*entity.LoginResult, error) {
+	token, err := s.tokenManager.NewChallengeToken(user.ID.Hex(), purpose, s.cfg.ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.LoginResult{Challenge: &entity.TwoFactorChallenge{
+		ChallengeToken:     token,
+		ExpiresAt:          time.Now().Add(s.cfg.ChallengeTTL),
+		EnrollmentRequired: purpose == challengeTwoFactorEnroll,
+	}}, nil
+}
+
+func (s *UserService) userFromChallenge(ctx context.Context, token, purpose string) (*entity.User, error) {
+	userID, err := s.tokenManager.ParseChallengeToken(token, purpose)
+	if err != nil {
+		return nil, utils.ErrInvalidChallenge
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.Disabled {
+		return nil, utils.ErrAccountDisabled
+	}
+	return user, nil
+}
+
+// LoginTwoFactor completes a login with a TOTP or recovery code. Wrong codes
+// count as failed logins.
+func (s *UserService) LoginTwoFactor(ctx context.Context, form *v1.TwoFactorLoginForm) (entity.Tokens, error) {
+	user, err := s.userFromChallenge(ctx, form.ChallengeToken, challengeTwoFactor)
+	if err != nil {
+		return entity.Tokens{}, err
+	}
+
+	if err = s.loginGuard.Check(ctx, user.Username, form.IP); err != nil {
+		return entity.Tokens{}, err
+	}
+
+	if err = s.verifyCode(ctx, user, form.Code); err != nil {
+		if errors.Is(err, utils.ErrInvalidCode) {
+			return entity.Tokens{}, s.loginFailed(ctx, &v1.UserLoginForm{Username: user.Username, IP: form.IP}, err)
+		}
+		return entity.Tokens{}, err
+	}
+
+	if err = s.loginGuard.RegisterSuccess(ctx, user.Username); err != nil {
+		return entity.Tokens{}, err
+	}
+
+	return s.createSession(ctx, user)
+}
+
+// verifyCode accepts a current TOTP code or one of the unused recovery codes.
+func (s *UserService) verifyCode(ctx context.Context, user *entity.User, code string) error {
+	if !user.TwoFactorEnabled() {
+		return utils.ErrTwoFactorDisabled
+	}
+
+	if step, ok := totp.Validate(user.TwoFactor.Secret, code, time.Now(), totpSkew); ok {
+		return s.userRepo.UseTwoFactorStep(ctx, user.ID, step)
+	}
+
+	err := s.userRepo.UseRecoveryCode(ctx, user.ID, hashRecoveryCode(code))
+	if err != nil {
+		return err
+	}
+	return s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditTwoFactorRecovery,
+		ActorID: user.ID.Hex(),
+		Target:  user.ID.Hex(),
+		Details: map[string]string{"remaining": fmt.Sprint(len(user.TwoFactor.RecoveryCodes) - 1)},
+	})
+}
+
+// EnrollTwoFactor creates a new pending secret for the user. It is only
+// enforced after ConfirmTwoFactor.
+func (s *UserService) EnrollTwoFactor(ctx context.Context, userID string) (*entity.TwoFactorEnrollment, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactorEnabled() {
+		return nil, utils.ErrTwoFactorEnabled
+	}
+
+	secret, err := totp.NewSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err = s.userRepo.SetTwoFactorSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+
+	return &entity.TwoFactorEnrollment{
+		Secret:          secret,
+		ProvisioningURI: totp.ProvisioningURI(s.cfg.TOTPIssuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables the pending enrollment once the user proves the
+// authenticator works, and returns the recovery codes.
+func (s *UserService) ConfirmTwoFactor(ctx context.Context, userID string, form *v1.TwoFactorCodeForm) (*entity.RecoveryCodes, error) {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TwoFactor == nil {
+		return nil, utils.ErrTwoFactorDisabled
+	}
+	if user.TwoFactor.Enabled {
+		return nil, utils.ErrTwoFactorEnabled
+	}
+
+	step, ok := totp.Validate(user.TwoFactor.Secret, form.Code, time.Now(), totpSkew)
+	if !ok {
+		return nil, utils.ErrInvalidCode
+	}
+
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		code, err := auth.NewRandomString(5)
+		if err != nil {
+			return nil, err
+		}
+		codes[i] = code[:5] + "-" + code[5:]
+		hashes[i] = hashRecoveryCode(codes[i])
+	}
+
+	if err = s.userRepo.EnableTwoFactor(ctx, user.ID, step, hashes); err != nil {
+		return nil, err
+	}
+	err = s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditTwoFactorEnable,
+		ActorID: user.ID.Hex(),
+		Target:  user.ID.Hex(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &entity.RecoveryCodes{Codes: codes}, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking a
+// code. It is refused while the policy requires it for the user's role.
+func (s *UserService) DisableTwoFactor(ctx context.Context, userID string, form *v1.TwoFactorCodeForm) error {
+	user, err := s.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !user.TwoFactorEnabled() {
+		return utils.ErrTwoFactorDisabled
+	}
+
+	policy, err := s.userRepo.GetTwoFactorPolicy(ctx)
+	if err != nil {
+		return err
+	}
+	if policy.Requires(user.Role) {
+		return utils.ErrTwoFactorRequired
+	}
+
+	if err = s.verifyCode(ctx, user, form.Code); err != nil {
+		return err
+	}
+	if err = s.userRepo.DisableTwoFactor(ctx, user.ID); err != nil {
+		return err
+	}
+
+	return s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditTwoFactorDisable,
+		ActorID: user.ID.Hex(),
+		Target:  user.ID.Hex(),
+	})
+}
+
+// EnrollTwoFactorWithChallenge starts the enrollment required by the policy
+// during login, before the user holds any session.
+func (s *UserService) EnrollTwoFactorWithChallenge(ctx context.Context, form *v1.TwoFactorChallengeForm) (*entity.TwoFactorEnrollment, error) {
+	user, err := s.userFromChallenge(ctx, form.ChallengeToken, challengeTwoFactorEnroll)
+	if err != nil {
+		return nil, err
+	}
+	return s.EnrollTwoFactor(ctx, user.ID.Hex())
+}
+
+// ConfirmTwoFactorWithChallenge enables two-factor authentication and
+// completes the login that required it.
+func (s *UserService) ConfirmTwoFactorWithChallenge(ctx context.Context, form *v1.TwoFactorLoginForm) (*entity.TwoFactorLogin, error) {
+	user, err := s.userFromChallenge(ctx, form.ChallengeToken, challengeTwoFactorEnroll)
+	if err != nil {
+		return nil, err
+	}
+
+	codes, err := s.ConfirmTwoFactor(ctx, user.ID.Hex(), &v1.TwoFactorCodeForm{Code: form.Code})
+	if err != nil {
+		return nil, err
+	}
+
+	tokens, err := s.createSession(ctx, user)
+	if err != nil {
+		return nil, err
+	}
+	return &entity.TwoFactorLogin{Tokens: tokens, RecoveryCodes: *codes}, nil
+}
+
+func (s *UserService) GetTwoFactorPolicy(ctx context.Context) (*entity.TwoFactorPolicy, error) {
+	return s.userRepo.GetTwoFactorPolicy(ctx)
+}
+
+func (s *UserService) SetTwoFactorPolicy(ctx context.Context, form *v1.TwoFactorPolicyForm, actorID string) (*entity.TwoFactorPolicy, error) {
+	for _, role := range form.RequiredRoles {
+		if !knownRole(role) {
+			return nil, fmt.Errorf("unknown role %d: %w", role, utils.ErrBadInput)
+		}
+	}
+
+	policy := &entity.TwoFactorPolicy{
+		RequiredRoles: form.RequiredRoles,
+		UpdatedBy:     actorID,
+		UpdatedAt:     time.Now(),
+	}
+	if policy.RequiredRoles == nil {
+		policy.RequiredRoles = []int{}
+	}
+	if err := s.userRepo.SetTwoFactorPolicy(ctx, policy); err != nil {
+		return nil, err
+	}
+
+	err := s.userRepo.InsertAuditRecord(ctx, &entity.AuditRecord{
+		Action:  entity.AuditTwoFactorPolicy,
+		ActorID: actorID,
+		Details: map[string]string{"required_roles": fmt.Sprint(policy.RequiredRoles)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+func knownRole(role int) bool {
+	for _, r := range entity.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+func hashRecoveryCode(code string) string {
+	code = strings.ToLower(strings.NewReplacer("-", "", " ", "").Replace(code))
+	return hash.Token(code)
+}
@@ -0,0 +1,61 @@
+package userService_test
+
+import (
+	"context"
+	"errors"
+	v1 "template/internal/delivery/http/v1"
+	"template/internal/entity"
+	"template/internal/service/user/usertest"
+	"template/internal/utils"
+	"template/pkg/totp"
+	"testing"
+	"time"
+)
+
+// TestLoginTwoFactorRefusesReplay checks that a TOTP code completes one
+// login only, even while it is still valid.
+func TestLoginTwoFactorRefusesReplay(t *testing.T) {
+	ctx := context.Background()
+	secret, err := totp.NewSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := usertest.NewRepo()
+	repo.AddUser(&entity.User{
+		Username:       "alice",
+		HashedPassword: usertest.HashPassword("password"),
+		TwoFactor:      &entity.TwoFactor{Secret: secret, Enabled: true},
+	})
+	service, err := usertest.NewService(repo)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	challenge := func() string {
+		t.Helper()
+		res, err := service.Login(ctx, &v1.UserLoginForm{Username: "alice", Password: "password", IP: "192.0.2.1"})
+		if err != nil {
+			t.Fatalf("Login: %v", err)
+		}
+		if res.Challenge == nil {
+			t.Fatal("Login returned tokens instead of a two-factor challenge")
+		}
+		return res.Challenge.ChallengeToken
+	}
+
+	code, err := totp.Code(secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = service.LoginTwoFactor(ctx, &v1.TwoFactorLoginForm{ChallengeToken: challenge(), Code: code, IP: "192.0.2.1"})
+	if err != nil {
+		t.Fatalf("LoginTwoFactor: %v", err)
+	}
+
+	_, err = service.LoginTwoFactor(ctx, &v1.TwoFactorLoginForm{ChallengeToken: challenge(), Code: code, IP: "192.0.2.1"})
+	if !errors.Is(err, utils.ErrInvalidCode) {
+		t.Fatalf("LoginTwoFactor with a used code = %v, want %v", err, utils.ErrInvalidCode)
+	}
+}
@@ -11,27 +11,64 @@ import (
 	"template/internal/utils"
 	"template/pkg/auth"
 	"template/pkg/hash"
+	"template/pkg/notify"
+	"template/pkg/ttlcache"
 	"template/pkg/validator"
 	"time"
 )
 
+const userCacheSize = 10000
+
+// Config holds the token lifetimes and the links sent to users, see
+// config.AuthConfig.
+type Config struct {
+	AccessTokenTTL   time.Duration
+	RefreshTokenTTL  time.Duration
+	ImpersonationTTL time.Duration
+
+	ResetTokenTTL time.Duration
+	ResetURL      string
+
+	VerifyTokenTTL time.Duration
+	VerifyURL      string
+	VerifyCooldown time.Duration
+
+	ChallengeTTL time.Duration
+	TOTPIssuer   string
+
+	UserCacheTTL time.Duration
+}
+
 type UserService struct {
-	userRepo userRepo
+	cfg          Config
+	userRepo     userRepo
+	loginGuard   loginGuard
+	resetLimiter requestLimiter
+
+	hasher         hash.PasswordHasher
+	passwordPolicy *validator.PasswordPolicy
+	tokenManager   auth.TokenManager
+	notifier       notify.Notifier
+	closureGuard   accountClosureGuard
 
-	hasher       hash.PasswordHasher
-	tokenManager auth.TokenManager
+	users *ttlcache.Cache[string, *entity.User]
 
-	accessTokenTTL  time.Duration
-	refreshTokenTTL time.Duration
+	authenticators []Authenticator
 }
 
-func NewUserService(userRepo userRepo, hasher hash.PasswordHasher, manager auth.TokenManager, accesTokenTTL time.Duration, refreshTokenTTl time.Duration) *UserService {
+func NewUserService(cfg Config, userRepo userRepo, loginGuard loginGuard, resetLimiter requestLimiter, hasher hash.PasswordHasher, passwordPolicy *validator.PasswordPolicy, manager auth.TokenManager, notifier notify.Notifier, closureGuard accountClosureGuard, authenticators ...Authenticator) *UserService {
 	return &UserService{
-		userRepo:        userRepo,
-		hasher:          hasher,
-		tokenManager:    manager,
-		accessTokenTTL:  accesTokenTTL,
-		refreshTokenTTL: refreshTokenTTl,
+		cfg:            cfg,
+		userRepo:       userRepo,
+		loginGuard:     loginGuard,
+		resetLimiter:   resetLimiter,
+		hasher:         hasher,
+		passwordPolicy: passwordPolicy,
+		tokenManager:   manager,
+		notifier:       notifier,
+		closureGuard:   closureGuard,
+		users:          ttlcache.New[string, *entity.User](cfg.UserCacheTTL, userCacheSize),
+		authenticators: authenticators,
 	}
 }
 
@@ -40,47 +77,137 @@ type userRepo interface {
 	CreateUser(ctx context.Context, user *entity.User) (interface{}, error)
 	GetUserByID(ctx context.Context, id string) (*entity.User, error)
 	SetSession(ctx context.Context, userID primitive.ObjectID, session entity.Session) error
-	GetByRefreshToken(ctx context.Context, refreshToken string) (entity.User, error)
+	GetByRefreshToken(ctx context.Context, tokenHash string) (entity.User, error)
 	GetByCredentials(ctx context.Context, username, password string) (entity.User, error)
+	GetUserByUsername(ctx context.Context, username string) (*entity.User, error)
+	UpdatePassword(ctx context.Context, userID primitive.ObjectID, passwordHash string) error
+	RevokeSessions(ctx context.Context, userID primitive.ObjectID) error
+	CreatePasswordReset(ctx context.Context, reset *entity.PasswordReset) error
+	GetPasswordReset(ctx context.Context, tokenHash string) (*entity.PasswordReset, error)
+	ConsumePasswordReset(ctx context.Context, tokenHash string) (*entity.PasswordReset, error)
+	DeletePasswordResets(ctx context.Context, userID primitive.ObjectID) error
+	InsertAuditRecord(ctx context.Context, record *entity.AuditRecord) error
+	SetTwoFactorSecret(ctx context.Context, userID primitive.ObjectID, secret string) error
+	EnableTwoFactor(ctx context.Context, userID primitive.ObjectID, step int64, recoveryCodes []string) error
+	DisableTwoFactor(ctx context.Context, userID primitive.ObjectID) error
+	UseTwoFactorStep(ctx context.Context, userID primitive.ObjectID, step int64) error
+	UseRecoveryCode(ctx context.Context, userID primitive.ObjectID, codeHash string) error
+	GetTwoFactorPolicy(ctx context.Context) (*entity.TwoFactorPolicy, error)
+	SetTwoFactorPolicy(ctx context.Context, policy *entity.TwoFactorPolicy) error
+	GetUserByExternalID(ctx context.Context, provider, subject string) (*entity.User, error)
+	SyncExternalUser(ctx context.Context, userID primitive.ObjectID, ext *entity.ExternalIdentity) error
+	UpdateProfile(ctx context.Context, userID primitive.ObjectID, update *entity.ProfileUpdate) (*entity.User, error)
+	DeleteUser(ctx context.Context, userID primitive.ObjectID) error
+	DeleteUserAPIKeys(ctx context.Context, userID string) error
+	ListUsers(ctx context.Context, filter *entity.UserFilter, page, pageSize int) (*entity.PaginatedUsers, error)
+	SetUserRole(ctx context.Context, userID primitive.ObjectID, role int) error
+	SetUserDisabled(ctx context.Context, userID primitive.ObjectID, disabled bool) error
+	ClearPassword(ctx context.Context, userID primitive.ObjectID) error
+	GetUserByEmail(ctx context.Context, email string) (*entity.User, error)
+	SetEmailVerification(ctx context.Context, userID primitive.ObjectID, verification *entity.EmailVerification, notSentAfter time.Time) error
+	VerifyEmail(ctx context.Context, tokenHash string) (*entity.User, error)
+}
+
+// loginGuard throttles password guessing, see lockoutService.
+type loginGuard interface {
+	Check(ctx context.Context, username, ip string) error
+	RegisterFailure(ctx context.Context, username, ip string) error
+	RegisterSuccess(ctx context.Context, username string) error
+}
+
+// requestLimiter caps the requests per username and client IP, see
+// lockoutService.Limiter.
+type requestLimiter interface {
+	Allow(ctx context.Context, username, ip string) error
 }
 
-func (s *UserService) Login(ctx context.Context, form *v1.UserLoginForm) (entity.Tokens, error) {
+// accountClosureGuard refuses to close an account that still has open
+// loans or unpaid fines, with an error wrapping utils.ErrAccountInUse.
+type accountClosureGuard interface {
+	CheckClosure(ctx context.Context, user *entity.User) error
+}
+
+// NoClosureGuard lets every account close, so the open loans and fines
+// check is a no-op until loans and fines are tracked. It is the only guard
+// wired in today.
+type NoClosureGuard struct{}
+
+func (NoClosureGuard) CheckClosure(context.Context, *entity.User) error {
+	return nil
+}
+
+// Authenticator checks a password against an external directory, see
+// ldapService. It returns utils.ErrInvalidCredentials when the directory
+// does not accept it.
+type Authenticator interface {
+	Authenticate(ctx context.Context, username, password string) (*entity.ExternalIdentity, error)
+}
+
+func (s *UserService) Login(ctx context.Context, form *v1.UserLoginForm) (*entity.LoginResult, error) {
+	if err := s.loginGuard.Check(ctx, form.Username, form.IP); err != nil {
+		return nil, err
+	}
+
 	passwordHash, err := s.hasher.Hash(form.Password)
 	if err != nil {
-		return entity.Tokens{}, err
+		return nil, err
 	}
 
 	user, err := s.userRepo.GetByCredentials(ctx, form.Username, passwordHash)
 
 	if err != nil {
 		if errors.Is(err, utils.ErrUserNotFound) {
-			return entity.Tokens{}, err
+			return s.loginAuthenticators(ctx, form)
 		}
 
-		return entity.Tokens{}, err
+		return nil, err
 	}
 	if passwordHash != user.HashedPassword {
-		return entity.Tokens{}, utils.ErrInvalidCredentials
+		return nil, s.loginFailed(ctx, form, utils.ErrInvalidCredentials)
+	}
+	if user.Disabled {
+		return nil, utils.ErrAccountDisabled
+	}
+
+	if err = s.loginGuard.RegisterSuccess(ctx, form.Username); err != nil {
+		return nil, err
 	}
 
-	return s.createSession(ctx, user.ID)
+	return s.startSession(ctx, &user)
+}
+
+func (s *UserService) loginFailed(ctx context.Context, form *v1.UserLoginForm, cause error) error {
+	if err := s.loginGuard.RegisterFailure(ctx, form.Username, form.IP); err != nil {
+		return err
+	}
+	return cause
 }
 func (s *UserService) SignUp(ctx context.Context, form *v1.UserSignupForm) (interface{}, error) {
 	adminKey := os.Getenv("ADMIN_KEY")
 	form.CheckField(validator.MinChars(form.Username, 5), &form.UserErrors.Username, "Username must be at least 5 chars long")
 	form.CheckField(validator.MaxChars(form.Username, 20), &form.UserErrors.Username, "Username must be max 20 chars long")
 	form.CheckField(validator.NotBlank(form.Username), &form.UserErrors.Username, "Username cannot be blank")
-	form.CheckField(validator.MinChars(form.Password, 5), &form.UserErrors.Password, "Password must be at least 5 chars long")
-	form.CheckField(validator.MaxChars(form.Password, 20), &form.UserErrors.Password, "Password must be max 20 chars long")
-	form.CheckField(validator.NotBlank(form.Password), &form.UserErrors.Password, "Password cannot be blank")
+	form.Email = validator.NormalizeEmail(form.Email)
+	form.CheckField(validator.ValidEmail(form.Email), &form.UserErrors.Email, "Email is not valid")
+	form.CheckField(validator.NotBlank(form.Email), &form.UserErrors.Email, "Email cannot be blank")
+	if err := form.CheckPassword(s.passwordPolicy, form.Password, form.Username, &form.UserErrors.Password); err != nil {
+		return 0, err
+	}
 	if form.Secret != "" {
 		form.CheckField(validator.CheckAdmin(form.Secret, adminKey), &form.UserErrors.Secret, "Secret key is not matching")
 	}
 	if !form.ValidUser() {
 		return 0, utils.InvalidForm
 	}
+
+	_, err := s.userRepo.GetUserByEmail(ctx, form.Email)
+	if err == nil {
+		return 0, utils.ErrEmailAlreadyExists
+	} else if !errors.Is(err, utils.ErrUserNotFound) {
+		return 0, err
+	}
+
 	user := dto.FormToUser(*form)
-	var err error
 	user.HashedPassword, err = s.hasher.Hash(form.Password)
 	if err != nil {
 		return entity.Tokens{}, err
@@ -92,29 +219,65 @@ func (s *UserService) SignUp(ctx context.Context, form *v1.UserSignupForm) (inte
 		}
 		return 0, err
 	}
+	if oid, ok := id.(primitive.ObjectID); ok {
+		user.ID = oid
+		// the account exists at this point, a lost email is recovered with
+		// a resend
+		_ = s.sendVerification(ctx, user)
+	}
 	return id, nil
 }
 
-func (s *UserService) GetUserByID(id string) (*entity.User, error) {
-	return s.userRepo.GetUserByID(context.Background(), id)
+// GetUserByID serves the per-request authorization checks. Users are cached
+// for a short time, so changes made on other instances show up within the
+// cache TTL.
+func (s *UserService) GetUserByID(ctx context.Context, id string) (*entity.User, error) {
+	if user, ok := s.users.Get(id); ok {
+		return user, nil
+	}
+
+	user, err := s.userRepo.GetUserByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.users.Set(id, user)
+	return user, nil
 }
 
-func (s *UserService) RefreshTokens(ctx context.Context, refreshToken string) (entity.Tokens, error) {
-	user, err := s.userRepo.GetByRefreshToken(ctx, refreshToken)
+// ForgetUser drops a user from the cache after it was changed outside of
+// the service, e.g. by SCIM provisioning.
+func (s *UserService) ForgetUser(id string) {
+	s.users.Delete(id)
+}
+
+// RefreshTokens replaces the session of userID, the caller authenticated
+// by the access token. A refresh token of any other user is rejected like
+// an unknown one.
+func (s *UserService) RefreshTokens(ctx context.Context, userID, refreshToken string) (entity.Tokens, error) {
+	user, err := s.userRepo.GetByRefreshToken(ctx, hash.Token(refreshToken))
 	if err != nil {
+		if errors.Is(err, utils.ErrUserNotFound) {
+			return entity.Tokens{}, utils.ErrInvalidRefreshToken
+		}
 		return entity.Tokens{}, err
 	}
+	if user.ID.Hex() != userID {
+		return entity.Tokens{}, utils.ErrInvalidRefreshToken
+	}
+	if user.Disabled {
+		return entity.Tokens{}, utils.ErrAccountDisabled
+	}
 
-	return s.createSession(ctx, user.ID)
+	return s.createSession(ctx, &user)
 }
 
-func (s *UserService) createSession(ctx context.Context, userId primitive.ObjectID) (entity.Tokens, error) {
+func (s *UserService) createSession(ctx context.Context, user *entity.User) (entity.Tokens, error) {
 	var (
 		res entity.Tokens
 		err error
 	)
 
-	res.AccessToken, err = s.tokenManager.NewJWT(userId.Hex(), s.accessTokenTTL)
+	res.AccessToken, err = s.tokenManager.NewJWT(user.ID.Hex(), user.Role, s.cfg.AccessTokenTTL)
 	if err != nil {
 		return res, err
 	}
@@ -125,11 +288,11 @@ func (s *UserService) createSession(ctx context.Context, userId primitive.Object
 	}
 
 	session := entity.Session{
-		RefreshToken: res.RefreshToken,
-		ExpiresAt:    time.Now().Add(s.refreshTokenTTL),
+		TokenHash: hash.Token(res.RefreshToken),
+		ExpiresAt: time.Now().Add(s.cfg.RefreshTokenTTL),
 	}
 
-	err = s.userRepo.SetSession(ctx, userId, session)
+	err = s.userRepo.SetSession(ctx, user.ID, session)
 
 	return res, err
 }
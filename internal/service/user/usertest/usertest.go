@@ -0,0 +1,334 @@
+// Package usertest runs a UserService on an in-memory user store, for the
+// tests of the login and password paths and of the identity providers
+// signing users in through it.
+package usertest
+
+import (
+	"context"
+	"sync"
+	"template/internal/entity"
+	"template/internal/repository/memory"
+	"template/internal/repository/mongo"
+	lockoutService "template/internal/service/lockout"
+	userService "template/internal/service/user"
+	"template/internal/utils"
+	"template/pkg/auth"
+	"template/pkg/hash"
+	"template/pkg/notify"
+	"template/pkg/validator"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.uber.org/zap"
+)
+
+// Repo keeps the users, password resets and the audit log the login and
+// password paths touch. It mirrors the unique indexes on username, email
+// and external IDs.
+type Repo struct {
+	// the methods logins do not use are left to the nil MongoRepo and
+	// panic when called
+	*mongo.MongoRepo
+
+	mu     sync.Mutex
+	users  map[primitive.ObjectID]*entity.User
+	resets map[string]*entity.PasswordReset
+	audit  []*entity.AuditRecord
+	policy entity.TwoFactorPolicy
+}
+
+func NewRepo() *Repo {
+	return &Repo{
+		users:  make(map[primitive.ObjectID]*entity.User),
+		resets: make(map[string]*entity.PasswordReset),
+	}
+}
+
+// AddUser stores a copy of user, with a new ID when it has none.
+func (r *Repo) AddUser(user *entity.User) *entity.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	r.users[user.ID] = copyUser(user)
+	return user
+}
+
+// Users returns a copy of every stored user.
+func (r *Repo) Users() []*entity.User {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	res := make([]*entity.User, 0, len(r.users))
+	for _, user := range r.users {
+		res = append(res, copyUser(user))
+	}
+	return res
+}
+
+// AddPasswordReset stores a reset of token for the user, valid for ttl.
+func (r *Repo) AddPasswordReset(userID primitive.ObjectID, token string, ttl time.Duration) {
+	now := time.Now()
+	_ = r.CreatePasswordReset(context.Background(), &entity.PasswordReset{
+		TokenHash: hash.Token(token),
+		UserID:    userID,
+		CreatedAt: now,
+		ExpiresAt: now.Add(ttl),
+	})
+}
+
+// Audit returns the audit records written so far.
+func (r *Repo) Audit() []*entity.AuditRecord {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]*entity.AuditRecord(nil), r.audit...)
+}
+
+// RequireTwoFactor sets the roles the two-factor policy applies to.
+func (r *Repo) RequireTwoFactor(roles ...int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.policy.RequiredRoles = roles
+}
+
+func (r *Repo) CreateUser(_ context.Context, user *entity.User) (interface{}, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, other := range r.users {
+		if other.Username == user.Username || (user.Email != "" && other.Email == user.Email) {
+			return 0, utils.ErrUserAlreadyExists
+		}
+		for provider, subject := range user.ExternalIDs {
+			if other.ExternalIDs[provider] == subject {
+				return 0, utils.ErrUserAlreadyExists
+			}
+		}
+	}
+
+	id := primitive.NewObjectID()
+	stored := copyUser(user)
+	stored.ID = id
+	r.users[id] = stored
+	return id, nil
+}
+
+func (r *Repo) GetUserByID(_ context.Context, id string) (*entity.User, error) {
+	objectID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[objectID]
+	if !ok {
+		return nil, utils.ErrNotExist
+	}
+	return copyUser(user), nil
+}
+
+func (r *Repo) GetByCredentials(_ context.Context, username, password string) (entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if user.Username == username && user.HashedPassword == password {
+			return *copyUser(user), nil
+		}
+	}
+	return entity.User{}, utils.ErrUserNotFound
+}
+
+func (r *Repo) GetUserByExternalID(_ context.Context, provider, subject string) (*entity.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, user := range r.users {
+		if id, ok := user.ExternalIDs[provider]; ok && id == subject {
+			return copyUser(user), nil
+		}
+	}
+	return nil, utils.ErrUserNotFound
+}
+
+func (r *Repo) SyncExternalUser(_ context.Context, userID primitive.ObjectID, ext *entity.ExternalIdentity) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return nil
+	}
+	if ext.Email != "" {
+		user.Email = ext.Email
+	}
+	if ext.DisplayName != "" {
+		user.DisplayName = ext.DisplayName
+	}
+	if ext.Role != nil {
+		user.Role = *ext.Role
+	}
+	return nil
+}
+
+func (r *Repo) SetSession(_ context.Context, _ primitive.ObjectID, _ entity.Session) error {
+	return nil
+}
+
+func (r *Repo) UpdatePassword(_ context.Context, userID primitive.ObjectID, passwordHash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok {
+		return utils.ErrUserNotFound
+	}
+	now := time.Now()
+	user.HashedPassword = passwordHash
+	user.PasswordChangedAt = &now
+	return nil
+}
+
+func (r *Repo) RevokeSessions(_ context.Context, _ primitive.ObjectID) error {
+	return nil
+}
+
+func (r *Repo) DeleteUserAPIKeys(_ context.Context, _ string) error {
+	return nil
+}
+
+func (r *Repo) CreatePasswordReset(_ context.Context, reset *entity.PasswordReset) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored := *reset
+	r.resets[reset.TokenHash] = &stored
+	return nil
+}
+
+func (r *Repo) GetPasswordReset(_ context.Context, tokenHash string) (*entity.PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	reset, ok := r.resets[tokenHash]
+	if !ok || reset.UsedAt != nil || !reset.ExpiresAt.After(time.Now()) {
+		return nil, utils.ErrInvalidResetToken
+	}
+	res := *reset
+	return &res, nil
+}
+
+func (r *Repo) ConsumePasswordReset(_ context.Context, tokenHash string) (*entity.PasswordReset, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	reset, ok := r.resets[tokenHash]
+	if !ok || reset.UsedAt != nil || !reset.ExpiresAt.After(now) {
+		return nil, utils.ErrInvalidResetToken
+	}
+	reset.UsedAt = &now
+	res := *reset
+	return &res, nil
+}
+
+func (r *Repo) DeletePasswordResets(_ context.Context, userID primitive.ObjectID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for tokenHash, reset := range r.resets {
+		if reset.UserID == userID {
+			delete(r.resets, tokenHash)
+		}
+	}
+	return nil
+}
+
+func (r *Repo) UseTwoFactorStep(_ context.Context, userID primitive.ObjectID, step int64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	user, ok := r.users[userID]
+	if !ok || user.TwoFactor == nil || user.TwoFactor.LastStep >= step {
+		return utils.ErrInvalidCode
+	}
+	user.TwoFactor.LastStep = step
+	return nil
+}
+
+func (r *Repo) GetTwoFactorPolicy(_ context.Context) (*entity.TwoFactorPolicy, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	policy := r.policy
+	return &policy, nil
+}
+
+func (r *Repo) InsertAuditRecord(_ context.Context, record *entity.AuditRecord) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.audit = append(r.audit, record)
+	return nil
+}
+
+func copyUser(user *entity.User) *entity.User {
+	res := *user
+	if user.TwoFactor != nil {
+		twoFactor := *user.TwoFactor
+		res.TwoFactor = &twoFactor
+	}
+	if user.ExternalIDs != nil {
+		res.ExternalIDs = make(map[string]string, len(user.ExternalIDs))
+		for provider, subject := range user.ExternalIDs {
+			res.ExternalIDs[provider] = subject
+		}
+	}
+	return &res
+}
+
+var hasher = hash.NewSHA1Hasher("usertest")
+
+// HashPassword returns password hashed the way the service built by
+// NewService stores it.
+func HashPassword(password string) string {
+	passwordHash, _ := hasher.Hash(password)
+	return passwordHash
+}
+
+// NewService returns a UserService on repo, signing in with the given
+// authenticators after the local password check. Lockouts are kept in
+// memory.
+func NewService(repo *Repo, authenticators ...userService.Authenticator) (*userService.UserService, error) {
+	tokenManager, err := auth.NewManager("usertest-signing-key")
+	if err != nil {
+		return nil, err
+	}
+
+	attempts := memory.NewMemoryRepo(time.Minute, time.Minute, 1000)
+	cfg := userService.Config{
+		AccessTokenTTL:  time.Minute,
+		RefreshTokenTTL: time.Hour,
+		ChallengeTTL:    time.Minute,
+		ResetTokenTTL:   time.Hour,
+		UserCacheTTL:    time.Minute,
+	}
+	return userService.NewUserService(
+		cfg,
+		repo,
+		lockoutService.NewLockoutService(attempts, repo, 5, 20, time.Minute, time.Minute, time.Hour),
+		lockoutService.NewLimiter(attempts, "reset", 5, 20, time.Hour),
+		hasher,
+		&validator.PasswordPolicy{MinLength: 8},
+		tokenManager,
+		notify.NewLogNotifier(zap.NewNop()),
+		userService.NoClosureGuard{},
+		authenticators...,
+	), nil
+}
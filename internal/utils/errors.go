@@ -1,14 +1,54 @@
 package utils
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"time"
+)
 
 var (
-	ErrNotExist           = errors.New("requested data does not exist")
-	InvalidForm           = errors.New("invalid form")
-	ErrEncoding           = errors.New("error encoding message")
-	ErrUserNotFound       = errors.New("user not found")
-	ErrUserAlreadyExists  = errors.New("user already exists")
-	ErrBookAlreadyExists  = errors.New("book already exists")
-	ErrInvalidCredentials = errors.New("invalid credentials")
-	ErrBadInput           = errors.New("invalid input")
+	ErrNotExist            = errors.New("requested data does not exist")
+	InvalidForm            = errors.New("invalid form")
+	ErrEncoding            = errors.New("error encoding message")
+	ErrUserNotFound        = errors.New("user not found")
+	ErrUserAlreadyExists   = errors.New("user already exists")
+	ErrBookAlreadyExists   = errors.New("book already exists")
+	ErrInvalidCredentials  = errors.New("invalid credentials")
+	ErrBadInput            = errors.New("invalid input")
+	ErrInvalidAPIKey       = errors.New("invalid api key")
+	ErrTooManyAttempts     = errors.New("too many attempts")
+	ErrInvalidResetToken   = errors.New("invalid or expired reset token")
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	ErrForbidden           = errors.New("action not allowed")
+	ErrInvalidCode         = errors.New("invalid two-factor code")
+	ErrInvalidChallenge    = errors.New("invalid or expired challenge token")
+	ErrTwoFactorEnabled    = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorDisabled   = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorRequired   = errors.New("two-factor authentication is required for this role")
+	ErrSSODisabled         = errors.New("single sign-on is not enabled")
+	ErrInvalidState        = errors.New("invalid or expired login state")
+	ErrAccountDisabled     = errors.New("account is disabled")
+	ErrEmailAlreadyExists  = errors.New("email already in use")
+	ErrEmailVerified       = errors.New("email is already verified")
+	ErrInvalidVerifyToken  = errors.New("invalid or expired verification token")
+	ErrSCIMDisabled        = errors.New("scim provisioning is not enabled")
+	ErrInvalidFilter       = errors.New("invalid filter")
+	ErrCacheDisabled       = errors.New("book cache is not enabled")
+	ErrUnavailable         = errors.New("service temporarily unavailable")
+	ErrCheckRunning        = errors.New("a consistency check is already running")
+	ErrAccountInUse        = errors.New("account has open loans or fines")
 )
+
+// LockoutError is returned while a caller is locked out or rate limited.
+// It matches ErrTooManyAttempts with errors.Is.
+type LockoutError struct {
+	RetryAfter time.Duration
+}
+
+func (e *LockoutError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrTooManyAttempts, e.RetryAfter.Round(time.Second))
+}
+
+func (e *LockoutError) Unwrap() error {
+	return ErrTooManyAttempts
+}
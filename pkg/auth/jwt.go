@@ -4,19 +4,45 @@ import (
 	"errors"
 	"fmt"
 	"github.com/golang-jwt/jwt"
-	"math/rand"
+	"sort"
 	"time"
 )
 
+const refreshTokenBytes = 32
+
 // TokenManager provides logic for JWT & Refresh tokens generation and parsing.
 type TokenManager interface {
-	NewJWT(userId string, ttl time.Duration) (string, error)
-	Parse(accessToken string) (string, error)
+	NewJWT(userId string, role int, ttl time.Duration) (string, error)
+	NewImpersonationJWT(userId string, role int, actorId string, ttl time.Duration) (string, error)
+	Parse(accessToken string) (*Claims, error)
 	NewRefreshToken() (string, error)
+	NewChallengeToken(userId, purpose string, ttl time.Duration) (string, error)
+	ParseChallengeToken(token, purpose string) (string, error)
+	JWKS() JWKS
+}
+
+// Claims are the claims of an access token. Role is the role of the user
+// when the token was issued. Act is set when the token was issued to
+// another user acting as the subject.
+type Claims struct {
+	jwt.StandardClaims
+	Role int    `json:"role"`
+	Act  *Actor `json:"act,omitempty"`
 }
 
+// Actor is the party acting on behalf of the subject (RFC 8693).
+type Actor struct {
+	Subject string `json:"sub"`
+}
+
+// Manager signs tokens either with a shared HS256 secret or with the active
+// asymmetric key. Every key it holds is accepted when parsing, which allows
+// rotating the active key without invalidating tokens already issued.
 type Manager struct {
 	signingKey string
+
+	active *Key
+	keys   map[string]*Key
 }
 
 func NewManager(signingKey string) (*Manager, error) {
@@ -27,44 +53,155 @@ func NewManager(signingKey string) (*Manager, error) {
 	return &Manager{signingKey: signingKey}, nil
 }
 
-func (m *Manager) NewJWT(userId string, ttl time.Duration) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{
+// NewKeyManager creates a Manager that signs with the key identified by
+// activeKeyID and verifies with any of the given keys.
+func NewKeyManager(activeKeyID string, keys ...*Key) (*Manager, error) {
+	m := &Manager{keys: make(map[string]*Key, len(keys))}
+	for _, key := range keys {
+		if _, ok := m.keys[key.ID]; ok {
+			return nil, fmt.Errorf("duplicate key id %s", key.ID)
+		}
+		m.keys[key.ID] = key
+	}
+
+	active, ok := m.keys[activeKeyID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found", activeKeyID)
+	}
+	if !active.canSign() {
+		return nil, fmt.Errorf("active key %q has no private key", activeKeyID)
+	}
+	m.active = active
+
+	return m, nil
+}
+
+func (m *Manager) NewJWT(userId string, role int, ttl time.Duration) (string, error) {
+	return m.sign(&Claims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Subject:   userId,
+		},
+		Role: role,
+	})
+}
+
+// NewImpersonationJWT issues an access token for userId on behalf of
+// actorId.
+func (m *Manager) NewImpersonationJWT(userId string, role int, actorId string, ttl time.Duration) (string, error) {
+	if actorId == "" {
+		return "", errors.New("empty actor")
+	}
+
+	return m.sign(&Claims{
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(ttl).Unix(),
+			IssuedAt:  time.Now().Unix(),
+			Subject:   userId,
+		},
+		Role: role,
+		Act:  &Actor{Subject: actorId},
+	})
+}
+
+func (m *Manager) sign(claims jwt.Claims) (string, error) {
+	if m.active == nil {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+		return token.SignedString([]byte(m.signingKey))
+	}
+
+	token := jwt.NewWithClaims(m.active.Method, claims)
+	token.Header["kid"] = m.active.ID
+
+	return token.SignedString(m.active.privateKey)
+}
+
+func (m *Manager) Parse(accessToken string) (*Claims, error) {
+	var claims Claims
+	if _, err := jwt.ParseWithClaims(accessToken, &claims, m.keyFunc); err != nil {
+		return nil, err
+	}
+	// challenge tokens carry an audience, access tokens never do
+	if claims.Audience != "" {
+		return nil, errors.New("not an access token")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("token has no subject")
+	}
+	if claims.Act != nil && claims.Act.Subject == "" {
+		return nil, errors.New("token has an empty actor")
+	}
+
+	return &claims, nil
+}
+
+// NewChallengeToken issues a short-lived token that only proves the user
+// passed one step of a multi-step flow, e.g. the password before a second
+// factor. purpose is kept in the audience, so the token is rejected by Parse
+// and by ParseChallengeToken for any other purpose.
+func (m *Manager) NewChallengeToken(userId, purpose string, ttl time.Duration) (string, error) {
+	return m.sign(jwt.StandardClaims{
+		Audience:  purpose,
 		ExpiresAt: time.Now().Add(ttl).Unix(),
 		Subject:   userId,
 	})
+}
+
+func (m *Manager) ParseChallengeToken(challengeToken, purpose string) (string, error) {
+	var claims jwt.StandardClaims
+	if _, err := jwt.ParseWithClaims(challengeToken, &claims, m.keyFunc); err != nil {
+		return "", err
+	}
+	if claims.Audience != purpose {
+		return "", errors.New("unexpected token purpose")
+	}
 
-	return token.SignedString([]byte(m.signingKey))
+	return claims.Subject, nil
 }
 
-func (m *Manager) Parse(accessToken string) (string, error) {
-	token, err := jwt.Parse(accessToken, func(token *jwt.Token) (i interface{}, err error) {
+func (m *Manager) keyFunc(token *jwt.Token) (interface{}, error) {
+	if m.active == nil {
 		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
 
 		return []byte(m.signingKey), nil
-	})
-	if err != nil {
-		return "", err
 	}
 
-	claims, ok := token.Claims.(jwt.MapClaims)
+	kid, ok := token.Header["kid"].(string)
 	if !ok {
-		return "", fmt.Errorf("error get user claims from token")
+		return nil, errors.New("token has no key id")
 	}
 
-	return claims["sub"].(string), nil
-}
+	key, ok := m.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown key id: %s", kid)
+	}
 
-func (m *Manager) NewRefreshToken() (string, error) {
-	b := make([]byte, 32)
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
 
-	s := rand.NewSource(time.Now().Unix())
-	r := rand.New(s)
+	return key.publicKey, nil
+}
 
-	if _, err := r.Read(b); err != nil {
-		return "", err
+// JWKS returns the public verification keys. Shared HS256 secrets are
+// never published, so the set is empty in that mode.
+func (m *Manager) JWKS() JWKS {
+	res := JWKS{Keys: make([]JWK, 0, len(m.keys))}
+	for _, key := range m.keys {
+		res.Keys = append(res.Keys, key.jwk())
 	}
+	sort.Slice(res.Keys, func(i, j int) bool {
+		return res.Keys[i].Kid < res.Keys[j].Kid
+	})
 
-	return fmt.Sprintf("%x", b), nil
+	return res
+}
+
+// NewRefreshToken returns an opaque token read from crypto/rand. Only its
+// hash is stored, like reset tokens and API keys.
+func (m *Manager) NewRefreshToken() (string, error) {
+	return NewRandomString(refreshTokenBytes)
 }
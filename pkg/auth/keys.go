@@ -0,0 +1,163 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Key is an asymmetric signing key identified by its kid.
+// Keys without a private part can only be used to verify tokens.
+type Key struct {
+	ID         string
+	Method     jwt.SigningMethod
+	privateKey crypto.PrivateKey
+	publicKey  crypto.PublicKey
+}
+
+// LoadKey reads a PEM encoded key pair for the given algorithm.
+// Either file may be empty: the public key is derived from the private one,
+// and a key loaded only from a public file is kept for verification. When
+// both are given they must belong together.
+func LoadKey(id, alg, privateKeyFile, publicKeyFile string) (*Key, error) {
+	if id == "" {
+		return nil, errors.New("empty key id")
+	}
+	if privateKeyFile == "" && publicKeyFile == "" {
+		return nil, fmt.Errorf("key %s: no key files", id)
+	}
+
+	key := &Key{ID: id}
+	switch alg {
+	case AlgRS256:
+		key.Method = jwt.SigningMethodRS256
+	case AlgEdDSA:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("key %s: unsupported algorithm %q", id, alg)
+	}
+
+	if privateKeyFile != "" {
+		data, err := os.ReadFile(privateKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if err = key.parsePrivate(data); err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+	}
+
+	if publicKeyFile != "" {
+		data, err := os.ReadFile(publicKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+		if err = key.parsePublic(data); err != nil {
+			return nil, fmt.Errorf("key %s: %w", id, err)
+		}
+	}
+
+	return key, nil
+}
+
+func (k *Key) parsePrivate(data []byte) error {
+	switch k.Method {
+	case jwt.SigningMethodRS256:
+		private, err := jwt.ParseRSAPrivateKeyFromPEM(data)
+		if err != nil {
+			return err
+		}
+		k.privateKey, k.publicKey = private, &private.PublicKey
+	case jwt.SigningMethodEdDSA:
+		parsed, err := jwt.ParseEdPrivateKeyFromPEM(data)
+		if err != nil {
+			return err
+		}
+		private, ok := parsed.(ed25519.PrivateKey)
+		if !ok {
+			return errors.New("not an ed25519 private key")
+		}
+		k.privateKey, k.publicKey = private, private.Public()
+	}
+	return nil
+}
+
+// parsePublic sets the public key. With a private key loaded first, it has
+// to be the public key derived from it, since a mismatch would make every
+// token fail verification and publish the wrong key in the JWKS.
+func (k *Key) parsePublic(data []byte) error {
+	var (
+		public crypto.PublicKey
+		err    error
+	)
+	switch k.Method {
+	case jwt.SigningMethodRS256:
+		public, err = jwt.ParseRSAPublicKeyFromPEM(data)
+	case jwt.SigningMethodEdDSA:
+		public, err = jwt.ParseEdPublicKeyFromPEM(data)
+	}
+	if err != nil {
+		return err
+	}
+
+	if derived, ok := k.publicKey.(interface{ Equal(crypto.PublicKey) bool }); ok && !derived.Equal(public) {
+		return errors.New("public key does not match the private key")
+	}
+	k.publicKey = public
+	return nil
+}
+
+func (k *Key) canSign() bool {
+	return k.privateKey != nil
+}
+
+// JWK is a public key in JSON Web Key format (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is the document served at /.well-known/jwks.json.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+func (k *Key) jwk() JWK {
+	res := JWK{
+		Kid: k.ID,
+		Use: "sig",
+		Alg: k.Method.Alg(),
+	}
+
+	switch public := k.publicKey.(type) {
+	case *rsa.PublicKey:
+		res.Kty = "RSA"
+		res.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+		res.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		res.Kty = "OKP"
+		res.Crv = "Ed25519"
+		res.X = base64.RawURLEncoding.EncodeToString(public)
+	}
+
+	return res
+}
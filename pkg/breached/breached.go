@@ -0,0 +1,74 @@
+// Package breached looks passwords up in a local copy of a breached
+// password corpus split into k-anonymity range files, the format served by
+// the Pwned Passwords range API. The SHA-1 of a password is split into a
+// 5 character prefix, naming the file, and a 35 character suffix, listed
+// in the file one per line as "SUFFIX:COUNT".
+package breached
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const prefixLen = 5
+
+// List is a directory of range files named by prefix, e.g. "5BAA6" or
+// "5BAA6.txt".
+type List struct {
+	dir string
+}
+
+func NewList(dir string) (*List, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("breached password list: %w", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("breached password list: %s is not a directory", dir)
+	}
+	return &List{dir: dir}, nil
+}
+
+// Contains reports whether the password is in the list. A missing range
+// file means no password with that prefix is known.
+func (l *List) Contains(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:prefixLen], digest[prefixLen:]
+
+	f, err := l.open(prefix)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if i := strings.IndexByte(line, ':'); i >= 0 {
+			line = line[:i]
+		}
+		if strings.EqualFold(line, suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
+
+func (l *List) open(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(l.dir, prefix))
+	if errors.Is(err, fs.ErrNotExist) {
+		return os.Open(filepath.Join(l.dir, prefix+".txt"))
+	}
+	return f, err
+}
@@ -0,0 +1,201 @@
+// Package breaker implements a circuit breaker with a per-call timeout. A
+// breaker opens after a number of consecutive failures and rejects calls
+// until a cooldown has passed, then lets one trial call through: its
+// success closes the breaker again, its failure reopens it.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOpen    = errors.New("circuit breaker is open")
+	ErrTimeout = errors.New("call timed out")
+)
+
+type State int
+
+const (
+	Closed State = iota
+	Open
+	HalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	default:
+		return "half-open"
+	}
+}
+
+// Status is a snapshot of a breaker.
+type Status struct {
+	Name     string     `json:"name"`
+	State    string     `json:"state"`
+	Failures int        `json:"failures"`
+	OpenedAt *time.Time `json:"opened_at,omitempty"`
+}
+
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+	timeout   time.Duration
+	// ignore are errors that are answers rather than failures, like a
+	// record not found
+	ignore []error
+
+	mu       sync.Mutex
+	state    State
+	failures int
+	openedAt time.Time
+	// trial is set while the half-open trial call runs
+	trial bool
+}
+
+// New returns a closed breaker. A zero timeout leaves calls unbounded.
+func New(name string, threshold int, cooldown, timeout time.Duration, ignore ...error) *Breaker {
+	return &Breaker{
+		name:      name,
+		threshold: threshold,
+		cooldown:  cooldown,
+		timeout:   timeout,
+		ignore:    ignore,
+	}
+}
+
+// Do runs fn unless the breaker is open, with the per-call timeout applied
+// to its context. A call abandoned by its caller counts neither way.
+func (b *Breaker) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	if !b.allow() {
+		return fmt.Errorf("%s: %w", b.name, ErrOpen)
+	}
+
+	callCtx, cancel := ctx, context.CancelFunc(func() {})
+	if b.timeout > 0 {
+		callCtx, cancel = context.WithTimeout(ctx, b.timeout)
+	}
+	defer cancel()
+
+	err := fn(callCtx)
+	if err != nil && ctx.Err() == nil && errors.Is(callCtx.Err(), context.DeadlineExceeded) {
+		err = fmt.Errorf("%s: %w: %w", b.name, ErrTimeout, err)
+	}
+
+	switch {
+	case ctx.Err() != nil:
+		b.release()
+	case err == nil || b.ignored(err):
+		b.success()
+	default:
+		b.failure()
+	}
+	return err
+}
+
+// Call is Do for functions returning a value.
+func Call[T any](ctx context.Context, b *Breaker, fn func(ctx context.Context) (T, error)) (T, error) {
+	var res T
+	err := b.Do(ctx, func(ctx context.Context) error {
+		var err error
+		res, err = fn(ctx)
+		return err
+	})
+	return res, err
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.current()
+}
+
+func (b *Breaker) Status() Status {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := Status{
+		Name:     b.name,
+		State:    b.current().String(),
+		Failures: b.failures,
+	}
+	if b.state != Closed {
+		openedAt := b.openedAt
+		status.OpenedAt = &openedAt
+	}
+	return status
+}
+
+// current reports an open breaker past its cooldown as half-open.
+func (b *Breaker) current() State {
+	if b.state == Open && time.Since(b.openedAt) >= b.cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.current() {
+	case Closed:
+		return true
+	case HalfOpen:
+		if b.trial {
+			return false
+		}
+		b.state, b.trial = HalfOpen, true
+		return true
+	default:
+		return false
+	}
+}
+
+func (b *Breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state, b.failures, b.trial = Closed, 0, false
+	b.openedAt = time.Time{}
+}
+
+func (b *Breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == HalfOpen || b.failures >= b.threshold {
+		b.state, b.openedAt = Open, time.Now()
+	}
+	b.trial = false
+}
+
+// release gives the trial back without a verdict.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.trial {
+		// past its cooldown already, so the next call is a trial again
+		b.state, b.trial = Open, false
+	}
+}
+
+func (b *Breaker) ignored(err error) bool {
+	for _, target := range b.ignore {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,14 @@
+package hash
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+)
+
+// Token hashes a high-entropy secret such as an API key or a one-time token.
+// Unlike passwords these cannot be brute-forced, so a plain SHA256 is enough
+// and allows looking the secret up by its hash.
+func Token(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,111 @@
+package totp
+
+import (
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA1 seed of RFC 6238 Appendix B, "12345678901234567890".
+var rfcSecret = encoding.EncodeToString([]byte("12345678901234567890"))
+
+// TestCodeRFC6238 checks the SHA1 test vectors of RFC 6238 Appendix B. The
+// RFC lists 8 digit codes, Code returns their last Digits digits.
+func TestCodeRFC6238(t *testing.T) {
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+
+	for _, tt := range tests {
+		code, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if code != tt.code {
+			t.Errorf("Code at %d = %s, want %s", tt.unix, code, tt.code)
+		}
+	}
+}
+
+func TestCodeInvalidSecret(t *testing.T) {
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Fatal("Code accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	current := Step(now)
+
+	codeAt := func(step int64) string {
+		code, err := Code(rfcSecret, step)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		code   string
+		skew   int64
+		step   int64
+		ok     bool
+	}{
+		{"current step", rfcSecret, codeAt(current), 1, current, true},
+		{"previous step", rfcSecret, codeAt(current - 1), 1, current - 1, true},
+		{"next step", rfcSecret, codeAt(current + 1), 1, current + 1, true},
+		{"two steps behind", rfcSecret, codeAt(current - 2), 1, 0, false},
+		{"two steps ahead", rfcSecret, codeAt(current + 2), 1, 0, false},
+		{"no skew", rfcSecret, codeAt(current - 1), 0, 0, false},
+		{"surrounding spaces", rfcSecret, " " + codeAt(current) + "\n", 1, current, true},
+		{"lower case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", codeAt(current), 1, current, true},
+		{"wrong code", rfcSecret, "000000", 1, 0, false},
+		{"too short", rfcSecret, codeAt(current)[:Digits-1], 1, 0, false},
+		{"too long", rfcSecret, codeAt(current) + "0", 1, 0, false},
+		{"empty", rfcSecret, "", 1, 0, false},
+		{"invalid secret", "not base32!", codeAt(current), 1, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			step, ok := Validate(tt.secret, tt.code, now, tt.skew)
+			if ok != tt.ok || step != tt.step {
+				t.Errorf("Validate = (%d, %v), want (%d, %v)", step, ok, tt.step, tt.ok)
+			}
+		})
+	}
+}
+
+// TestValidateReplay checks that a code reports the step it was issued for
+// wherever it is validated within the skew, so a caller keeping the last
+// used step refuses it a second time.
+func TestValidateReplay(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(now))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := Validate(rfcSecret, code, now, 1)
+	if !ok {
+		t.Fatal("Validate rejected the current code")
+	}
+
+	// the same code one period later still falls into the skew
+	again, ok := Validate(rfcSecret, code, now.Add(Period), 1)
+	if !ok {
+		t.Fatal("Validate rejected the code within the skew")
+	}
+	if again != first {
+		t.Fatalf("replayed code matched step %d, want %d", again, first)
+	}
+}
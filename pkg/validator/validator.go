@@ -1,18 +1,45 @@
 package validator
 
 import (
+	"fmt"
+	"net/mail"
 	"strings"
 	"template/internal/entity"
+	"unicode"
 	"unicode/utf8"
 )
 
+// PasswordPolicy are the rules for new passwords. Zero lengths are not
+// enforced and Breached may be nil.
+type PasswordPolicy struct {
+	MinLength      int
+	MaxLength      int
+	RequireUpper   bool
+	RequireLower   bool
+	RequireDigit   bool
+	RequireSymbol  bool
+	RejectUsername bool
+	Breached       BreachedList
+}
+
+// BreachedList tells whether a password is known from a data breach.
+type BreachedList interface {
+	Contains(password string) (bool, error)
+}
+
 type Validator struct {
 	UserErrors entity.UserFormError `json:"user_error,omitempty" bson:"user_error,omitempty"`
 	BookErrors entity.BookFormError `json:"book_error,omitempty" bson:"book_error,omitempty"`
+
+	APIKeyErrors entity.APIKeyFormError `json:"api_key_error,omitempty" bson:"api_key_error,omitempty"`
+
+	PasswordErrors entity.PasswordFormError `json:"password_error,omitempty" bson:"password_error,omitempty"`
+
+	ProfileErrors entity.ProfileFormError `json:"profile_error,omitempty" bson:"profile_error,omitempty"`
 }
 
 func (v *Validator) ValidUser() bool {
-	return !NotBlank(v.UserErrors.Username) && !NotBlank(v.UserErrors.Password) && !NotBlank(v.UserErrors.Secret)
+	return !NotBlank(v.UserErrors.Username) && !NotBlank(v.UserErrors.Email) && !NotBlank(v.UserErrors.Password) && !NotBlank(v.UserErrors.Secret)
 }
 
 func (v *Validator) ValidBook() bool {
@@ -20,6 +47,57 @@ func (v *Validator) ValidBook() bool {
 
 }
 
+func (v *Validator) ValidAPIKey() bool {
+	return !NotBlank(v.APIKeyErrors.Name) && !NotBlank(v.APIKeyErrors.Scopes) && !NotBlank(v.APIKeyErrors.ExpiresAt)
+}
+
+func (v *Validator) ValidPasswordForm() bool {
+	return !NotBlank(v.PasswordErrors.OldPassword) && !NotBlank(v.PasswordErrors.NewPassword) && !NotBlank(v.PasswordErrors.Token)
+}
+
+func (v *Validator) ValidProfile() bool {
+	return !NotBlank(v.ProfileErrors.DisplayName) && !NotBlank(v.ProfileErrors.Email)
+}
+
+// CheckPassword applies the password policy to value. Every password set
+// by a user, on signup, change or reset, must go through it. An error is
+// only returned when the breached password list cannot be read.
+func (v *Validator) CheckPassword(policy *PasswordPolicy, value, username string, key *string) error {
+	if policy.MinLength > 0 {
+		v.CheckField(MinChars(value, policy.MinLength), key, fmt.Sprintf("Password must be at least %d chars long", policy.MinLength))
+	}
+	if policy.MaxLength > 0 {
+		v.CheckField(MaxChars(value, policy.MaxLength), key, fmt.Sprintf("Password must be max %d chars long", policy.MaxLength))
+	}
+	if policy.RequireUpper {
+		v.CheckField(strings.IndexFunc(value, unicode.IsUpper) >= 0, key, "Password must contain an upper case letter")
+	}
+	if policy.RequireLower {
+		v.CheckField(strings.IndexFunc(value, unicode.IsLower) >= 0, key, "Password must contain a lower case letter")
+	}
+	if policy.RequireDigit {
+		v.CheckField(strings.IndexFunc(value, unicode.IsDigit) >= 0, key, "Password must contain a digit")
+	}
+	if policy.RequireSymbol {
+		v.CheckField(strings.IndexFunc(value, isSymbol) >= 0, key, "Password must contain a symbol")
+	}
+	if policy.RejectUsername {
+		v.CheckField(!SimilarToUsername(value, username), key, "Password must not contain the username")
+	}
+	v.CheckField(NotBlank(value), key, "Password cannot be blank")
+
+	// the lookup reads a file, skip it when the password is rejected anyway
+	if policy.Breached == nil || NotBlank(*key) {
+		return nil
+	}
+	breached, err := policy.Breached.Contains(value)
+	if err != nil {
+		return err
+	}
+	v.CheckField(!breached, key, "Password appears in a known data breach, choose another one")
+	return nil
+}
+
 func (v *Validator) CheckField(ok bool, key *string, message string) {
 	if !ok {
 		*key = message
@@ -48,6 +126,40 @@ func CheckISBN(value string, n int) bool {
 	return utf8.RuneCountInString(str) == n
 }
 
+// NormalizeEmail trims and lower-cases an address. Emails are stored and
+// looked up normalized, so addresses differing in case are the same.
+func NormalizeEmail(value string) string {
+	return strings.ToLower(strings.TrimSpace(value))
+}
+
+func ValidEmail(value string) bool {
+	addr, err := mail.ParseAddress(value)
+	return err == nil && addr.Address == value
+}
+
+// SimilarToUsername reports whether the password contains the username,
+// forwards or reversed, ignoring case. Very short usernames are ignored.
+func SimilarToUsername(password, username string) bool {
+	username = strings.ToLower(strings.TrimSpace(username))
+	if utf8.RuneCountInString(username) < 3 {
+		return false
+	}
+	password = strings.ToLower(password)
+	return strings.Contains(password, username) || strings.Contains(password, reverse(username))
+}
+
+func reverse(s string) string {
+	runes := []rune(s)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return string(runes)
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r) || unicode.IsSpace(r)
+}
+
 func CheckArr(arr []string) bool {
 	if len(arr) == 0 {
 		return false
@@ -59,3 +171,19 @@ func CheckArr(arr []string) bool {
 	}
 	return true
 }
+
+func PermittedValues(values []string, permitted ...string) bool {
+	for i := range values {
+		found := false
+		for j := range permitted {
+			if values[i] == permitted[j] {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}